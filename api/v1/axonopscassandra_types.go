@@ -0,0 +1,635 @@
+/*
+Copyright 2024 AxonOps Limited
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1
+
+import (
+	corev1 "k8s.io/api/core/v1"
+	networking "k8s.io/api/networking/v1"
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// ContainerImage defines the image of a component
+type ContainerImage struct {
+	// Image repository, the component default is used when empty
+	Repository string `json:"repository,omitempty"`
+	// Image tag, the component default is used when empty
+	Tag string `json:"tag,omitempty"`
+}
+
+// PersistentVolumeSpec defines the persistent volume specification
+type PersistentVolumeSpec struct {
+	// Optional Storage Class name
+	StorageClass string `json:"storageClass,omitempty"`
+	// Storage size, e.g. 10Gi. The data is not persisted when it is not set
+	// +optional
+	Size *resource.Quantity `json:"size,omitempty"`
+}
+
+// Ingress defines an ingress configuration for the AxonOps dashboard
+type Ingress struct {
+	Enabled          bool                    `json:"enabled,omitempty"`
+	ApiVersion       string                  `json:"apiVersion,omitempty"`
+	Annotations      map[string]string       `json:"annotations,omitempty"`
+	Labels           map[string]string       `json:"labels,omitempty"`
+	IngressClassName string                  `json:"ingressClassName,omitempty"`
+	Hosts            []string                `json:"hosts,omitempty"`
+	TLS              []networking.IngressTLS `json:"tls,omitempty"`
+	Path             string                  `json:"path,omitempty"`
+	PathType         networking.PathType     `json:"pathType,omitempty"`
+}
+
+// Rack defines a group of Cassandra nodes sharing the same rack in GossipingPropertyFileSnitch
+type Rack struct {
+	// Name of the rack, it is also part of the StatefulSet name ca-<name>-<rack>
+	// +kubebuilder:validation:MinLength=1
+	// +kubebuilder:validation:MaxLength=20
+	// +kubebuilder:validation:Pattern=`^[a-z0-9]([-a-z0-9]*[a-z0-9])?$`
+	Name string `json:"name"`
+	// Number of Cassandra nodes in the rack
+	// +kubebuilder:validation:Minimum=1
+	// +kubebuilder:default=1
+	Replicas int32 `json:"replicas,omitempty"`
+	// Labels the nodes running the pods of the rack must have
+	// +optional
+	NodeSelector map[string]string `json:"nodeSelector,omitempty"`
+	// Availability zone the pods of the rack are scheduled in, matched against the
+	// topology.kubernetes.io/zone node label
+	// +optional
+	Zone string `json:"zone,omitempty"`
+}
+
+// Datacenter defines a Cassandra datacenter of a multi-datacenter cluster. The unset
+// fields are taken from the cluster.
+type Datacenter struct {
+	// Name of the datacenter, it is also part of the StatefulSet name ca-<name>-<dc>
+	// +kubebuilder:validation:MinLength=1
+	// +kubebuilder:validation:MaxLength=20
+	// +kubebuilder:validation:Pattern=`^[a-z0-9]([-a-z0-9]*[a-z0-9])?$`
+	Name string `json:"name"`
+	// Number of Cassandra nodes in the datacenter, ignored when racks are set
+	// +kubebuilder:validation:Minimum=0
+	Replicas int32 `json:"replicas,omitempty"`
+	// Spread the nodes of the datacenter over several racks, one StatefulSet is created per rack
+	// +optional
+	// +listType=map
+	// +listMapKey=name
+	Racks []Rack `json:"racks,omitempty"`
+	// +optional
+	PersistentVolume PersistentVolumeSpec `json:"persistentVolume,omitempty"`
+	// Maximum heap size in the -Xmx format, e.g. 512M
+	// +optional
+	HeapSize string `json:"heapSize,omitempty"`
+	// +optional
+	Resources corev1.ResourceRequirements `json:"resources,omitempty"`
+}
+
+// JVMHeapMode tells how the heap of the Cassandra nodes is sized
+// +kubebuilder:validation:Enum=Fixed;Auto
+type JVMHeapMode string
+
+const (
+	// JVMHeapFixed uses the heapSize of the cluster or the datacenter
+	JVMHeapFixed JVMHeapMode = "Fixed"
+	// JVMHeapAuto derives the heap from the memory limit of the container like cassandra-env.sh
+	// does from the memory of the host: half of it up to 1G or a quarter of it up to 8G,
+	// whichever is larger
+	JVMHeapAuto JVMHeapMode = "Auto"
+)
+
+// GarbageCollector is the garbage collector of the Cassandra nodes
+// +kubebuilder:validation:Enum=G1;CMS;ZGC
+type GarbageCollector string
+
+const (
+	GarbageCollectorG1  GarbageCollector = "G1"
+	GarbageCollectorCMS GarbageCollector = "CMS"
+	GarbageCollectorZGC GarbageCollector = "ZGC"
+)
+
+// JVMOptions configures the JVM of the Cassandra nodes. The options are written to the jvm
+// options files of the image, an option replaces the option of the same name of the file.
+type JVMOptions struct {
+	// Heap sizing, Fixed by default
+	// +optional
+	Heap JVMHeapMode `json:"heap,omitempty"`
+	// Garbage collector replacing the one of the image. CMS needs Java 11 (Cassandra 4.x)
+	// and ZGC Java 17 (Cassandra 5.0).
+	// +optional
+	GC GarbageCollector `json:"gc,omitempty"`
+	// Options added to jvm-server.options, e.g. -XX:+AlwaysPreTouch or -Dcassandra.ring_delay_ms=5000
+	// +optional
+	Options []string `json:"options,omitempty"`
+	// Options added to jvm11-server.options, read when the nodes run Java 11
+	// +optional
+	JVM11Options []string `json:"jvm11Options,omitempty"`
+	// Options added to jvm17-server.options, read when the nodes run Java 17
+	// +optional
+	JVM17Options []string `json:"jvm17Options,omitempty"`
+}
+
+// Authentication enables the authentication and the authorization of the Cassandra nodes
+type Authentication struct {
+	// Switch the nodes to PasswordAuthenticator and CassandraAuthorizer. A superuser with a
+	// random password replaces the default cassandra role, its credentials are stored in the
+	// Secret reported in the status.
+	Enabled bool `json:"enabled,omitempty"`
+	// Name of the superuser role, admin by default
+	// +optional
+	Superuser string `json:"superuser,omitempty"`
+}
+
+// IssuerReference points to a cert-manager Issuer or ClusterIssuer
+type IssuerReference struct {
+	Name string `json:"name"`
+	// Issuer or ClusterIssuer, Issuer by default
+	// +kubebuilder:validation:Enum=Issuer;ClusterIssuer
+	// +optional
+	Kind string `json:"kind,omitempty"`
+	// +optional
+	Group string `json:"group,omitempty"`
+}
+
+// TLS encrypts the connections of the clients, between the Cassandra nodes and between the
+// AxonOps agents and the AxonOps server
+type TLS struct {
+	// Encrypt the connections on the native transport port with a certificate per node
+	Enabled bool `json:"enabled,omitempty"`
+	// Encrypt the connections between the nodes on the SSL storage port 7001, the nodes
+	// authenticate each other with their certificate
+	// +optional
+	Internode bool `json:"internode,omitempty"`
+	// Encrypt the connections of the AxonOps agents to the AxonOps server, the agents use
+	// the certificate of their node and the server gets its own
+	// +optional
+	Agent bool `json:"agent,omitempty"`
+	// Keep accepting unencrypted connections from the clients and the other nodes
+	// +optional
+	Optional bool `json:"optional,omitempty"`
+	// Require the clients to present a certificate signed by the certificate authority
+	// +optional
+	RequireClientAuth bool `json:"requireClientAuth,omitempty"`
+	// Issue the certificates of the nodes with cert-manager instead of the certificate
+	// authority generated by the operator
+	// +optional
+	IssuerRef *IssuerReference `json:"issuerRef,omitempty"`
+}
+
+// AxonOpsCassandraCluster defines the Apache Cassandra cluster to install
+type AxonOpsCassandraCluster struct {
+	Image ContainerImage `json:"image,omitempty"`
+	// Number of Cassandra nodes, ignored when racks or datacenters are set
+	// +kubebuilder:validation:Minimum=0
+	Replicas int32 `json:"replicas,omitempty"`
+	// Spread the nodes over several racks, one StatefulSet is created per rack.
+	// All the nodes are in rack1 of a single StatefulSet when it is empty.
+	// Ignored when datacenters are set.
+	// +optional
+	// +listType=map
+	// +listMapKey=name
+	Racks []Rack `json:"racks,omitempty"`
+	// Split the cluster into several datacenters sharing the cluster name and the seeds.
+	// The dc and racks fields are ignored when it is set.
+	// +optional
+	// +listType=map
+	// +listMapKey=name
+	Datacenters []Datacenter `json:"datacenters,omitempty"`
+	// Number of seeds of every datacenter, they are picked in turn from each rack
+	// +kubebuilder:validation:Minimum=1
+	// +optional
+	SeedsPerDC int32 `json:"seedsPerDC,omitempty"`
+	// Do not run nodetool cleanup on the existing nodes once nodes are added
+	// +optional
+	DisableCleanup bool `json:"disableCleanup,omitempty"`
+	// Settings of cassandra.yaml merged into the default file of the image, e.g.
+	// num_tokens: 16 or read_request_timeout: 10s. The names and units of Cassandra 4.1
+	// and later are translated for 4.0 and the other way round.
+	// +optional
+	Config           map[string]apiextensionsv1.JSON `json:"config,omitempty"`
+	ClusterName      string                          `json:"clusterName,omitempty"`
+	DC               string                          `json:"dc,omitempty"`
+	PersistentVolume PersistentVolumeSpec            `json:"persistentVolume,omitempty"`
+	// Deprecated: not used by Cassandra, set the JVM options in jvm
+	JavaOpts string `json:"javaOpts,omitempty"`
+	// Maximum heap size in the -Xmx format, e.g. 512M. Ignored when jvm.heap is Auto.
+	HeapSize string `json:"heapSize,omitempty"`
+	// JVM of the nodes, the options are written to the jvm options files instead of the
+	// environment of the container when it is set
+	// +optional
+	JVM *JVMOptions `json:"jvm,omitempty"`
+	// +optional
+	Authentication Authentication `json:"authentication,omitempty"`
+	// +optional
+	TLS         TLS               `json:"tls,omitempty"`
+	Annotations map[string]string `json:"annotations,omitempty"`
+	Labels      map[string]string `json:"labels,omitempty"`
+	// Environment variables added to the Cassandra container
+	Env        []corev1.EnvVar             `json:"env,omitempty"`
+	EnvFrom    []corev1.EnvFromSource      `json:"envFrom,omitempty"`
+	Resources  corev1.ResourceRequirements `json:"resources,omitempty"`
+	PullPolicy corev1.PullPolicy           `json:"pullPolicy,omitempty"`
+}
+
+// MetricsStore defines the Cassandra cluster the AxonOps server keeps its metrics in.
+// Elasticsearch is still used for the events and the search.
+type MetricsStore struct {
+	// Store the metrics in a dedicated Cassandra cluster instead of Elasticsearch
+	Enabled bool           `json:"enabled,omitempty"`
+	Image   ContainerImage `json:"image,omitempty"`
+	// Number of Cassandra nodes of the metrics store
+	// +kubebuilder:validation:Minimum=0
+	Replicas         int32                `json:"replicas,omitempty"`
+	ClusterName      string               `json:"clusterName,omitempty"`
+	DC               string               `json:"dc,omitempty"`
+	PersistentVolume PersistentVolumeSpec `json:"persistentVolume,omitempty"`
+	// Deprecated: not used by Cassandra
+	JavaOpts string `json:"javaOpts,omitempty"`
+	// Maximum heap size in the -Xmx format, e.g. 512M
+	HeapSize    string                      `json:"heapSize,omitempty"`
+	Annotations map[string]string           `json:"annotations,omitempty"`
+	Labels      map[string]string           `json:"labels,omitempty"`
+	Env         []corev1.EnvVar             `json:"env,omitempty"`
+	EnvFrom     []corev1.EnvFromSource      `json:"envFrom,omitempty"`
+	Resources   corev1.ResourceRequirements `json:"resources,omitempty"`
+	PullPolicy  corev1.PullPolicy           `json:"pullPolicy,omitempty"`
+}
+
+// AxonOpsDashboard defines the dashboard
+type AxonOpsDashboard struct {
+	// Change the default repository and tag
+	Image ContainerImage `json:"image,omitempty"`
+	// Increase the number of replicas if desired from the default, 1
+	// +kubebuilder:validation:Minimum=0
+	Replicas    int32                       `json:"replicas,omitempty"`
+	Ingress     Ingress                     `json:"ingress,omitempty"`
+	Annotations map[string]string           `json:"annotations,omitempty"`
+	Labels      map[string]string           `json:"labels,omitempty"`
+	Env         []corev1.EnvVar             `json:"env,omitempty"`
+	EnvFrom     []corev1.EnvFromSource      `json:"envFrom,omitempty"`
+	Resources   corev1.ResourceRequirements `json:"resources,omitempty"`
+	PullPolicy  corev1.PullPolicy           `json:"pullPolicy,omitempty"`
+}
+
+// AxonOpsServer defines the AxonOps server
+type AxonOpsServer struct {
+	// Container image definition with repository and tag
+	Image       ContainerImage              `json:"image,omitempty"`
+	Annotations map[string]string           `json:"annotations,omitempty"`
+	Labels      map[string]string           `json:"labels,omitempty"`
+	Env         []corev1.EnvVar             `json:"env,omitempty"`
+	EnvFrom     []corev1.EnvFromSource      `json:"envFrom,omitempty"`
+	Resources   corev1.ResourceRequirements `json:"resources,omitempty"`
+	PullPolicy  corev1.PullPolicy           `json:"pullPolicy,omitempty"`
+	// Cassandra cluster used to store the metrics
+	MetricsStore MetricsStore `json:"metricsStore,omitempty"`
+}
+
+// Elasticsearch defines the Elasticsearch node used by the AxonOps server
+type Elasticsearch struct {
+	// Container image definition with repository and tag
+	Image            ContainerImage              `json:"image,omitempty"`
+	PersistentVolume PersistentVolumeSpec        `json:"persistentVolume,omitempty"`
+	JavaOpts         string                      `json:"javaOpts,omitempty"`
+	ClusterName      string                      `json:"clusterName,omitempty"`
+	Env              []corev1.EnvVar             `json:"env,omitempty"`
+	EnvFrom          []corev1.EnvFromSource      `json:"envFrom,omitempty"`
+	Resources        corev1.ResourceRequirements `json:"resources,omitempty"`
+	PullPolicy       corev1.PullPolicy           `json:"pullPolicy,omitempty"`
+}
+
+// AxonOpsCluster defines the AxonOps components monitoring the Cassandra cluster
+type AxonOpsCluster struct {
+	Dashboard     AxonOpsDashboard `json:"dashboard,omitempty"`
+	Server        AxonOpsServer    `json:"server,omitempty"`
+	Elasticsearch Elasticsearch    `json:"elasticsearch,omitempty"`
+}
+
+// DriftPolicy defines what the operator does when a generated object was modified outside of the operator
+// +kubebuilder:validation:Enum=Revert;Report;Ignore
+type DriftPolicy string
+
+const (
+	// DriftPolicyRevert overwrites the modified fields with the rendered configuration
+	DriftPolicyRevert DriftPolicy = "Revert"
+	// DriftPolicyReport keeps the modified fields and reports them in the DriftDetected condition
+	DriftPolicyReport DriftPolicy = "Report"
+	// DriftPolicyIgnore keeps the modified fields and does not look for drift
+	DriftPolicyIgnore DriftPolicy = "Ignore"
+)
+
+// AxonOpsCassandraSpec defines the desired state of AxonOpsCassandra
+type AxonOpsCassandraSpec struct {
+	// Defines the Development cluster composition. The default is to build
+	// an Apache Cassandra cluster with not persistent storage and
+	// connected to a locally running AxonOps which requires
+	// the AxonOps server, the AxonOps dashboard and Elasticsearch as metrics storage
+	Cassandra AxonOpsCassandraCluster `json:"cassandra,omitempty"`
+	AxonOps   AxonOpsCluster          `json:"axonops,omitempty"`
+	// What to do when a generated object is edited by hand, e.g. with kubectl edit.
+	// Revert (the default) overwrites the changes, Report keeps them and lists them
+	// in the DriftDetected condition and Ignore keeps them silently.
+	// +kubebuilder:default=Revert
+	// +optional
+	DriftPolicy DriftPolicy `json:"driftPolicy,omitempty"`
+	// Create every component at once instead of waiting for Elasticsearch before starting
+	// the AxonOps server and for the AxonOps server before starting the dashboard and Cassandra
+	// +optional
+	ParallelStartup bool `json:"parallelStartup,omitempty"`
+}
+
+// AxonOpsCassandraPhase is a high level summary of where the environment is in its lifecycle
+type AxonOpsCassandraPhase string
+
+const (
+	// PhasePending means none of the components have been created yet
+	PhasePending AxonOpsCassandraPhase = "Pending"
+	// PhaseProvisioning means the components are being created and are not all ready yet
+	PhaseProvisioning AxonOpsCassandraPhase = "Provisioning"
+	// PhaseReady means every component is ready
+	PhaseReady AxonOpsCassandraPhase = "Ready"
+	// PhaseDegraded means the environment was ready before but one or more components are not anymore
+	PhaseDegraded AxonOpsCassandraPhase = "Degraded"
+	// PhaseDeleting means the environment is being removed
+	PhaseDeleting AxonOpsCassandraPhase = "Deleting"
+)
+
+// Condition types reported in the AxonOpsCassandra status
+const (
+	// ConditionReady is true when all the other component conditions are true
+	ConditionReady = "Ready"
+	// ConditionElasticsearchReady reports the state of the es-<name> StatefulSet
+	ConditionElasticsearchReady = "ElasticsearchReady"
+	// ConditionAxonServerReady reports the state of the as-<name> StatefulSet
+	ConditionAxonServerReady = "AxonServerReady"
+	// ConditionDashboardReady reports the state of the ds-<name> Deployment
+	ConditionDashboardReady = "DashboardReady"
+	// ConditionMetricsCassandraReady reports the state of the ca-metrics-<name> StatefulSet
+	ConditionMetricsCassandraReady = "MetricsCassandraReady"
+	// ConditionCassandraReady reports the state of the ca-<name> StatefulSet
+	ConditionCassandraReady = "CassandraReady"
+	// ConditionReconciled is false when the last reconcile failed, the reason names the failed step
+	ConditionReconciled = "Reconciled"
+	// ConditionDriftDetected is true when a generated object was modified outside of the operator
+	ConditionDriftDetected = "DriftDetected"
+	// ConditionScaleDownBlocked is true when the Cassandra nodes cannot be removed safely
+	ConditionScaleDownBlocked = "ScaleDownBlocked"
+	// ConditionUpgradeHalted is true when a Cassandra major version upgrade cannot go on
+	ConditionUpgradeHalted = "UpgradeHalted"
+	// ConditionDeadNodes is true when the Cassandra ring has nodes down that no pod runs anymore
+	ConditionDeadNodes = "DeadNodes"
+)
+
+// NodeOperationType is a maintenance task run on the Cassandra nodes one at a time
+type NodeOperationType string
+
+const (
+	// NodeOperationDecommission removes the nodes above the requested replicas from the ring
+	NodeOperationDecommission NodeOperationType = "Decommission"
+	// NodeOperationCleanup runs nodetool cleanup on the nodes that were there before a scale up
+	NodeOperationCleanup NodeOperationType = "Cleanup"
+	// NodeOperationRestart drains and restarts the nodes running an outdated pod template
+	NodeOperationRestart NodeOperationType = "Restart"
+	// NodeOperationSnapshot takes a snapshot of the nodes before a major version upgrade
+	NodeOperationSnapshot NodeOperationType = "Snapshot"
+	// NodeOperationUpgradeSSTables rewrites the SSTables in the format of the new version after an upgrade
+	NodeOperationUpgradeSSTables NodeOperationType = "UpgradeSSTables"
+	// NodeOperationRemoveNode removes dead nodes from the ring with nodetool removenode, the
+	// nodes of the operation are host IDs
+	NodeOperationRemoveNode NodeOperationType = "RemoveNode"
+)
+
+// UpgradePhase is the step a Cassandra major version upgrade is at
+type UpgradePhase string
+
+const (
+	// UpgradePhaseSnapshot takes a snapshot of every node with the previous version
+	UpgradePhaseSnapshot UpgradePhase = "Snapshot"
+	// UpgradePhaseRestart restarts the nodes one at a time with the new version
+	UpgradePhaseRestart UpgradePhase = "Restart"
+	// UpgradePhaseUpgradeSSTables runs nodetool upgradesstables on the upgraded nodes
+	UpgradePhaseUpgradeSSTables UpgradePhase = "UpgradeSSTables"
+	// UpgradePhaseCompleted means every node runs the new version
+	UpgradePhaseCompleted UpgradePhase = "Completed"
+)
+
+// UpgradeStatus reports the progress of a Cassandra major version upgrade
+type UpgradeStatus struct {
+	// Image the nodes ran before the upgrade
+	From string `json:"from"`
+	// Image the nodes are upgraded to
+	To    string       `json:"to"`
+	Phase UpgradePhase `json:"phase"`
+	// Name of the snapshot taken on every node before the upgrade
+	// +optional
+	Snapshot string `json:"snapshot,omitempty"`
+	// +optional
+	StartedAt *metav1.Time `json:"startedAt,omitempty"`
+	// +optional
+	CompletedAt *metav1.Time `json:"completedAt,omitempty"`
+}
+
+const (
+	// RestartAtAnnotation requests a rolling restart of the Cassandra nodes when set or changed
+	// on the AxonOpsCassandra, the value is usually a timestamp
+	RestartAtAnnotation = "axonops.com/restart-at"
+	// ConfigHashAnnotation is set on the Cassandra pod template to the hash of the configuration
+	// of the nodes, so a configuration change restarts them
+	ConfigHashAnnotation = "axonops.com/config-hash"
+	// RemoveNodeAnnotation lists the host IDs of dead nodes, separated by commas, to remove from
+	// the ring. Only the nodes reported in the deadNodes status are removed.
+	RemoveNodeAnnotation = "axonops.com/remove-node"
+	// TLSRotatedAtAnnotation is set on the keystores Secret and on the pod templates of the
+	// Cassandra nodes and of the AxonOps server when the certificates are renewed, so they
+	// restart with the new ones
+	TLSRotatedAtAnnotation = "axonops.com/tls-rotated-at"
+)
+
+// DeadNode is a Cassandra node down in the ring that no pod runs anymore, usually because
+// the volume of its pod was lost and the pod joined the ring again as a new node
+type DeadNode struct {
+	HostID  string `json:"hostID"`
+	Address string `json:"address"`
+	// +optional
+	DC string `json:"dc,omitempty"`
+	// +optional
+	Rack string `json:"rack,omitempty"`
+}
+
+// NodeOperationStatus reports the progress of the maintenance task running on the Cassandra nodes
+type NodeOperationStatus struct {
+	Type NodeOperationType `json:"type"`
+	// Node the operation is running on
+	// +optional
+	Node string `json:"node,omitempty"`
+	// Nodes the operation still has to run on
+	// +optional
+	Pending []string `json:"pending,omitempty"`
+	// Nodes the operation is done on
+	// +optional
+	Completed []string `json:"completed,omitempty"`
+	// Nodes the operation failed on
+	// +optional
+	Failed []string `json:"failed,omitempty"`
+	// Time the operation started on the current node
+	// +optional
+	StartedAt *metav1.Time `json:"startedAt,omitempty"`
+	// Time the operation finished on every node, the last operation is kept in the status once it is done
+	// +optional
+	CompletedAt *metav1.Time `json:"completedAt,omitempty"`
+	// +optional
+	Message string `json:"message,omitempty"`
+}
+
+// IsRunning tells if the operation has not finished yet
+func (o *NodeOperationStatus) IsRunning() bool {
+	return o != nil && o.CompletedAt == nil
+}
+
+// IsRunning tells if the upgrade has not finished yet
+func (u *UpgradeStatus) IsRunning() bool {
+	return u != nil && u.Phase != UpgradePhaseCompleted
+}
+
+// AuthenticationStatus reports the credentials of the Cassandra cluster
+type AuthenticationStatus struct {
+	// Name of the Secret holding the username and the password of the superuser
+	Secret string `json:"secret"`
+	// SuperuserCreated tells if the superuser replaced the default cassandra role
+	// +optional
+	SuperuserCreated bool `json:"superuserCreated,omitempty"`
+	// SystemAuthReplication is the replication factor of system_auth in every datacenter
+	// +optional
+	SystemAuthReplication map[string]int32 `json:"systemAuthReplication,omitempty"`
+	// Message explains what the setup of the superuser is waiting for
+	// +optional
+	Message string `json:"message,omitempty"`
+}
+
+// TLSStatus reports the certificates of the Cassandra nodes
+type TLSStatus struct {
+	// Name of the Secret holding the keystores of the nodes, the truststore and the
+	// certificate of the certificate authority in ca.crt
+	Secret string `json:"secret"`
+	// Name of the Secret of the certificate authority generated by the operator
+	// +optional
+	CASecret string `json:"caSecret,omitempty"`
+	// Expiry of the certificate authority
+	// +optional
+	CANotAfter *metav1.Time `json:"caNotAfter,omitempty"`
+	// Expiry of the certificate of every node and of the AxonOps server
+	// +optional
+	Certificates []CertificateStatus `json:"certificates,omitempty"`
+	// Last time the certificates were renewed and the nodes restarted to load them
+	// +optional
+	RotatedAt *metav1.Time `json:"rotatedAt,omitempty"`
+	// Message explains what the certificates are waiting for
+	// +optional
+	Message string `json:"message,omitempty"`
+}
+
+// CertificateStatus is the expiry of the certificate of a node or of the AxonOps server
+type CertificateStatus struct {
+	// Name of the pod of the node, or as-<name> for the AxonOps server
+	Name     string      `json:"name"`
+	NotAfter metav1.Time `json:"notAfter"`
+}
+
+// RackStatus is the observed state of the StatefulSet of a Cassandra rack
+type RackStatus struct {
+	// Name of the rack
+	Name string `json:"name"`
+	// Datacenter of the rack
+	// +optional
+	DC string `json:"dc,omitempty"`
+	// Name of the StatefulSet running the nodes of the rack
+	StatefulSet string `json:"statefulSet"`
+	// Number of nodes requested in the rack
+	Replicas int32 `json:"replicas"`
+	// Number of nodes ready in the rack
+	ReadyReplicas int32 `json:"readyReplicas"`
+}
+
+// AxonOpsCassandraStatus defines the observed state of AxonOpsCassandra
+type AxonOpsCassandraStatus struct {
+	// Phase summarises the state of all the components
+	// +optional
+	Phase AxonOpsCassandraPhase `json:"phase,omitempty"`
+	// ObservedGeneration is the most recent generation reconciled by the operator
+	// +optional
+	ObservedGeneration int64 `json:"observedGeneration,omitempty"`
+	// BlockedOn is the startup step waiting for the components it depends on to be ready
+	// +optional
+	BlockedOn string `json:"blockedOn,omitempty"`
+	// +optional
+	Reason string `json:"reason,omitempty"`
+	// +optional
+	Message string `json:"message,omitempty"`
+	// Racks reports the nodes of every rack of the Cassandra cluster
+	// +optional
+	// +listType=map
+	// +listMapKey=statefulSet
+	Racks []RackStatus `json:"racks,omitempty"`
+	// Operation is the maintenance task running on the Cassandra nodes, or the last one once it is done
+	// +optional
+	Operation *NodeOperationStatus `json:"operation,omitempty"`
+	// Upgrade is the Cassandra major version upgrade in progress, or the last one once it is done
+	// +optional
+	Upgrade *UpgradeStatus `json:"upgrade,omitempty"`
+	// DeadNodes lists the nodes down in the ring that no pod runs anymore
+	// +optional
+	DeadNodes []DeadNode `json:"deadNodes,omitempty"`
+	// Authentication reports the superuser credentials when authentication is enabled
+	// +optional
+	Authentication *AuthenticationStatus `json:"authentication,omitempty"`
+	// TLS reports the Secrets of the certificates when TLS is enabled
+	// +optional
+	TLS *TLSStatus `json:"tls,omitempty"`
+	// +optional
+	// +listType=map
+	// +listMapKey=type
+	Conditions []metav1.Condition `json:"conditions,omitempty"`
+}
+
+//+kubebuilder:object:root=true
+//+kubebuilder:subresource:status
+//+kubebuilder:storageversion
+//+kubebuilder:printcolumn:name="Phase",type="string",JSONPath=".status.phase"
+//+kubebuilder:printcolumn:name="Ready",type="string",JSONPath=".status.conditions[?(@.type=='Ready')].status"
+//+kubebuilder:printcolumn:name="Age",type="date",JSONPath=".metadata.creationTimestamp"
+
+// AxonOpsCassandra is the Schema for the axonopscassandras API
+type AxonOpsCassandra struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   AxonOpsCassandraSpec   `json:"spec,omitempty"`
+	Status AxonOpsCassandraStatus `json:"status,omitempty"`
+}
+
+//+kubebuilder:object:root=true
+
+// AxonOpsCassandraList contains a list of AxonOpsCassandra
+type AxonOpsCassandraList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []AxonOpsCassandra `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&AxonOpsCassandra{}, &AxonOpsCassandraList{})
+}
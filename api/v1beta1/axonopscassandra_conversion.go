@@ -0,0 +1,408 @@
+/*
+Copyright 2024 AxonOps Limited
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1beta1
+
+import (
+	"encoding/json"
+	"fmt"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/api/resource"
+	"sigs.k8s.io/controller-runtime/pkg/conversion"
+
+	v1 "github.com/axonops/axonops-developer-operator/api/v1"
+)
+
+// conversionDataAnnotation holds the v1 spec of an object read as v1beta1 when v1beta1 cannot
+// represent all of it, e.g. an env var with valueFrom. Writing the object back as v1beta1
+// restores the parts of the v1 spec that were not changed.
+const conversionDataAnnotation = "axonops.com/v1-spec"
+
+var _ conversion.Convertible = &AxonOpsCassandra{}
+
+// ConvertTo converts this AxonOpsCassandra to the Hub version (v1)
+func (src *AxonOpsCassandra) ConvertTo(dstRaw conversion.Hub) error {
+	dst := dstRaw.(*v1.AxonOpsCassandra)
+
+	data, fromHub := src.GetAnnotations()[conversionDataAnnotation]
+	spec, err := convertSpecTo(src.Spec, fromHub)
+	if err != nil {
+		return err
+	}
+
+	dst.ObjectMeta = *src.ObjectMeta.DeepCopy()
+	dst.Spec = spec
+	dst.Status = v1.AxonOpsCassandraStatus{
+		Phase:              v1.AxonOpsCassandraPhase(src.Status.Phase),
+		ObservedGeneration: src.Status.ObservedGeneration,
+		BlockedOn:          src.Status.BlockedOn,
+		Reason:             src.Status.Reason,
+		Message:            src.Status.Message,
+		Conditions:         src.Status.Conditions,
+	}
+
+	if fromHub {
+		delete(dst.Annotations, conversionDataAnnotation)
+		if len(dst.Annotations) == 0 {
+			dst.Annotations = nil
+		}
+		var stored v1.AxonOpsCassandraSpec
+		if err := json.Unmarshal([]byte(data), &stored); err != nil {
+			return fmt.Errorf("invalid %s annotation: %w", conversionDataAnnotation, err)
+		}
+		restoreSpec(&dst.Spec, stored, src.Spec)
+	}
+	return nil
+}
+
+// ConvertFrom converts from the Hub version (v1) to this version
+func (dst *AxonOpsCassandra) ConvertFrom(srcRaw conversion.Hub) error {
+	src := srcRaw.(*v1.AxonOpsCassandra)
+
+	dst.ObjectMeta = *src.ObjectMeta.DeepCopy()
+	dst.Spec = convertSpecFrom(src.Spec)
+	dst.Status = AxonOpsCassandraStatus{
+		Phase:              AxonOpsCassandraPhase(src.Status.Phase),
+		ObservedGeneration: src.Status.ObservedGeneration,
+		BlockedOn:          src.Status.BlockedOn,
+		Reason:             src.Status.Reason,
+		Message:            src.Status.Message,
+		Conditions:         src.Status.Conditions,
+	}
+
+	// Only keep a copy of the v1 spec when converting back would lose something
+	roundTrip, err := convertSpecTo(dst.Spec, false)
+	if err == nil && equality.Semantic.DeepEqual(roundTrip, src.Spec) {
+		return nil
+	}
+	data, err := json.Marshal(src.Spec)
+	if err != nil {
+		return err
+	}
+	if dst.Annotations == nil {
+		dst.Annotations = map[string]string{}
+	}
+	dst.Annotations[conversionDataAnnotation] = string(data)
+	return nil
+}
+
+// convertSpecTo converts a v1beta1 spec. The v1beta1 controller rendered the Cassandra volume
+// from cassandraMetricsCluster.persistentVolume, the v1 Cassandra cluster has its own volume so
+// it is set from the metrics cluster unless the object was converted from v1 in the first place.
+func convertSpecTo(src AxonOpsCassandraSpec, fromHub bool) (v1.AxonOpsCassandraSpec, error) {
+	dst := v1.AxonOpsCassandraSpec{
+		DriftPolicy:     v1.DriftPolicy(src.DriftPolicy),
+		ParallelStartup: src.ParallelStartup,
+	}
+
+	cassandraVolume := src.AxonOps.Server.CassandraMetricsCluster.PersistentVolume
+	if fromHub {
+		cassandraVolume = src.Cassandra.PersistentVolume
+	}
+	var err error
+	if dst.Cassandra, err = convertClusterTo(src.Cassandra, cassandraVolume, "spec.cassandra"); err != nil {
+		return dst, err
+	}
+
+	metrics := src.AxonOps.Server.CassandraMetricsCluster
+	metricsCluster, err := convertClusterTo(metrics, metrics.PersistentVolume, "spec.axonops.server.cassandraMetricsCluster")
+	if err != nil {
+		return dst, err
+	}
+	dst.AxonOps.Server = convertServerTo(src.AxonOps.Server)
+	dst.AxonOps.Server.MetricsStore = v1.MetricsStore{
+		Enabled:          src.AxonOps.Server.CassandraMetricsEnabled,
+		Image:            metricsCluster.Image,
+		Replicas:         metricsCluster.Replicas,
+		ClusterName:      metricsCluster.ClusterName,
+		DC:               metricsCluster.DC,
+		PersistentVolume: metricsCluster.PersistentVolume,
+		JavaOpts:         metricsCluster.JavaOpts,
+		HeapSize:         metricsCluster.HeapSize,
+		Annotations:      metricsCluster.Annotations,
+		Labels:           metricsCluster.Labels,
+		Env:              metricsCluster.Env,
+		Resources:        metricsCluster.Resources,
+		PullPolicy:       metricsCluster.PullPolicy,
+	}
+
+	dst.AxonOps.Dashboard = convertDashboardTo(src.AxonOps.Dashboard)
+	if dst.AxonOps.Elasticsearch, err = convertElasticsearchTo(src.AxonOps.Elasticsearch); err != nil {
+		return dst, err
+	}
+	return dst, nil
+}
+
+func convertSpecFrom(src v1.AxonOpsCassandraSpec) AxonOpsCassandraSpec {
+	store := src.AxonOps.Server.MetricsStore
+	dst := AxonOpsCassandraSpec{
+		Cassandra: convertClusterFrom(src.Cassandra),
+		AxonOps: AxonOpsCluster{
+			Dashboard:     convertDashboardFrom(src.AxonOps.Dashboard),
+			Server:        convertServerFrom(src.AxonOps.Server),
+			Elasticsearch: convertElasticsearchFrom(src.AxonOps.Elasticsearch),
+		},
+		DriftPolicy:     DriftPolicy(src.DriftPolicy),
+		ParallelStartup: src.ParallelStartup,
+	}
+	dst.AxonOps.Server.CassandraMetricsEnabled = store.Enabled
+	dst.AxonOps.Server.CassandraMetricsCluster = convertClusterFrom(v1.AxonOpsCassandraCluster{
+		Image:            store.Image,
+		Replicas:         store.Replicas,
+		ClusterName:      store.ClusterName,
+		DC:               store.DC,
+		PersistentVolume: store.PersistentVolume,
+		JavaOpts:         store.JavaOpts,
+		HeapSize:         store.HeapSize,
+		Annotations:      store.Annotations,
+		Labels:           store.Labels,
+		Env:              store.Env,
+		Resources:        store.Resources,
+		PullPolicy:       store.PullPolicy,
+	})
+	return dst
+}
+
+// restoreSpec puts back the components of the stored v1 spec that were not modified
+// while the object was read and written as v1beta1
+func restoreSpec(dst *v1.AxonOpsCassandraSpec, stored v1.AxonOpsCassandraSpec, src AxonOpsCassandraSpec) {
+	unchanged := func(a, b interface{}) bool {
+		return equality.Semantic.DeepEqual(a, b)
+	}
+	view := convertSpecFrom(stored)
+
+	if unchanged(view.Cassandra, src.Cassandra) {
+		dst.Cassandra = stored.Cassandra
+	}
+	// v1beta1 cannot describe the racks, datacenters, seeds, node operations, cassandra.yaml
+	// settings, JVM options, authentication and TLS, an edit made through it keeps them
+	dst.Cassandra.Racks = stored.Cassandra.Racks
+	dst.Cassandra.Datacenters = stored.Cassandra.Datacenters
+	dst.Cassandra.SeedsPerDC = stored.Cassandra.SeedsPerDC
+	dst.Cassandra.DisableCleanup = stored.Cassandra.DisableCleanup
+	dst.Cassandra.Config = stored.Cassandra.Config
+	dst.Cassandra.JVM = stored.Cassandra.JVM
+	dst.Cassandra.Authentication = stored.Cassandra.Authentication
+	dst.Cassandra.TLS = stored.Cassandra.TLS
+	if unchanged(view.AxonOps.Server.CassandraMetricsEnabled, src.AxonOps.Server.CassandraMetricsEnabled) &&
+		unchanged(view.AxonOps.Server.CassandraMetricsCluster, src.AxonOps.Server.CassandraMetricsCluster) {
+		dst.AxonOps.Server.MetricsStore = stored.AxonOps.Server.MetricsStore
+	}
+	if unchanged(serverOnly(view.AxonOps.Server), serverOnly(src.AxonOps.Server)) {
+		store := dst.AxonOps.Server.MetricsStore
+		dst.AxonOps.Server = stored.AxonOps.Server
+		dst.AxonOps.Server.MetricsStore = store
+	}
+	if unchanged(view.AxonOps.Dashboard, src.AxonOps.Dashboard) {
+		dst.AxonOps.Dashboard = stored.AxonOps.Dashboard
+	}
+	if unchanged(view.AxonOps.Elasticsearch, src.AxonOps.Elasticsearch) {
+		dst.AxonOps.Elasticsearch = stored.AxonOps.Elasticsearch
+	}
+	// nor envFrom, which is kept on every component
+	dst.Cassandra.EnvFrom = stored.Cassandra.EnvFrom
+	dst.AxonOps.Server.EnvFrom = stored.AxonOps.Server.EnvFrom
+	dst.AxonOps.Server.MetricsStore.EnvFrom = stored.AxonOps.Server.MetricsStore.EnvFrom
+	dst.AxonOps.Dashboard.EnvFrom = stored.AxonOps.Dashboard.EnvFrom
+	dst.AxonOps.Elasticsearch.EnvFrom = stored.AxonOps.Elasticsearch.EnvFrom
+}
+
+// serverOnly drops the metrics cluster from the server so the two can be compared separately
+func serverOnly(server AxonOpsServer) AxonOpsServer {
+	server.CassandraMetricsEnabled = false
+	server.CassandraMetricsCluster = AxonOpsCassandraCluster{}
+	return server
+}
+
+func convertClusterTo(src AxonOpsCassandraCluster, volume PersistentVolumeSpec, path string) (v1.AxonOpsCassandraCluster, error) {
+	pv, err := convertVolumeTo(volume, path+".persistentVolume.size")
+	if err != nil {
+		return v1.AxonOpsCassandraCluster{}, err
+	}
+	return v1.AxonOpsCassandraCluster{
+		Image:            v1.ContainerImage(src.Image),
+		Replicas:         int32(src.Replicas),
+		ClusterName:      src.ClusterName,
+		DC:               src.DC,
+		PersistentVolume: pv,
+		JavaOpts:         src.JavaOpts,
+		HeapSize:         src.HeapSize,
+		Annotations:      src.Annotations,
+		Labels:           src.Labels,
+		Env:              convertEnvTo(src.Env),
+		Resources:        src.Resources,
+		PullPolicy:       corev1.PullPolicy(src.PullPolicy),
+	}, nil
+}
+
+func convertClusterFrom(src v1.AxonOpsCassandraCluster) AxonOpsCassandraCluster {
+	return AxonOpsCassandraCluster{
+		Image:            ContainerImage(src.Image),
+		Replicas:         int(src.Replicas),
+		ClusterName:      src.ClusterName,
+		DC:               src.DC,
+		PersistentVolume: convertVolumeFrom(src.PersistentVolume),
+		JavaOpts:         src.JavaOpts,
+		HeapSize:         src.HeapSize,
+		Annotations:      src.Annotations,
+		Labels:           src.Labels,
+		Env:              convertEnvFrom(src.Env),
+		Resources:        src.Resources,
+		PullPolicy:       string(src.PullPolicy),
+	}
+}
+
+func convertServerTo(src AxonOpsServer) v1.AxonOpsServer {
+	return v1.AxonOpsServer{
+		Image:       v1.ContainerImage(src.Image),
+		Annotations: src.Annotations,
+		Labels:      src.Labels,
+		Env:         convertEnvTo(src.Env),
+		Resources:   src.Resources,
+		PullPolicy:  corev1.PullPolicy(src.PullPolicy),
+	}
+}
+
+func convertServerFrom(src v1.AxonOpsServer) AxonOpsServer {
+	return AxonOpsServer{
+		Image:       ContainerImage(src.Image),
+		Annotations: src.Annotations,
+		Labels:      src.Labels,
+		Env:         convertEnvFrom(src.Env),
+		Resources:   src.Resources,
+		PullPolicy:  string(src.PullPolicy),
+	}
+}
+
+func convertDashboardTo(src AxonOpsDashboard) v1.AxonOpsDashboard {
+	return v1.AxonOpsDashboard{
+		Image:    v1.ContainerImage(src.Image),
+		Replicas: int32(src.Replicas),
+		Ingress: v1.Ingress{
+			Enabled:          src.Ingress.Enabled,
+			ApiVersion:       src.Ingress.ApiVersion,
+			Annotations:      src.Ingress.Annotations,
+			Labels:           src.Ingress.Labels,
+			IngressClassName: src.Ingress.IngressClassName,
+			Hosts:            src.Ingress.Hosts,
+			TLS:              src.Ingress.TLS,
+			Path:             src.Ingress.Path,
+			PathType:         src.Ingress.PathType,
+		},
+		Annotations: src.Annotations,
+		Labels:      src.Labels,
+		Env:         convertEnvTo(src.Env),
+		Resources:   src.Resources,
+		PullPolicy:  corev1.PullPolicy(src.PullPolicy),
+	}
+}
+
+func convertDashboardFrom(src v1.AxonOpsDashboard) AxonOpsDashboard {
+	return AxonOpsDashboard{
+		Image:    ContainerImage(src.Image),
+		Replicas: int(src.Replicas),
+		Ingress: Ingress{
+			Enabled:          src.Ingress.Enabled,
+			ApiVersion:       src.Ingress.ApiVersion,
+			Annotations:      src.Ingress.Annotations,
+			Labels:           src.Ingress.Labels,
+			IngressClassName: src.Ingress.IngressClassName,
+			Hosts:            src.Ingress.Hosts,
+			TLS:              src.Ingress.TLS,
+			Path:             src.Ingress.Path,
+			PathType:         src.Ingress.PathType,
+		},
+		Annotations: src.Annotations,
+		Labels:      src.Labels,
+		Env:         convertEnvFrom(src.Env),
+		Resources:   src.Resources,
+		PullPolicy:  string(src.PullPolicy),
+	}
+}
+
+func convertElasticsearchTo(src Elasticsearch) (v1.Elasticsearch, error) {
+	pv, err := convertVolumeTo(src.PersistentVolume, "spec.axonops.elasticsearch.persistentVolume.size")
+	if err != nil {
+		return v1.Elasticsearch{}, err
+	}
+	return v1.Elasticsearch{
+		Image:            v1.ContainerImage(src.Image),
+		PersistentVolume: pv,
+		JavaOpts:         src.JavaOpts,
+		ClusterName:      src.ClusterName,
+		Env:              convertEnvTo(src.Env),
+		Resources:        src.Resources,
+		PullPolicy:       corev1.PullPolicy(src.PullPolicy),
+	}, nil
+}
+
+func convertElasticsearchFrom(src v1.Elasticsearch) Elasticsearch {
+	return Elasticsearch{
+		Image:            ContainerImage(src.Image),
+		PersistentVolume: convertVolumeFrom(src.PersistentVolume),
+		JavaOpts:         src.JavaOpts,
+		ClusterName:      src.ClusterName,
+		Env:              convertEnvFrom(src.Env),
+		Resources:        src.Resources,
+		PullPolicy:       string(src.PullPolicy),
+	}
+}
+
+func convertVolumeTo(src PersistentVolumeSpec, path string) (v1.PersistentVolumeSpec, error) {
+	dst := v1.PersistentVolumeSpec{StorageClass: src.StorageClass}
+	if src.Size == "" {
+		return dst, nil
+	}
+	size, err := resource.ParseQuantity(src.Size)
+	if err != nil {
+		return dst, fmt.Errorf("%s: %q is not a quantity: %w", path, src.Size, err)
+	}
+	dst.Size = &size
+	return dst, nil
+}
+
+func convertVolumeFrom(src v1.PersistentVolumeSpec) PersistentVolumeSpec {
+	dst := PersistentVolumeSpec{StorageClass: src.StorageClass}
+	if src.Size != nil {
+		dst.Size = src.Size.String()
+	}
+	return dst
+}
+
+func convertEnvTo(src []EnvVars) []corev1.EnvVar {
+	if src == nil {
+		return nil
+	}
+	dst := make([]corev1.EnvVar, 0, len(src))
+	for _, e := range src {
+		dst = append(dst, corev1.EnvVar{Name: e.Name, Value: e.Value})
+	}
+	return dst
+}
+
+// convertEnvFrom keeps the name and value, valueFrom only exists in v1
+func convertEnvFrom(src []corev1.EnvVar) []EnvVars {
+	if src == nil {
+		return nil
+	}
+	dst := make([]EnvVars, 0, len(src))
+	for _, e := range src {
+		dst = append(dst, EnvVars{Name: e.Name, Value: e.Value})
+	}
+	return dst
+}
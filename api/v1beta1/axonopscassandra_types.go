@@ -41,7 +41,8 @@ type Ingress struct {
 	TLS              []networking.IngressTLS `json:"tls,omitempty"`
 	Path             string                  `json:"path,omitempty"`
 	PathType         networking.PathType     `json:"pathType,omitempty"`
-	ServiceName      string                  `json:"serviceName,omitempty"`
+	// Not used, it is dropped when the object is converted to v1
+	ServiceName string `json:"serviceName,omitempty"`
 }
 
 // PersistentVolumeSpec defines the persistent volume specification
@@ -119,6 +120,19 @@ type AxonOpsCluster struct {
 	Elasticsearch Elasticsearch    `json:"elasticsearch,omitempty"`
 }
 
+// DriftPolicy defines what the operator does when a generated object was modified outside of the operator
+// +kubebuilder:validation:Enum=Revert;Report;Ignore
+type DriftPolicy string
+
+const (
+	// DriftPolicyRevert overwrites the modified fields with the rendered configuration
+	DriftPolicyRevert DriftPolicy = "Revert"
+	// DriftPolicyReport keeps the modified fields and reports them in the DriftDetected condition
+	DriftPolicyReport DriftPolicy = "Report"
+	// DriftPolicyIgnore keeps the modified fields and does not look for drift
+	DriftPolicyIgnore DriftPolicy = "Ignore"
+)
+
 // AxonOpsCassandraSpec defines the desired state of AxonOpsCassandra
 type AxonOpsCassandraSpec struct {
 	// Defines the Development cluster composition. The default is to build
@@ -127,17 +141,81 @@ type AxonOpsCassandraSpec struct {
 	// the AxonOps server, the AxonOps dashboard and Elasticsearch as metrics storage
 	Cassandra AxonOpsCassandraCluster `json:"cassandra,omitempty"`
 	AxonOps   AxonOpsCluster          `json:"axonops,omitempty"`
+	// What to do when a generated object is edited by hand, e.g. with kubectl edit.
+	// Revert (the default) overwrites the changes, Report keeps them and lists them
+	// in the DriftDetected condition and Ignore keeps them silently.
+	// +kubebuilder:default=Revert
+	// +optional
+	DriftPolicy DriftPolicy `json:"driftPolicy,omitempty"`
+	// Create every component at once instead of waiting for Elasticsearch before starting
+	// the AxonOps server and for the AxonOps server before starting the dashboard and Cassandra
+	// +optional
+	ParallelStartup bool `json:"parallelStartup,omitempty"`
 }
 
+// AxonOpsCassandraPhase is a high level summary of where the environment is in its lifecycle
+type AxonOpsCassandraPhase string
+
+const (
+	// PhasePending means none of the components have been created yet
+	PhasePending AxonOpsCassandraPhase = "Pending"
+	// PhaseProvisioning means the components are being created and are not all ready yet
+	PhaseProvisioning AxonOpsCassandraPhase = "Provisioning"
+	// PhaseReady means every component is ready
+	PhaseReady AxonOpsCassandraPhase = "Ready"
+	// PhaseDegraded means the environment was ready before but one or more components are not anymore
+	PhaseDegraded AxonOpsCassandraPhase = "Degraded"
+	// PhaseDeleting means the environment is being removed
+	PhaseDeleting AxonOpsCassandraPhase = "Deleting"
+)
+
+// Condition types reported in the AxonOpsCassandra status
+const (
+	// ConditionReady is true when all the other component conditions are true
+	ConditionReady = "Ready"
+	// ConditionElasticsearchReady reports the state of the es-<name> StatefulSet
+	ConditionElasticsearchReady = "ElasticsearchReady"
+	// ConditionAxonServerReady reports the state of the as-<name> StatefulSet
+	ConditionAxonServerReady = "AxonServerReady"
+	// ConditionDashboardReady reports the state of the ds-<name> Deployment
+	ConditionDashboardReady = "DashboardReady"
+	// ConditionMetricsCassandraReady reports the state of the ca-metrics-<name> StatefulSet
+	ConditionMetricsCassandraReady = "MetricsCassandraReady"
+	// ConditionCassandraReady reports the state of the ca-<name> StatefulSet
+	ConditionCassandraReady = "CassandraReady"
+	// ConditionReconciled is false when the last reconcile failed, the reason names the failed step
+	ConditionReconciled = "Reconciled"
+	// ConditionDriftDetected is true when a generated object was modified outside of the operator
+	ConditionDriftDetected = "DriftDetected"
+)
+
 // AxonOpsCassandraStatus defines the observed state of AxonOpsCassandra
 type AxonOpsCassandraStatus struct {
-	Reason     string             `json:"reason"`
-	Message    string             `json:"message"`
-	Conditions []metav1.Condition `json:"conditions"`
+	// Phase summarises the state of all the components
+	// +optional
+	Phase AxonOpsCassandraPhase `json:"phase,omitempty"`
+	// ObservedGeneration is the most recent generation reconciled by the operator
+	// +optional
+	ObservedGeneration int64 `json:"observedGeneration,omitempty"`
+	// BlockedOn is the startup step waiting for the components it depends on to be ready
+	// +optional
+	BlockedOn string `json:"blockedOn,omitempty"`
+	// +optional
+	Reason string `json:"reason,omitempty"`
+	// +optional
+	Message string `json:"message,omitempty"`
+	// +optional
+	// +listType=map
+	// +listMapKey=type
+	Conditions []metav1.Condition `json:"conditions,omitempty"`
 }
 
 //+kubebuilder:object:root=true
 //+kubebuilder:subresource:status
+//+kubebuilder:deprecatedversion:warning="axonops.com/v1beta1 AxonOpsCassandra is deprecated, use axonops.com/v1"
+//+kubebuilder:printcolumn:name="Phase",type="string",JSONPath=".status.phase"
+//+kubebuilder:printcolumn:name="Ready",type="string",JSONPath=".status.conditions[?(@.type=='Ready')].status"
+//+kubebuilder:printcolumn:name="Age",type="date",JSONPath=".metadata.creationTimestamp"
 
 // AxonOpsCassandra is the Schema for the axonopscassandras API
 type AxonOpsCassandra struct {
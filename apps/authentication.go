@@ -0,0 +1,147 @@
+/*
+Copyright 2024 AxonOps Limited
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package apps
+
+import (
+	"crypto/rand"
+	"math/big"
+
+	corev1 "k8s.io/api/core/v1"
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	cassandraaxonopscomv1 "github.com/axonops/axonops-developer-operator/api/v1"
+	"github.com/axonops/axonops-developer-operator/utils"
+)
+
+// Keys of the Secret holding the credentials of the superuser
+const (
+	SuperuserUsernameKey = "username"
+	SuperuserPasswordKey = "password"
+)
+
+// Variables of the Cassandra container holding the credentials of the superuser, cqlsh is
+// run with them so the password never appears in the command of an exec
+const (
+	SuperuserEnv         = "CASSANDRA_SUPERUSER"
+	SuperuserPasswordEnv = "CASSANDRA_SUPERUSER_PASSWORD"
+)
+
+// DefaultSuperuser is the role replacing the default cassandra role
+const DefaultSuperuser = "admin"
+
+const (
+	superuserPasswordLength  = 24
+	superuserPasswordLetters = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789"
+)
+
+// AuthenticationSettings are the cassandra.yaml settings enabling the authentication, they
+// cannot be set in the config field when authentication is enabled
+var AuthenticationSettings = map[string]string{
+	"authenticator": "PasswordAuthenticator",
+	"authorizer":    "CassandraAuthorizer",
+	"role_manager":  "CassandraRoleManager",
+}
+
+// Superuser returns the name of the superuser role of the cluster
+func Superuser(cfg cassandraaxonopscomv1.AxonOpsCassandraCluster) string {
+	return utils.ValueOrDefault(cfg.Authentication.Superuser, DefaultSuperuser)
+}
+
+// CassandraSuperuserSecretName returns the name of the Secret of the superuser credentials
+func CassandraSuperuserSecretName(name string) string {
+	return "ca-" + name + "-superuser"
+}
+
+// GenerateSuperuserSecret renders the Secret ca-<name>-superuser with the superuser and a
+// random password. It is only created when missing so the password is generated once.
+func GenerateSuperuserSecret(name string, namespace string, cfg cassandraaxonopscomv1.AxonOpsCassandraCluster) (*corev1.Secret, error) {
+	password, err := RandomPassword()
+	if err != nil {
+		return nil, err
+	}
+	labels := map[string]string{"app": "ds-" + name, "component": "cassandra"}
+	for k, v := range cfg.Labels {
+		labels[k] = v
+	}
+	return &corev1.Secret{
+		TypeMeta: metav1.TypeMeta{APIVersion: "v1", Kind: "Secret"},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      CassandraSuperuserSecretName(name),
+			Namespace: namespace,
+			Labels:    labels,
+		},
+		Type: corev1.SecretTypeBasicAuth,
+		StringData: map[string]string{
+			SuperuserUsernameKey: Superuser(cfg),
+			SuperuserPasswordKey: password,
+		},
+	}, nil
+}
+
+// RandomPassword returns a password of letters and digits, so it can be quoted in CQL and
+// in a shell without escaping
+func RandomPassword() (string, error) {
+	password := make([]byte, superuserPasswordLength)
+	for i := range password {
+		n, err := rand.Int(rand.Reader, big.NewInt(int64(len(superuserPasswordLetters))))
+		if err != nil {
+			return "", err
+		}
+		password[i] = superuserPasswordLetters[n.Int64()]
+	}
+	return string(password), nil
+}
+
+// withAuthenticationSettings adds the settings enabling the authentication to the
+// cassandra.yaml settings of the spec
+func withAuthenticationSettings(cfg cassandraaxonopscomv1.AxonOpsCassandraCluster) map[string]apiextensionsv1.JSON {
+	if !cfg.Authentication.Enabled {
+		return cfg.Config
+	}
+	config := map[string]apiextensionsv1.JSON{}
+	for k, v := range cfg.Config {
+		config[k] = v
+	}
+	for k, v := range AuthenticationSettings {
+		config[k] = apiextensionsv1.JSON{Raw: []byte(`"` + v + `"`)}
+	}
+	return config
+}
+
+// setSuperuserEnv gives the superuser credentials of the Secret to the Cassandra container
+func setSuperuserEnv(pod *corev1.PodSpec, name string) {
+	if len(pod.Containers) == 0 {
+		return
+	}
+	secret := CassandraSuperuserSecretName(name)
+	container := &pod.Containers[0]
+	for _, v := range []struct{ name, key string }{
+		{SuperuserEnv, SuperuserUsernameKey},
+		{SuperuserPasswordEnv, SuperuserPasswordKey},
+	} {
+		container.Env = append(container.Env, corev1.EnvVar{
+			Name: v.name,
+			ValueFrom: &corev1.EnvVarSource{
+				SecretKeyRef: &corev1.SecretKeySelector{
+					LocalObjectReference: corev1.LocalObjectReference{Name: secret},
+					Key:                  v.key,
+				},
+			},
+		})
+	}
+}
@@ -17,225 +17,97 @@
 package apps
 
 import (
-	"bytes"
 	"fmt"
-	"text/template"
 
-	"github.com/Masterminds/sprig"
-	cassandraaxonopscomv1beta1 "github.com/axonops/axonops-developer-operator/api/v1beta1"
+	cassandraaxonopscomv1 "github.com/axonops/axonops-developer-operator/api/v1"
 	"github.com/axonops/axonops-developer-operator/utils"
 	appsv1 "k8s.io/api/apps/v1"
 	corev1 "k8s.io/api/core/v1"
-	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
-	"k8s.io/apimachinery/pkg/runtime"
-	"k8s.io/apimachinery/pkg/util/yaml"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
 )
 
 const defaultServerImage = "registry.axonops.com/axonops-public/axonops-docker/axon-server"
 const defaultServerTag = "latest"
 
-const ServerServiceTemplate = `
-apiVersion: v1
-kind: Service
-metadata:
-  name: as-{{ .Name }}
-  namespace: {{ .Namespace }}
-  labels:
-    app: as-{{ .Name }}
-    component: axon-server
-  {{- with .Labels }}
-    {{- range $key, $value := . }}
-    {{ $key }}: {{ $value }}
-    {{- end }}
-  {{- end }}
-  {{- with .Annotations }}
-  annotations:
-    {{- range $key, $value := . }}
-    {{ $key }}: {{ $value }}
-    {{- end }}
-  {{- end }}
-spec:
-  selector:
-    app: as-{{ .Name }}
-  ports:
-  - protocol: TCP
-    port: 8080
-    targetPort: 8080
-    name: api
-  - protocol: TCP
-    port: 1888
-    targetPort: 1888
-    name: agent
-  - protocol: TCP
-    port: 6060
-    targetPort: 6060
-    name: metrics
-`
-
-const ServerTemplate = `
-apiVersion: apps/v1
-kind: StatefulSet
-metadata:
-  name: as-{{ .Name }}
-  namespace: {{ .Namespace }}
-  labels:
-    app: as-{{ .Name }}
-    component: axon-server
-  {{- with .Labels }}
-    {{- range $key, $value := . }}
-    {{ $key }}: {{ $value }}
-    {{- end }}
-  {{- end }}
-  {{- with .Annotations }}
-  annotations:
-    {{- range $key, $value := . }}
-    {{ $key }}: {{ $value }}
-    {{- end }}
-  {{- end }}
-spec:
-  serviceName: as-{{ .Name }}
-  replicas: {{ .Replicas }}
-  selector:
-    matchLabels:
-      app: as-{{ .Name }}
-  template:
-    metadata:
-      labels:
-        app: as-{{ .Name }}
-    spec:
-      containers:
-      - name: axon-server
-        image: {{ .Image }}
-        ports:
-        - name: api
-          containerPort: 8080
-        - name: agent
-          containerPort: 1888
-        - name: metrics
-          containerPort: 6060
-        env:
-        - name: ELASTIC_HOSTS
-          value: http://es-{{ .Name }}:9200
-        - name: node.name
-          valueFrom:
-            fieldRef:
-              fieldPath: metadata.name
-        {{- range $env := .Env }}
-        - name: {{ $env.Name }}
-          value: "{{ $env.Value }}"
-        {{- end }}
-        resources:
-          limits:
-            cpu: {{ .CpuLimit }}
-            memory: {{ .MemoryLimit }}
-          requests:
-            cpu: {{ .CpuRequest }}
-            memory: {{ .MemoryRequest }}
-`
-
-type ServerServiceConfig struct {
-	Name        string
-	Namespace   string
-	Labels      map[string]string
-	Annotations map[string]string
-}
-
-type ServerConfig struct {
-	Name          string
-	Namespace     string
-	Replicas      int
-	Image         string
-	Labels        map[string]string
-	Annotations   map[string]string
-	Env           []cassandraaxonopscomv1beta1.EnvVars
-	CpuLimit      string
-	MemoryLimit   string
-	CpuRequest    string
-	MemoryRequest string
+// ServerManagedEnv lists the environment variables the operator sets on the AxonOps server container
+var ServerManagedEnv = []string{
+	"ELASTIC_HOSTS",
+	"node.name",
+	"AXON_SERVER_TLS_MODE",
+	"AXON_SERVER_TLS_CAFILE",
+	"AXON_SERVER_TLS_CERTFILE",
+	"AXON_SERVER_TLS_KEYFILE",
 }
 
-func GenerateServerConfig(cfg cassandraaxonopscomv1beta1.AxonOpsCassandra) (*appsv1.StatefulSet, error) {
-	if cfg.Spec.AxonOps.Server.CassandraMetricsEnabled {
-		cfg.Spec.AxonOps.Server.Env = append(cfg.Spec.AxonOps.Server.Env, cassandraaxonopscomv1beta1.EnvVars{
+// GenerateServerConfig builds the StatefulSet as-<name> of the AxonOps server
+func GenerateServerConfig(cfg cassandraaxonopscomv1.AxonOpsCassandra) (*appsv1.StatefulSet, error) {
+	server := cfg.Spec.AxonOps.Server
+	env := append([]corev1.EnvVar{}, server.Env...)
+	if server.MetricsStore.Enabled {
+		env = append(env, corev1.EnvVar{
 			Name:  "CQL_HOSTS",
 			Value: "ca-metrics-" + cfg.GetName(),
-		})
-		cfg.Spec.AxonOps.Server.Env = append(cfg.Spec.AxonOps.Server.Env, cassandraaxonopscomv1beta1.EnvVars{
+		}, corev1.EnvVar{
 			Name:  "CQL_LOCAL_DC",
-			Value: "axonops1",
+			Value: utils.ValueOrDefault(server.MetricsStore.DC, defaultDC),
 		})
 	}
-	config := ServerConfig{
-		Name:      cfg.GetName(),
-		Namespace: cfg.GetNamespace(),
-		Replicas:  1,
-		Image: fmt.Sprintf("%s:%s",
-			utils.ValueOrDefault(cfg.Spec.AxonOps.Server.Image.Repository, defaultServerImage),
-			utils.ValueOrDefault(cfg.Spec.AxonOps.Server.Image.Tag, defaultServerTag),
-		),
-		Labels:        cfg.Spec.AxonOps.Server.Labels,
-		Annotations:   cfg.Spec.AxonOps.Server.Annotations,
-		Env:           cfg.Spec.AxonOps.Server.Env,
-		CpuRequest:    utils.ValueOrDefault(cfg.Spec.AxonOps.Server.Resources.Requests.Cpu().String(), "250m"),
-		MemoryRequest: utils.ValueOrDefault(cfg.Spec.AxonOps.Server.Resources.Requests.Memory().String(), "256Mi"),
-		CpuLimit:      utils.ValueOrDefault(cfg.Spec.AxonOps.Server.Resources.Limits.Cpu().String(), "1000m"),
-		MemoryLimit:   utils.ValueOrDefault(cfg.Spec.AxonOps.Server.Resources.Limits.Memory().String(), "512Mi"),
-	}
 
-	StatefulSet := &appsv1.StatefulSet{}
-	b := bytes.NewBuffer(nil)
-	tmpl, err := template.New("Server").Funcs(sprig.FuncMap()).Parse(ServerTemplate)
-	if err != nil {
-		return StatefulSet, err
+	name := "as-" + cfg.GetName()
+	selector := map[string]string{"app": name}
+	replicas := int32(1)
+	statefulSet := &appsv1.StatefulSet{
+		TypeMeta: metav1.TypeMeta{APIVersion: "apps/v1", Kind: "StatefulSet"},
+		ObjectMeta: objectMeta(name, cfg.GetNamespace(), server.Annotations,
+			map[string]string{"app": name, "component": "axon-server"}, server.Labels),
+		Spec: appsv1.StatefulSetSpec{
+			ServiceName: name,
+			Replicas:    &replicas,
+			Selector:    &metav1.LabelSelector{MatchLabels: selector},
+			Template: corev1.PodTemplateSpec{
+				ObjectMeta: metav1.ObjectMeta{Labels: mergeLabels(selector)},
+				Spec: corev1.PodSpec{
+					Containers: []corev1.Container{{
+						Name: "axon-server",
+						Image: fmt.Sprintf("%s:%s",
+							utils.ValueOrDefault(server.Image.Repository, defaultServerImage),
+							utils.ValueOrDefault(server.Image.Tag, defaultServerTag),
+						),
+						Ports: []corev1.ContainerPort{
+							{Name: "api", ContainerPort: 8080},
+							{Name: "agent", ContainerPort: 1888},
+							{Name: "metrics", ContainerPort: 6060},
+						},
+						Env: []corev1.EnvVar{
+							{Name: "ELASTIC_HOSTS", Value: "http://es-" + cfg.GetName() + ":9200"},
+							nodeNameEnv(),
+						},
+						Resources: containerResources(server.Resources),
+					}},
+				},
+			},
+		},
 	}
-
-	err = tmpl.Execute(b, config)
-	if err != nil {
-		return StatefulSet, err
-	}
-
-	obj := &unstructured.Unstructured{}
-	es := yaml.NewYAMLOrJSONDecoder(b, 500)
-	if err := es.Decode(obj); err != nil {
-		return StatefulSet, err
-	}
-
-	err = runtime.DefaultUnstructuredConverter.FromUnstructured(obj.Object, StatefulSet)
-	if err != nil {
-		return StatefulSet, err
-	}
-	return StatefulSet, nil
+	appendEnv(&statefulSet.Spec.Template.Spec, env, server.EnvFrom)
+	return statefulSet, nil
 }
 
-func GenerateServerServiceConfig(cfg cassandraaxonopscomv1beta1.AxonOpsCassandra) (*corev1.Service, error) {
-	config := ServerServiceConfig{
-		Name:        cfg.GetName(),
-		Namespace:   cfg.GetNamespace(),
-		Labels:      cfg.Spec.AxonOps.Server.Labels,
-		Annotations: cfg.Spec.AxonOps.Server.Annotations,
-	}
-
-	svc := &corev1.Service{}
-	b := bytes.NewBuffer(nil)
-	tmpl, err := template.New("Server").Funcs(sprig.FuncMap()).Parse(ServerServiceTemplate)
-	if err != nil {
-		return svc, err
-	}
-
-	err = tmpl.Execute(b, config)
-	if err != nil {
-		return svc, err
-	}
-
-	obj := &unstructured.Unstructured{}
-	es := yaml.NewYAMLOrJSONDecoder(b, 500)
-	if err := es.Decode(obj); err != nil {
-		return svc, err
-	}
-
-	err = runtime.DefaultUnstructuredConverter.FromUnstructured(obj.Object, svc)
-	if err != nil {
-		return svc, err
-	}
-	return svc, nil
+// GenerateServerServiceConfig builds the service as-<name> the agents and the dashboard
+// connect to
+func GenerateServerServiceConfig(cfg cassandraaxonopscomv1.AxonOpsCassandra) (*corev1.Service, error) {
+	name := "as-" + cfg.GetName()
+	return &corev1.Service{
+		TypeMeta: metav1.TypeMeta{APIVersion: "v1", Kind: "Service"},
+		ObjectMeta: objectMeta(name, cfg.GetNamespace(), cfg.Spec.AxonOps.Server.Annotations,
+			map[string]string{"app": name, "component": "axon-server"}, cfg.Spec.AxonOps.Server.Labels),
+		Spec: corev1.ServiceSpec{
+			Selector: map[string]string{"app": name},
+			Ports: []corev1.ServicePort{
+				{Protocol: corev1.ProtocolTCP, Port: 8080, TargetPort: intstr.FromInt32(8080), Name: "api"},
+				{Protocol: corev1.ProtocolTCP, Port: 1888, TargetPort: intstr.FromInt32(1888), Name: "agent"},
+				{Protocol: corev1.ProtocolTCP, Port: 6060, TargetPort: intstr.FromInt32(6060), Name: "metrics"},
+			},
+		},
+	}, nil
 }
@@ -17,396 +17,488 @@
 package apps
 
 import (
-	"bytes"
 	"fmt"
-	"text/template"
+	"slices"
+	"strings"
 
-	"github.com/Masterminds/sprig"
-	cassandraaxonopscomv1beta1 "github.com/axonops/axonops-developer-operator/api/v1beta1"
+	cassandraaxonopscomv1 "github.com/axonops/axonops-developer-operator/api/v1"
 	"github.com/axonops/axonops-developer-operator/utils"
 	appsv1 "k8s.io/api/apps/v1"
 	corev1 "k8s.io/api/core/v1"
-	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
-	"k8s.io/apimachinery/pkg/runtime"
-	"k8s.io/apimachinery/pkg/util/yaml"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
 )
 
 const defaultCassandraImage = "ghcr.io/axonops/cassandra"
 const defaultCassandraTag = "5.0.2"
 
-const cassandraHeadlessServiceTemplate = `
-apiVersion: v1
-kind: Service
-metadata:
-  name: ca-{{ .Name }}-headless
-  namespace: {{ .Namespace }}
-  labels:
-    app: ds-{{ .Name }}
-    component: cassandra
-  {{- with .Labels }}
-    {{- range $key, $value := . }}
-    {{ $key }}: {{ $value }}
-    {{- end }}
-  {{- end }}
-  {{- with .Annotations }}
-  annotations:
-    {{- range $key, $value := . }}
-    {{ $key }}: {{ $value }}
-    {{- end }}
-  {{- end }}
-spec:
-  publishNotReadyAddresses: true
-  clusterIP: None
-  selector:
-    app: ca-{{ .Name }}
-  ports:
-    - name: intra
-      port: 7000
-      targetPort: intra
-    - name: tls
-      port: 7001
-      targetPort: tls
-    - name: jmx
-      port: 7199
-      targetPort: jmx
-    - name: cql
-      port: 9042
-      targetPort: cql
-`
-const cassandraServiceTemplate = `
-apiVersion: v1
-kind: Service
-metadata:
-  name: ca-{{ .Name }}
-  namespace: {{ .Namespace }}
-  labels:
-    app: ds-{{ .Name }}
-    component: cassandra
-  {{- with .Labels }}
-    {{- range $key, $value := . }}
-    {{ $key }}: {{ $value }}
-    {{- end }}
-  {{- end }}
-  {{- with .Annotations }}
-  annotations:
-    {{- range $key, $value := . }}
-    {{ $key }}: {{ $value }}
-    {{- end }}
-  {{- end }}
-spec:
-  selector:
-    app: ca-{{ .Name }}
-  ports:
-    - name: intra
-      port: 7000
-      targetPort: intra
-    - name: tls
-      port: 7001
-      targetPort: tls
-    - name: jmx
-      port: 7199
-      targetPort: jmx
-    - name: cql
-      port: 9042
-      targetPort: cql
-`
-
-const cassandraTemplate = `
-apiVersion: apps/v1
-kind: StatefulSet
-metadata:
-  name: ca-{{ .Name }}
-  namespace: {{ .Namespace }}
-  labels:
-    app: ds-{{ .Name }}
-    component: cassandra
-  {{- with .Labels }}
-    {{- range $key, $value := . }}
-    {{ $key }}: {{ $value }}
-    {{- end }}
-  {{- end }}
-  {{- with .Annotations }}
-  annotations:
-    {{- range $key, $value := . }}
-    {{ $key }}: {{ $value }}
-    {{- end }}
-  {{- end }}
-spec:
-  serviceName: ca-{{ .Name }}
-  replicas: {{ .Replicas }}
-  selector:
-    matchLabels:
-      app: ca-{{ .Name }}
-  template:
-    metadata:
-      labels:
-        app: ca-{{ .Name }}
-    spec:
-      containers:
-      - name: cassandra
-        image: {{ .Image }}
-        imagePullPolicy: {{ .PullPolicy }}
-        ports:
-        - containerPort: 9042
-          name: cql
-        - containerPort: 7199
-          name: jmx
-        - containerPort: 7000
-          name: intra
-        - containerPort: 7001
-          name: tls
-        env:
-        - name: CASSANDRA_CLUSTER_NAME
-          value: {{ .ClusterName }}
-        - name: CASSANDRA_SEEDS
-          value: ca-{{ .Name }}-0.ca-{{ .Name }}.{{ .Namespace }}.svc.cluster.local
-        - name: CASSANDRA_ENDPOINT_SNITCH
-          value: GossipingPropertyFileSnitch
-        - name: CASSANDRA_DC
-          value: {{ .DC }}
-        - name: CASSANDRA_RACK
-          value: rack1
-        - name: CASSANDRA_BROADCAST_RPC_ADDRESS
-          value: 127.0.0.1
-        - name: CASSANDRA_NATIVE_TRANSPORT_PORT
-          value: "9042"
-        - name: MAX_HEAP_SIZE
-          value: {{ .HeapSize }}
-        - name: HEAP_NEWSIZE
-          value: 50m
-        - name: AXON_AGENT_SERVER_HOST
-          value: as-{{ .Name }}
-        - name: AXON_AGENT_SERVER_PORT
-          value: "1888"
-        - name: AXON_AGENT_ORG
-          value: developer
-        - name: AXON_AGENT_TLS_MODE
-          value: none
-        - name: AXON_AGENT_LOG_OUTPUT
-          value: file
-        - name: node.name
-          valueFrom:
-            fieldRef:
-              fieldPath: metadata.name
-        - name: ES_JAVA_OPTS
-          value: "{{ .JavaOpts }}"
-        {{- range $env := .Env }}
-        - name: {{ $env.Name }}
-          value: "{{ $env.Value }}"
-        {{- end }}
-        resources:
-          limits:
-            cpu: {{ .CpuLimit }}
-            memory: {{ .MemoryLimit }}
-          requests:
-            cpu: {{ .CpuRequest }}
-            memory: {{ .MemoryRequest }}
-        livenessProbe:
-          exec:
-            command:
-              - /bin/bash
-              - -ec
-              - |
-                nodetool info | grep "Native Transport active: true"
-          initialDelaySeconds: 60
-          periodSeconds: 30
-          timeoutSeconds: 30
-          successThreshold: 1
-          failureThreshold: 5
-        readinessProbe:
-          exec:
-            command:
-              - /bin/bash
-              - -ec
-              - |
-                nodetool status | grep -E "^UN\\s+${POD_IP}"
-          initialDelaySeconds: 60
-          periodSeconds: 30
-          timeoutSeconds: 30
-          successThreshold: 1
-          failureThreshold: 5
-        startupProbe:
-          exec:
-            command:
-              - /bin/bash
-              - -ec
-              - |
-                nodetool status | grep -E "^UN\\s+${POD_IP}"
-          initialDelaySeconds: 60
-          periodSeconds: 30
-          timeoutSeconds: 30
-          successThreshold: 1
-          failureThreshold: 5
-        lifecycle:
-          preStop:
-            exec:
-              command:
-                - bash
-                - -ec
-                {{- if ne .StorageSize "" }}
-                - nodetool drain
-                {{- else }}
-                - nodetool decommission
-                {{- end }}
-{{- if ne .StorageSize "" }}
-        volumeMounts:
-        - name: data
-          mountPath: /var/lib/cassandra
-  volumeClaimTemplates:
-  - metadata:
-      name: data
-    spec:
-      accessModes: ["ReadWriteOnce"]
-      {{- if ne .StorageClass "" }}
-      storageClassName: {{ .StorageClass }}
-      {{- end }}
-      resources:
-        requests:
-          storage: {{ .StorageSize }}
-{{- end }}
-`
-
-type CassandraServiceConfig struct {
-	Name        string
-	Namespace   string
-	Labels      map[string]string
-	Annotations map[string]string
+// CassandraManagedEnv lists the environment variables the operator sets on the Cassandra container.
+// They are rejected in the env field as the rendered StatefulSet would define them twice.
+var CassandraManagedEnv = []string{
+	"CASSANDRA_CLUSTER_NAME",
+	"CASSANDRA_SEEDS",
+	"CASSANDRA_ENDPOINT_SNITCH",
+	"CASSANDRA_DC",
+	"CASSANDRA_RACK",
+	"CASSANDRA_BROADCAST_RPC_ADDRESS",
+	"CASSANDRA_NATIVE_TRANSPORT_PORT",
+	"MAX_HEAP_SIZE",
+	"HEAP_NEWSIZE",
+	"AXON_AGENT_SERVER_HOST",
+	"AXON_AGENT_SERVER_PORT",
+	"AXON_AGENT_ORG",
+	"AXON_AGENT_TLS_MODE",
+	"AXON_AGENT_TLS_CAFILE",
+	"AXON_AGENT_TLS_CERTFILE",
+	"AXON_AGENT_TLS_KEYFILE",
+	"AXON_AGENT_LOG_OUTPUT",
+	"node.name",
+	SuperuserEnv,
+	SuperuserPasswordEnv,
 }
 
-type CassandraConfig struct {
-	Name          string
-	Namespace     string
-	Replicas      int
-	Image         string
-	ClusterName   string
-	DC            string
-	JavaOpts      string
-	HeapSize      string
-	StorageSize   string
-	StorageClass  string
-	Labels        map[string]string
-	Annotations   map[string]string
-	Env           []cassandraaxonopscomv1beta1.EnvVars
-	CpuLimit      string
-	MemoryLimit   string
-	CpuRequest    string
-	MemoryRequest string
-	PullPolicy    string
+// cassandraProbeCommand checks the node is up and normal in the ring
+const cassandraProbeCommand = "nodetool status | grep -E \"^UN\\\\s+${POD_IP}\"\n"
+
+// CassandraCluster returns the Cassandra cluster of cr. The environments with a metrics store
+// used to run their cluster in the axonops1 data center without it being set in the spec, the
+// ones stored before the defaults were written keep it.
+func CassandraCluster(cr cassandraaxonopscomv1.AxonOpsCassandra) cassandraaxonopscomv1.AxonOpsCassandraCluster {
+	cluster := cr.Spec.Cassandra
+	if cr.Spec.AxonOps.Server.MetricsStore.Enabled {
+		setDefault(&cluster.DC, defaultMetricsEnabledDC)
+	}
+	return cluster
 }
 
-func GenerateCassandraConfig(name string, namespace string, storageSize string, storageClass string, cfg cassandraaxonopscomv1beta1.AxonOpsCassandraCluster) (*appsv1.StatefulSet, error) {
-	config := CassandraConfig{
-		Name:      name,
-		Namespace: namespace,
-		Replicas:  utils.ValueOrDefaultInt(cfg.Replicas, 1),
-		Image: fmt.Sprintf("%s:%s",
-			utils.ValueOrDefault(cfg.Image.Repository, defaultCassandraImage),
-			utils.ValueOrDefault(cfg.Image.Tag, defaultCassandraTag),
-		),
-		ClusterName:   utils.ValueOrDefault(cfg.ClusterName, name),
-		DC:            utils.ValueOrDefault(cfg.DC, "dc1"),
-		JavaOpts:      utils.ValueOrDefault(cfg.JavaOpts, "-Xms512m -Xmx512m"),
-		StorageSize:   utils.ValueOrDefault(storageSize, ""),
-		StorageClass:  utils.ValueOrDefault(storageClass, ""),
-		HeapSize:      utils.ValueOrDefault(cfg.HeapSize, "512M"),
-		Labels:        cfg.Labels,
-		Annotations:   cfg.Annotations,
-		Env:           cfg.Env,
-		CpuRequest:    utils.ValueOrDefault(cfg.Resources.Requests.Cpu().String(), "500m"),
-		MemoryRequest: utils.ValueOrDefault(cfg.Resources.Requests.Memory().String(), "1Gi"),
-		CpuLimit:      utils.ValueOrDefault(cfg.Resources.Limits.Cpu().String(), "1000m"),
-		MemoryLimit:   utils.ValueOrDefault(cfg.Resources.Limits.Memory().String(), "2Gi"),
-		PullPolicy:    utils.ValueOrDefault(cfg.PullPolicy, "IfNotPresent"),
-	}
-
-	statefulSet := &appsv1.StatefulSet{}
-	b := bytes.NewBuffer(nil)
-	tmpl, err := template.New("cassandra").Funcs(sprig.FuncMap()).Parse(cassandraTemplate)
-	if err != nil {
-		return statefulSet, err
+// MetricsStoreCluster returns the Cassandra cluster definition of the metrics store so it
+// is built by the same generator as the main cluster
+func MetricsStoreCluster(store cassandraaxonopscomv1.MetricsStore) cassandraaxonopscomv1.AxonOpsCassandraCluster {
+	return cassandraaxonopscomv1.AxonOpsCassandraCluster{
+		Image:            store.Image,
+		Replicas:         store.Replicas,
+		ClusterName:      store.ClusterName,
+		DC:               store.DC,
+		PersistentVolume: store.PersistentVolume,
+		JavaOpts:         store.JavaOpts,
+		HeapSize:         store.HeapSize,
+		Annotations:      store.Annotations,
+		Labels:           store.Labels,
+		Env:              store.Env,
+		EnvFrom:          store.EnvFrom,
+		Resources:        store.Resources,
+		PullPolicy:       store.PullPolicy,
 	}
+}
 
-	err = tmpl.Execute(b, config)
-	if err != nil {
-		return statefulSet, err
+// CassandraRack is one of the StatefulSets making up a Cassandra cluster
+type CassandraRack struct {
+	// Name is the rack of the nodes in GossipingPropertyFileSnitch
+	Name string
+	// DC is the datacenter of the nodes in GossipingPropertyFileSnitch
+	DC string
+	// StatefulSet is the name of the StatefulSet running the nodes of the rack
+	StatefulSet string
+	Replicas    int32
+	// TopologyLabels are added to the pods of the configured datacenters and racks so the
+	// StatefulSet selectors do not overlap
+	TopologyLabels map[string]string
+	NodeSelector   map[string]string
+	Zone           string
+	// Persistent is false when the data of the nodes lives on the container filesystem and is
+	// lost with the pod
+	Persistent bool
+}
+
+// DatacenterCluster returns the configuration of the nodes of one datacenter, the fields set
+// on the datacenter replace the ones of the cluster
+func DatacenterCluster(cfg cassandraaxonopscomv1.AxonOpsCassandraCluster, dc cassandraaxonopscomv1.Datacenter) cassandraaxonopscomv1.AxonOpsCassandraCluster {
+	cfg.DC = dc.Name
+	cfg.Replicas = dc.Replicas
+	cfg.Racks = dc.Racks
+	cfg.Datacenters = nil
+	if dc.PersistentVolume.Size != nil || dc.PersistentVolume.StorageClass != "" {
+		cfg.PersistentVolume = dc.PersistentVolume
+	}
+	if dc.HeapSize != "" {
+		cfg.HeapSize = dc.HeapSize
 	}
+	if len(dc.Resources.Limits) > 0 || len(dc.Resources.Requests) > 0 {
+		cfg.Resources = dc.Resources
+	}
+	return cfg
+}
 
-	obj := &unstructured.Unstructured{}
-	es := yaml.NewYAMLOrJSONDecoder(b, 500)
-	if err := es.Decode(obj); err != nil {
-		return statefulSet, err
+// CassandraRacks returns the StatefulSets of the cluster ca-<name>. A cluster without racks
+// is a single StatefulSet ca-<name> in rack1, the configured racks are ca-<name>-<rack>.
+// The StatefulSets of a datacenter are named the same way after ca-<name>-<dc>.
+func CassandraRacks(name string, cfg cassandraaxonopscomv1.AxonOpsCassandraCluster) []CassandraRack {
+	if len(cfg.Datacenters) == 0 {
+		return clusterRacks("ca-"+name, false, cfg)
+	}
+	racks := []CassandraRack{}
+	for _, dc := range cfg.Datacenters {
+		racks = append(racks, clusterRacks("ca-"+name+"-"+dc.Name, true, DatacenterCluster(cfg, dc))...)
 	}
+	return racks
+}
 
-	err = runtime.DefaultUnstructuredConverter.FromUnstructured(obj.Object, statefulSet)
-	if err != nil {
-		return statefulSet, err
+func clusterRacks(prefix string, labelDC bool, cfg cassandraaxonopscomv1.AxonOpsCassandraCluster) []CassandraRack {
+	dc := utils.ValueOrDefault(cfg.DC, defaultDC)
+	if len(cfg.Racks) == 0 {
+		rack := CassandraRack{
+			Name:        defaultRack,
+			DC:          dc,
+			StatefulSet: prefix,
+			Replicas:    int32(utils.ValueOrDefaultInt(int(cfg.Replicas), defaultCassandraReplicas)),
+			Persistent:  cfg.PersistentVolume.Size != nil,
+		}
+		if labelDC {
+			rack.TopologyLabels = map[string]string{"dc": dc}
+		}
+		return []CassandraRack{rack}
 	}
-	return statefulSet, nil
+	racks := make([]CassandraRack, 0, len(cfg.Racks))
+	for _, r := range cfg.Racks {
+		labels := map[string]string{"rack": r.Name}
+		if labelDC {
+			labels["dc"] = dc
+		}
+		racks = append(racks, CassandraRack{
+			Name:           r.Name,
+			DC:             dc,
+			StatefulSet:    prefix + "-" + r.Name,
+			Replicas:       int32(utils.ValueOrDefaultInt(int(r.Replicas), defaultCassandraReplicas)),
+			TopologyLabels: labels,
+			NodeSelector:   r.NodeSelector,
+			Zone:           r.Zone,
+			Persistent:     cfg.PersistentVolume.Size != nil,
+		})
+	}
+	return racks
+}
+
+// CassandraSeedsKey is the key of the seed list in the seeds ConfigMap
+const CassandraSeedsKey = "seeds"
+
+// CassandraSeedsConfigMapName returns the name of the ConfigMap holding the seeds of the cluster ca-<name>
+func CassandraSeedsConfigMapName(name string) string {
+	return "ca-" + name + "-seeds"
 }
 
-func GenerateCassandraServiceConfig(name string, namespace string, labels map[string]string, annonations map[string]string) (*corev1.Service, error) {
-	config := CassandraServiceConfig{
-		Name:        name,
-		Namespace:   namespace,
-		Labels:      labels,
-		Annotations: annonations,
+// CassandraSeeds picks the seeds of the cluster ca-<name> among the nodes of racks. Cassandra
+// never bootstraps a seed, so only the nodes in joined are added, up to the seedsPerDC of cfg
+// in every datacenter taking the next ordinal of each rack in turn. The seeds of the previous list are kept while their node is part
+// of the topology, which leaves the list untouched when nodes are added. An empty cluster starts
+// from its first node alone. The names resolve through the headless service, which publishes
+// the nodes before they are ready.
+func CassandraSeeds(name string, namespace string, cfg cassandraaxonopscomv1.AxonOpsCassandraCluster, racks []CassandraRack, previous string, joined map[string]bool) string {
+	seedsPerDC := utils.ValueOrDefaultInt(int(cfg.SeedsPerDC), defaultSeedsPerDC)
+	datacenters := []string{}
+	byDC := map[string][]CassandraRack{}
+	for _, r := range racks {
+		if _, ok := byDC[r.DC]; !ok {
+			datacenters = append(datacenters, r.DC)
+		}
+		byDC[r.DC] = append(byDC[r.DC], r)
+	}
+	address := func(node string) string {
+		return fmt.Sprintf("%s.ca-%s-headless.%s.svc.cluster.local", node, name, namespace)
+	}
+	kept := map[string]bool{}
+	for _, seed := range strings.Split(previous, ",") {
+		kept[seed] = true
 	}
 
-	svc := &corev1.Service{}
-	b := bytes.NewBuffer(nil)
-	tmpl, err := template.New("cassandra").Funcs(sprig.FuncMap()).Parse(cassandraServiceTemplate)
-	if err != nil {
-		return svc, err
+	seeds := []string{}
+	first := ""
+	for _, dc := range datacenters {
+		nodes := []string{}
+		for ordinal := int32(0); ; ordinal++ {
+			added := false
+			for _, r := range byDC[dc] {
+				if ordinal < r.Replicas {
+					nodes = append(nodes, fmt.Sprintf("%s-%d", r.StatefulSet, ordinal))
+					added = true
+				}
+			}
+			if !added {
+				break
+			}
+		}
+		if first == "" && len(nodes) > 0 {
+			first = nodes[0]
+		}
+
+		count := 0
+		for _, pass := range []func(string) bool{
+			func(node string) bool { return kept[address(node)] },
+			func(node string) bool { return joined[node] && !kept[address(node)] },
+		} {
+			for _, node := range nodes {
+				if count < seedsPerDC && pass(node) {
+					seeds = append(seeds, address(node))
+					count++
+				}
+			}
+		}
 	}
+	if len(seeds) == 0 && first != "" {
+		seeds = append(seeds, address(first))
+	}
+	return strings.Join(seeds, ",")
+}
 
-	err = tmpl.Execute(b, config)
-	if err != nil {
-		return svc, err
+// GenerateCassandraSeedsConfigMap builds the ConfigMap the Cassandra containers read their seeds
+// from when they start, so the list changes without restarting the nodes
+func GenerateCassandraSeedsConfigMap(name string, namespace string, cfg cassandraaxonopscomv1.AxonOpsCassandraCluster, seeds string) *corev1.ConfigMap {
+	return &corev1.ConfigMap{
+		TypeMeta: metav1.TypeMeta{APIVersion: "v1", Kind: "ConfigMap"},
+		ObjectMeta: objectMeta(CassandraSeedsConfigMapName(name), namespace, cfg.Annotations,
+			map[string]string{"app": "ds-" + name, "component": "cassandra"}, cfg.Labels),
+		Data: map[string]string{CassandraSeedsKey: seeds},
 	}
+}
 
-	obj := &unstructured.Unstructured{}
-	es := yaml.NewYAMLOrJSONDecoder(b, 500)
-	if err := es.Decode(obj); err != nil {
-		return svc, err
+// GenerateCassandraConfig renders the StatefulSet of one rack of the cluster ca-<name>
+func GenerateCassandraConfig(name string, namespace string, volume cassandraaxonopscomv1.PersistentVolumeSpec, cfg cassandraaxonopscomv1.AxonOpsCassandraCluster, rack CassandraRack) (*appsv1.StatefulSet, error) {
+	for _, dc := range cfg.Datacenters {
+		if dc.Name == rack.DC {
+			cfg = DatacenterCluster(cfg, dc)
+			volume = cfg.PersistentVolume
+		}
 	}
 
-	err = runtime.DefaultUnstructuredConverter.FromUnstructured(obj.Object, svc)
-	if err != nil {
-		return svc, err
+	env := []corev1.EnvVar{
+		{Name: "CASSANDRA_CLUSTER_NAME", Value: utils.ValueOrDefault(cfg.ClusterName, name)},
+		{Name: "CASSANDRA_SEEDS", ValueFrom: &corev1.EnvVarSource{
+			ConfigMapKeyRef: &corev1.ConfigMapKeySelector{
+				LocalObjectReference: corev1.LocalObjectReference{Name: CassandraSeedsConfigMapName(name)},
+				Key:                  CassandraSeedsKey,
+			},
+		}},
+		{Name: "CASSANDRA_ENDPOINT_SNITCH", Value: "GossipingPropertyFileSnitch"},
+		{Name: "CASSANDRA_DC", Value: utils.ValueOrDefault(cfg.DC, defaultDC)},
+		{Name: "CASSANDRA_RACK", Value: rack.Name},
+		{Name: "CASSANDRA_BROADCAST_RPC_ADDRESS", Value: "127.0.0.1"},
+		{Name: "CASSANDRA_NATIVE_TRANSPORT_PORT", Value: "9042"},
 	}
-	return svc, nil
-}
+	if cfg.JVM == nil {
+		env = append(env,
+			corev1.EnvVar{Name: "MAX_HEAP_SIZE", Value: utils.ValueOrDefault(cfg.HeapSize, defaultHeapSize)},
+			corev1.EnvVar{Name: "HEAP_NEWSIZE", Value: heapNewSize(cfg)},
+		)
+	}
+	env = append(env,
+		corev1.EnvVar{Name: "AXON_AGENT_SERVER_HOST", Value: "as-" + name},
+		corev1.EnvVar{Name: "AXON_AGENT_SERVER_PORT", Value: "1888"},
+		corev1.EnvVar{Name: "AXON_AGENT_ORG", Value: "developer"},
+		corev1.EnvVar{Name: "AXON_AGENT_TLS_MODE", Value: "none"},
+		corev1.EnvVar{Name: "AXON_AGENT_LOG_OUTPUT", Value: "file"},
+		nodeNameEnv(),
+	)
 
-/* not used right now */
-func GenerateCassandraHeadlessServiceConfig(cfg cassandraaxonopscomv1beta1.AxonOpsCassandra) (*corev1.Service, error) {
-	config := CassandraServiceConfig{
-		Name:        cfg.GetName(),
-		Namespace:   cfg.GetNamespace(),
-		Labels:      cfg.Labels,
-		Annotations: cfg.Annotations,
+	// the nodes leave the ring when they are removed unless their data is kept, the nodes the
+	// operator already decommissioned are left as they are
+	preStop := "nodetool netstats | grep -q 'Mode: DECOMMISSIONED' || nodetool decommission"
+	if volume.Size != nil {
+		preStop = "nodetool drain"
 	}
 
-	svc := &corev1.Service{}
-	b := bytes.NewBuffer(nil)
-	tmpl, err := template.New("cassandra").Funcs(sprig.FuncMap()).Parse(cassandraHeadlessServiceTemplate)
+	replicas := rack.Replicas
+	selector := mergeLabels(map[string]string{"app": "ca-" + name}, rack.TopologyLabels)
+	statefulSet := &appsv1.StatefulSet{
+		TypeMeta: metav1.TypeMeta{APIVersion: "apps/v1", Kind: "StatefulSet"},
+		ObjectMeta: objectMeta(rack.StatefulSet, namespace, cfg.Annotations,
+			map[string]string{"app": "ds-" + name, "component": "cassandra"}, rack.TopologyLabels, cfg.Labels),
+		Spec: appsv1.StatefulSetSpec{
+			ServiceName: "ca-" + name + "-headless",
+			Replicas:    &replicas,
+			Selector:    &metav1.LabelSelector{MatchLabels: selector},
+			Template: corev1.PodTemplateSpec{
+				ObjectMeta: metav1.ObjectMeta{Labels: mergeLabels(selector)},
+				Spec: corev1.PodSpec{
+					Containers: []corev1.Container{{
+						Name:            "cassandra",
+						Image:           CassandraImage(cfg),
+						ImagePullPolicy: corev1.PullPolicy(utils.ValueOrDefault(string(cfg.PullPolicy), defaultPullPolicy)),
+						Ports: []corev1.ContainerPort{
+							{ContainerPort: 9042, Name: "cql"},
+							{ContainerPort: 7199, Name: "jmx"},
+							{ContainerPort: 7000, Name: "intra"},
+							{ContainerPort: 7001, Name: "tls"},
+						},
+						Env:            env,
+						Resources:      containerResources(cfg.Resources),
+						LivenessProbe:  cassandraProbe("nodetool info | grep \"Native Transport active: true\"\n"),
+						ReadinessProbe: cassandraProbe(cassandraProbeCommand),
+						StartupProbe:   cassandraProbe(cassandraProbeCommand),
+						Lifecycle: &corev1.Lifecycle{
+							PreStop: &corev1.LifecycleHandler{
+								Exec: &corev1.ExecAction{Command: []string{"bash", "-ec", preStop}},
+							},
+						},
+						VolumeMounts: dataVolumeMounts(volume, "/var/lib/cassandra"),
+					}},
+				},
+			},
+			VolumeClaimTemplates: dataVolumeClaims(volume),
+		},
+	}
+	appendEnv(&statefulSet.Spec.Template.Spec, cfg.Env, cfg.EnvFrom)
+	setRackPlacement(&statefulSet.Spec.Template.Spec, rack)
+	if cfg.Authentication.Enabled {
+		setSuperuserEnv(&statefulSet.Spec.Template.Spec, name)
+	}
+	configMap, err := GenerateCassandraConfigMap(name, namespace, cfg)
 	if err != nil {
-		return svc, err
+		return statefulSet, err
+	}
+	if configMap != nil {
+		mountCassandraConfig(&statefulSet.Spec.Template.Spec, configMap, jvmHeapOptions(cfg))
+	}
+	if TLSRequired(cfg) {
+		mountTLS(&statefulSet.Spec.Template.Spec, name)
+	}
+	if cfg.TLS.Agent {
+		setAgentTLS(&statefulSet.Spec.Template.Spec)
 	}
+	if err := setConfigHash(&statefulSet.Spec.Template, configMap); err != nil {
+		return statefulSet, err
+	}
+	return statefulSet, nil
+}
 
-	err = tmpl.Execute(b, config)
+// configHashEnv lists the environment variables of the Cassandra container that need a restart
+// of the nodes when they change. The seeds are left out, a node only reads them to join the ring.
+var configHashEnv = []string{
+	"CASSANDRA_CLUSTER_NAME",
+	"CASSANDRA_ENDPOINT_SNITCH",
+	"CASSANDRA_DC",
+	"CASSANDRA_RACK",
+	"CASSANDRA_BROADCAST_RPC_ADDRESS",
+	"CASSANDRA_NATIVE_TRANSPORT_PORT",
+	"MAX_HEAP_SIZE",
+	"HEAP_NEWSIZE",
+	"AXON_AGENT_SERVER_HOST",
+	"AXON_AGENT_SERVER_PORT",
+	"AXON_AGENT_ORG",
+	"AXON_AGENT_TLS_MODE",
+	"AXON_AGENT_TLS_CAFILE",
+	"AXON_AGENT_TLS_CERTFILE",
+	"AXON_AGENT_TLS_KEYFILE",
+}
+
+// setConfigHash annotates the pod template with the hash of the cassandra.yaml settings and
+// of the environment variables of configHashEnv, so the nodes are restarted when they change
+func setConfigHash(template *corev1.PodTemplateSpec, configMap *corev1.ConfigMap) error {
+	env := []corev1.EnvVar{}
+	for _, c := range template.Spec.Containers {
+		if c.Name != "cassandra" {
+			continue
+		}
+		for _, e := range c.Env {
+			if slices.Contains(configHashEnv, e.Name) {
+				env = append(env, e)
+			}
+		}
+	}
+	var config interface{} = env
+	if configMap != nil {
+		config = []interface{}{env, configMap.Data}
+	}
+	hash, err := utils.HashObject(config)
 	if err != nil {
-		return svc, err
+		return err
+	}
+	if template.Annotations == nil {
+		template.Annotations = map[string]string{}
 	}
+	template.Annotations[cassandraaxonopscomv1.ConfigHashAnnotation] = hash
+	return nil
+}
+
+// CassandraImage returns the image reference the Cassandra nodes of a cluster run
+func CassandraImage(cfg cassandraaxonopscomv1.AxonOpsCassandraCluster) string {
+	return fmt.Sprintf("%s:%s",
+		utils.ValueOrDefault(cfg.Image.Repository, defaultCassandraImage),
+		utils.ValueOrDefault(cfg.Image.Tag, defaultCassandraTag),
+	)
+}
 
-	obj := &unstructured.Unstructured{}
-	es := yaml.NewYAMLOrJSONDecoder(b, 500)
-	if err := es.Decode(obj); err != nil {
-		return svc, err
+// setRackPlacement schedules the pods of a rack on the nodes matching its node selector and zone
+func setRackPlacement(pod *corev1.PodSpec, rack CassandraRack) {
+	if len(rack.NodeSelector) > 0 {
+		pod.NodeSelector = map[string]string{}
+		for k, v := range rack.NodeSelector {
+			pod.NodeSelector[k] = v
+		}
+	}
+	if rack.Zone != "" {
+		pod.Affinity = &corev1.Affinity{
+			NodeAffinity: &corev1.NodeAffinity{
+				RequiredDuringSchedulingIgnoredDuringExecution: &corev1.NodeSelector{
+					NodeSelectorTerms: []corev1.NodeSelectorTerm{{
+						MatchExpressions: []corev1.NodeSelectorRequirement{{
+							Key:      corev1.LabelTopologyZone,
+							Operator: corev1.NodeSelectorOpIn,
+							Values:   []string{rack.Zone},
+						}},
+					}},
+				},
+			},
+		}
 	}
+}
 
-	err = runtime.DefaultUnstructuredConverter.FromUnstructured(obj.Object, svc)
-	if err != nil {
-		return svc, err
+// cassandraProbe runs the bash script on the Cassandra container
+func cassandraProbe(script string) *corev1.Probe {
+	return &corev1.Probe{
+		ProbeHandler: corev1.ProbeHandler{
+			Exec: &corev1.ExecAction{Command: []string{"/bin/bash", "-ec", script}},
+		},
+		InitialDelaySeconds: 60,
+		PeriodSeconds:       30,
+		TimeoutSeconds:      30,
+		SuccessThreshold:    1,
+		FailureThreshold:    5,
+	}
+}
+
+// GenerateCassandraServiceConfig builds the service ca-<name> the clients connect to
+func GenerateCassandraServiceConfig(name string, namespace string, labels map[string]string, annotations map[string]string) (*corev1.Service, error) {
+	return &corev1.Service{
+		TypeMeta: metav1.TypeMeta{APIVersion: "v1", Kind: "Service"},
+		ObjectMeta: objectMeta("ca-"+name, namespace, annotations,
+			map[string]string{"app": "ds-" + name, "component": "cassandra"}, labels),
+		Spec: corev1.ServiceSpec{
+			Selector: map[string]string{"app": "ca-" + name},
+			Ports:    cassandraServicePorts(),
+		},
+	}, nil
+}
+
+// GenerateCassandraHeadlessServiceConfig builds the headless service ca-<name>-headless
+// giving a DNS name to every node of the StatefulSets, the seeds are addressed through it
+func GenerateCassandraHeadlessServiceConfig(name string, namespace string, labels map[string]string, annotations map[string]string) (*corev1.Service, error) {
+	return &corev1.Service{
+		TypeMeta: metav1.TypeMeta{APIVersion: "v1", Kind: "Service"},
+		ObjectMeta: objectMeta("ca-"+name+"-headless", namespace, annotations,
+			map[string]string{"app": "ds-" + name, "component": "cassandra"}, labels),
+		Spec: corev1.ServiceSpec{
+			PublishNotReadyAddresses: true,
+			ClusterIP:                corev1.ClusterIPNone,
+			Selector:                 map[string]string{"app": "ca-" + name},
+			Ports:                    cassandraServicePorts(),
+		},
+	}, nil
+}
+
+func cassandraServicePorts() []corev1.ServicePort {
+	return []corev1.ServicePort{
+		{Name: "intra", Port: 7000, TargetPort: intstr.FromString("intra")},
+		{Name: "tls", Port: 7001, TargetPort: intstr.FromString("tls")},
+		{Name: "jmx", Port: 7199, TargetPort: intstr.FromString("jmx")},
+		{Name: "cql", Port: 9042, TargetPort: intstr.FromString("cql")},
 	}
-	return svc, nil
 }
@@ -0,0 +1,355 @@
+/*
+Copyright 2024 AxonOps Limited
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package apps
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/yaml"
+
+	cassandraaxonopscomv1 "github.com/axonops/axonops-developer-operator/api/v1"
+)
+
+// Keys of the ConfigMap holding the cassandra.yaml settings of the spec
+const (
+	cassandraConfigFile         = "cassandra.yaml"
+	cassandraReplacedKeysFile   = "replaced-keys"
+	cassandraConfigDir          = "/etc/cassandra"
+	cassandraConfigVolume       = "config"
+	cassandraConfigSourceVolume = "config-overrides"
+)
+
+// CassandraConfigContainer is the init container writing the cassandra.yaml of the nodes
+const CassandraConfigContainer = "cassandra-config"
+
+// cassandraConfigScript copies the configuration directory of the image to the volume the
+// Cassandra container mounts. The top level settings of the default cassandra.yaml that are
+// configured in the spec are dropped and the configured ones appended, the same goes for the
+// options of the jvm options files with the heap of the node added to jvm-server.options.
+const cassandraConfigScript = `cp -a ` + cassandraConfigDir + `/. /config/
+if [ -e /overrides/` + cassandraReplacedKeysFile + ` ]; then
+  awk 'NR == FNR { replaced[$0]; next }
+  /^[^ \t#-]/ { key = $0; sub(/:.*/, "", key); skip = (key in replaced) }
+  !skip' /overrides/` + cassandraReplacedKeysFile + ` ` + cassandraConfigDir + `/cassandra.yaml > /config/cassandra.yaml
+  cat /overrides/` + cassandraConfigFile + ` >> /config/cassandra.yaml
+fi
+if [ -e /overrides/` + jvmReplacedOptionsFile + ` ]; then
+  for f in ` + jvmServerOptionsFile + ` ` + jvm11ServerOptionsFile + ` ` + jvm17ServerOptionsFile + `; do
+    [ -e ` + cassandraConfigDir + `/$f ] || continue
+    awk 'NR == FNR { replaced[$0]; next }
+    { for (re in replaced) if ($0 ~ re) next }
+    1' /overrides/` + jvmReplacedOptionsFile + ` ` + cassandraConfigDir + `/$f > /config/$f
+    if [ -e /overrides/$f ]; then cat /overrides/$f >> /config/$f; fi
+  done
+  for option in $JVM_HEAP_OPTIONS; do echo "$option"; done >> /config/` + jvmServerOptionsFile + `
+fi
+`
+
+// CassandraManagedSettings lists the cassandra.yaml settings the image entrypoint writes from
+// the environment variables set by the operator, a value set in the config field would be
+// replaced
+var CassandraManagedSettings = []string{
+	"cluster_name",
+	"seed_provider",
+	"endpoint_snitch",
+	"listen_address",
+	"broadcast_address",
+	"rpc_address",
+	"broadcast_rpc_address",
+	"native_transport_port",
+}
+
+// Cassandra50Settings lists the cassandra.yaml settings added in Cassandra 5.0, a 4.x node
+// does not start when they are set
+var Cassandra50Settings = []string{
+	"sai_options",
+	"default_secondary_index",
+	"default_secondary_index_enabled",
+	"storage_compatibility_mode",
+	"dynamic_data_masking_enabled",
+	"default_compaction",
+}
+
+// renamedSetting is a cassandra.yaml setting renamed in Cassandra 4.1. The 4.0 name takes a
+// number in unit while the new one takes a value with its unit such as 10s or 64MiB, the
+// settings without unit are booleans.
+type renamedSetting struct {
+	legacy string
+	unit   string
+}
+
+// renamedSettings are the settings renamed in Cassandra 4.1 by their current name
+var renamedSettings = map[string]renamedSetting{
+	"read_request_timeout":                    {"read_request_timeout_in_ms", "ms"},
+	"range_request_timeout":                   {"range_request_timeout_in_ms", "ms"},
+	"write_request_timeout":                   {"write_request_timeout_in_ms", "ms"},
+	"counter_write_request_timeout":           {"counter_write_request_timeout_in_ms", "ms"},
+	"cas_contention_timeout":                  {"cas_contention_timeout_in_ms", "ms"},
+	"truncate_request_timeout":                {"truncate_request_timeout_in_ms", "ms"},
+	"request_timeout":                         {"request_timeout_in_ms", "ms"},
+	"slow_query_log_timeout":                  {"slow_query_log_timeout_in_ms", "ms"},
+	"gc_warn_threshold":                       {"gc_warn_threshold_in_ms", "ms"},
+	"gc_log_threshold":                        {"gc_log_threshold_in_ms", "ms"},
+	"max_hint_window":                         {"max_hint_window_in_ms", "ms"},
+	"permissions_validity":                    {"permissions_validity_in_ms", "ms"},
+	"roles_validity":                          {"roles_validity_in_ms", "ms"},
+	"credentials_validity":                    {"credentials_validity_in_ms", "ms"},
+	"batch_size_warn_threshold":               {"batch_size_warn_threshold_in_kb", "KiB"},
+	"batch_size_fail_threshold":               {"batch_size_fail_threshold_in_kb", "KiB"},
+	"column_index_size":                       {"column_index_size_in_kb", "KiB"},
+	"hinted_handoff_throttle":                 {"hinted_handoff_throttle_in_kb", "KiB"},
+	"key_cache_size":                          {"key_cache_size_in_mb", "MiB"},
+	"counter_cache_size":                      {"counter_cache_size_in_mb", "MiB"},
+	"commitlog_segment_size":                  {"commitlog_segment_size_in_mb", "MiB"},
+	"memtable_heap_space":                     {"memtable_heap_space_in_mb", "MiB"},
+	"memtable_offheap_space":                  {"memtable_offheap_space_in_mb", "MiB"},
+	"native_transport_max_frame_size":         {"native_transport_max_frame_size_in_mb", "MiB"},
+	"compaction_throughput":                   {"compaction_throughput_mb_per_sec", "MiB/s"},
+	"materialized_views_enabled":              {"enable_materialized_views", ""},
+	"sasi_indexes_enabled":                    {"enable_sasi_indexes", ""},
+	"user_defined_functions_enabled":          {"enable_user_defined_functions", ""},
+	"scripted_user_defined_functions_enabled": {"enable_scripted_user_defined_functions", ""},
+	"transient_replication_enabled":           {"enable_transient_replication", ""},
+	"drop_compact_storage_enabled":            {"enable_drop_compact_storage", ""},
+}
+
+// cassandraUnits are the units of the values of cassandra.yaml in the smallest unit of their
+// kind: nanoseconds, bytes and bytes per second
+var cassandraUnits = map[string]struct {
+	kind  string
+	scale int64
+}{
+	"ns":    {"duration", 1},
+	"us":    {"duration", 1000},
+	"µs":    {"duration", 1000},
+	"ms":    {"duration", 1000 * 1000},
+	"s":     {"duration", 1000 * 1000 * 1000},
+	"m":     {"duration", 60 * 1000 * 1000 * 1000},
+	"h":     {"duration", 60 * 60 * 1000 * 1000 * 1000},
+	"d":     {"duration", 24 * 60 * 60 * 1000 * 1000 * 1000},
+	"B":     {"size", 1},
+	"KiB":   {"size", 1 << 10},
+	"MiB":   {"size", 1 << 20},
+	"GiB":   {"size", 1 << 30},
+	"B/s":   {"rate", 1},
+	"KiB/s": {"rate", 1 << 10},
+	"MiB/s": {"rate", 1 << 20},
+}
+
+// cassandraValuePattern splits a value with a unit such as 10s or 64MiB
+var cassandraValuePattern = regexp.MustCompile(`^(\d+)\s*([a-zA-Zµ/]+)$`)
+
+// CassandraSettings returns the settings of the config field named and valued for the
+// Cassandra version of an image tag, and the top level settings of the default cassandra.yaml
+// they replace. A setting renamed in Cassandra 4.1 can be given by either name, it is written
+// with its 4.0 name and a number for 4.0 and its current name and a unit for the later
+// versions. The settings are written as they are when the version of the tag is unknown.
+func CassandraSettings(tag string, config map[string]apiextensionsv1.JSON) (map[string]interface{}, []string, error) {
+	version, known := CassandraVersion(tag)
+	legacy := known && version == "4.0"
+	settings := map[string]interface{}{}
+	replaced := []string{}
+
+	for key, raw := range config {
+		var value interface{}
+		decoder := json.NewDecoder(bytes.NewReader(raw.Raw))
+		decoder.UseNumber()
+		if err := decoder.Decode(&value); err != nil {
+			return nil, nil, fmt.Errorf("%s: %w", key, err)
+		}
+
+		name, setting, renamed := lookupRenamedSetting(key)
+		if !renamed {
+			settings[key] = value
+			replaced = append(replaced, key)
+			continue
+		}
+		replaced = append(replaced, name, setting.legacy)
+		var err error
+		switch {
+		case legacy:
+			name = setting.legacy
+			value, err = legacyValue(value, setting.unit)
+		case known:
+			value = currentValue(value, setting.unit)
+		default:
+			name = key
+		}
+		if err != nil {
+			return nil, nil, fmt.Errorf("%s: %w", key, err)
+		}
+		if _, ok := settings[name]; ok {
+			return nil, nil, fmt.Errorf("%s: %s is set twice", key, name)
+		}
+		settings[name] = value
+	}
+	slices.Sort(replaced)
+	return settings, slices.Compact(replaced), nil
+}
+
+// lookupRenamedSetting finds a setting renamed in Cassandra 4.1 by its current or 4.0 name
+func lookupRenamedSetting(key string) (string, renamedSetting, bool) {
+	if setting, ok := renamedSettings[key]; ok {
+		return key, setting, true
+	}
+	for name, setting := range renamedSettings {
+		if setting.legacy == key {
+			return name, setting, true
+		}
+	}
+	return "", renamedSetting{}, false
+}
+
+// legacyValue converts a value with a unit such as 10s to a number of unit for Cassandra 4.0
+func legacyValue(value interface{}, unit string) (interface{}, error) {
+	s, ok := value.(string)
+	if unit == "" || !ok {
+		return value, nil
+	}
+	m := cassandraValuePattern.FindStringSubmatch(s)
+	if m == nil {
+		return nil, fmt.Errorf("%q is not a number followed by a unit such as 10%s", s, unit)
+	}
+	from, ok := cassandraUnits[m[2]]
+	to := cassandraUnits[unit]
+	if !ok || from.kind != to.kind {
+		return nil, fmt.Errorf("%q is not a %s", s, to.kind)
+	}
+	n, err := strconv.ParseInt(m[1], 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("%q: %w", s, err)
+	}
+	if n*from.scale%to.scale != 0 {
+		return nil, fmt.Errorf("%q is not a whole number of %s as required by Cassandra 4.0", s, unit)
+	}
+	return json.Number(strconv.FormatInt(n*from.scale/to.scale, 10)), nil
+}
+
+// currentValue adds the unit of the 4.0 name to a number for Cassandra 4.1 and later
+func currentValue(value interface{}, unit string) interface{} {
+	if n, ok := value.(json.Number); ok && unit != "" {
+		return n.String() + unit
+	}
+	return value
+}
+
+// GenerateCassandraConfigMap renders the ConfigMap ca-<name>-config with the cassandra.yaml
+// settings of the config field and the default settings they replace, and the options of
+// the jvm field for the jvm options files. The authentication and encryption settings are
+// added when they are enabled. The ConfigMap is also returned, possibly empty, when the nodes
+// need their keystore as the init container merging the configuration copies it. It returns
+// nil when there is nothing to configure.
+func GenerateCassandraConfigMap(name string, namespace string, cfg cassandraaxonopscomv1.AxonOpsCassandraCluster) (*corev1.ConfigMap, error) {
+	config, err := withTLSSettings(cfg, withAuthenticationSettings(cfg))
+	if err != nil {
+		return nil, err
+	}
+	if len(config) == 0 && cfg.JVM == nil && !TLSRequired(cfg) {
+		return nil, nil
+	}
+	data := map[string]string{}
+	if len(config) > 0 {
+		settings, replaced, err := CassandraSettings(cfg.Image.Tag, config)
+		if err != nil {
+			return nil, err
+		}
+		b, err := json.Marshal(settings)
+		if err != nil {
+			return nil, err
+		}
+		config, err := yaml.JSONToYAML(b)
+		if err != nil {
+			return nil, err
+		}
+		data[cassandraConfigFile] = string(config)
+		data[cassandraReplacedKeysFile] = strings.Join(replaced, "\n") + "\n"
+	}
+	if cfg.JVM != nil {
+		files, replaced := jvmOptionsFiles(cfg.JVM)
+		for file, options := range files {
+			data[file] = options
+		}
+		data[jvmReplacedOptionsFile] = strings.Join(replaced, "\n") + "\n"
+	}
+
+	labels := map[string]string{"app": "ds-" + name, "component": "cassandra"}
+	for k, v := range cfg.Labels {
+		labels[k] = v
+	}
+	return &corev1.ConfigMap{
+		TypeMeta: metav1.TypeMeta{APIVersion: "v1", Kind: "ConfigMap"},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        CassandraConfigMapName(name),
+			Namespace:   namespace,
+			Labels:      labels,
+			Annotations: cfg.Annotations,
+		},
+		Data: data,
+	}, nil
+}
+
+// CassandraConfigMapName returns the name of the ConfigMap of the cassandra.yaml settings
+func CassandraConfigMapName(name string) string {
+	return "ca-" + name + "-config"
+}
+
+// mountCassandraConfig runs an init container merging the settings and the JVM options of
+// the ConfigMap into the configuration of the image and mounts the merged configuration in
+// the Cassandra container. The heap options are given to the init container as they depend
+// on the resources of the datacenter.
+func mountCassandraConfig(pod *corev1.PodSpec, configMap *corev1.ConfigMap, heapOptions string) {
+	if len(pod.Containers) == 0 {
+		return
+	}
+	container := &pod.Containers[0]
+	pod.Volumes = append(pod.Volumes,
+		corev1.Volume{
+			Name:         cassandraConfigVolume,
+			VolumeSource: corev1.VolumeSource{EmptyDir: &corev1.EmptyDirVolumeSource{}},
+		},
+		corev1.Volume{
+			Name: cassandraConfigSourceVolume,
+			VolumeSource: corev1.VolumeSource{ConfigMap: &corev1.ConfigMapVolumeSource{
+				LocalObjectReference: corev1.LocalObjectReference{Name: configMap.Name},
+			}},
+		},
+	)
+	pod.InitContainers = append(pod.InitContainers, corev1.Container{
+		Name:            CassandraConfigContainer,
+		Image:           container.Image,
+		ImagePullPolicy: container.ImagePullPolicy,
+		Command:         []string{"/bin/bash", "-ec", cassandraConfigScript},
+		Env:             []corev1.EnvVar{{Name: "JVM_HEAP_OPTIONS", Value: heapOptions}},
+		VolumeMounts: []corev1.VolumeMount{
+			{Name: cassandraConfigVolume, MountPath: "/config"},
+			{Name: cassandraConfigSourceVolume, MountPath: "/overrides"},
+		},
+	})
+	container.VolumeMounts = append(container.VolumeMounts, corev1.VolumeMount{
+		Name:      cassandraConfigVolume,
+		MountPath: cassandraConfigDir,
+	})
+}
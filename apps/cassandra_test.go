@@ -0,0 +1,96 @@
+/*
+ Copyright 2024 AxonOps Limited
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+      https://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package apps
+
+import (
+	"strings"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+
+	cassandraaxonopscomv1 "github.com/axonops/axonops-developer-operator/api/v1"
+)
+
+var _ = Describe("CassandraSeeds", func() {
+	seeds := func(cfg cassandraaxonopscomv1.AxonOpsCassandraCluster, previous string, joined ...string) []string {
+		nodes := map[string]bool{}
+		for _, node := range joined {
+			nodes[node] = true
+		}
+		list := CassandraSeeds("test", "default", cfg, CassandraRacks("test", cfg), previous, nodes)
+		names := []string{}
+		for _, seed := range strings.Split(list, ",") {
+			names = append(names, strings.TrimSuffix(seed, ".ca-test-headless.default.svc.cluster.local"))
+		}
+		return names
+	}
+	address := func(nodes ...string) string {
+		addresses := []string{}
+		for _, node := range nodes {
+			addresses = append(addresses, node+".ca-test-headless.default.svc.cluster.local")
+		}
+		return strings.Join(addresses, ",")
+	}
+
+	It("should start an empty cluster from its first node alone", func() {
+		Expect(seeds(cassandraaxonopscomv1.AxonOpsCassandraCluster{Replicas: 3}, "")).
+			To(Equal([]string{"ca-test-0"}))
+	})
+
+	It("should keep the list when nodes are added", func() {
+		cfg := cassandraaxonopscomv1.AxonOpsCassandraCluster{Replicas: 3}
+		Expect(seeds(cfg, address("ca-test-0"), "ca-test-0")).To(Equal([]string{"ca-test-0"}))
+	})
+
+	It("should only add the nodes that joined the ring, spread over the racks", func() {
+		cfg := cassandraaxonopscomv1.AxonOpsCassandraCluster{
+			SeedsPerDC: 2,
+			Racks: []cassandraaxonopscomv1.Rack{
+				{Name: "r1", Replicas: 2},
+				{Name: "r2", Replicas: 2},
+			},
+		}
+		Expect(seeds(cfg, "", "ca-test-r1-0", "ca-test-r1-1", "ca-test-r2-0")).
+			To(Equal([]string{"ca-test-r1-0", "ca-test-r2-0"}))
+		Expect(seeds(cfg, address("ca-test-r1-1"), "ca-test-r1-0", "ca-test-r1-1", "ca-test-r2-0")).
+			To(Equal([]string{"ca-test-r1-1", "ca-test-r1-0"}))
+	})
+
+	It("should drop the seeds removed from the topology", func() {
+		cfg := cassandraaxonopscomv1.AxonOpsCassandraCluster{Replicas: 2}
+		Expect(seeds(cfg, address("ca-test-0", "ca-test-2"), "ca-test-0", "ca-test-1")).
+			To(Equal([]string{"ca-test-0", "ca-test-1"}))
+	})
+})
+
+var _ = Describe("setConfigHash", func() {
+	hash := func(env ...corev1.EnvVar) string {
+		template := &corev1.PodTemplateSpec{Spec: corev1.PodSpec{
+			Containers: []corev1.Container{{Name: "cassandra", Env: env}},
+		}}
+		Expect(setConfigHash(template, nil)).To(Succeed())
+		return template.Annotations[cassandraaxonopscomv1.ConfigHashAnnotation]
+	}
+
+	It("should only change with the settings that need a restart", func() {
+		dc := corev1.EnvVar{Name: "CASSANDRA_DC", Value: "dc1"}
+		Expect(hash(dc, corev1.EnvVar{Name: "CASSANDRA_SEEDS", Value: "a"})).
+			To(Equal(hash(dc, corev1.EnvVar{Name: "CASSANDRA_SEEDS", Value: "b"})))
+		Expect(hash(dc)).NotTo(Equal(hash(corev1.EnvVar{Name: "CASSANDRA_DC", Value: "dc2"})))
+	})
+})
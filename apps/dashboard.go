@@ -17,307 +17,124 @@
 package apps
 
 import (
-	"bytes"
 	"fmt"
-	"text/template"
 
-	"github.com/Masterminds/sprig"
-	cassandraaxonopscomv1beta1 "github.com/axonops/axonops-developer-operator/api/v1beta1"
+	cassandraaxonopscomv1 "github.com/axonops/axonops-developer-operator/api/v1"
 	"github.com/axonops/axonops-developer-operator/utils"
 	appsv1 "k8s.io/api/apps/v1"
 	corev1 "k8s.io/api/core/v1"
 	networkingv1 "k8s.io/api/networking/v1"
-	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
-	"k8s.io/apimachinery/pkg/runtime"
-	"k8s.io/apimachinery/pkg/util/yaml"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
 )
 
 const defaultDashboardImage = "registry.axonops.com/axonops-public/axonops-docker/axon-dash"
 const defaultDashboardTag = "latest"
 
-const DashboardServiceTemplate = `
-apiVersion: v1
-kind: Service
-metadata:
-  name: ds-{{ .Name }}
-  namespace: {{ .Namespace }}
-  labels:
-    app: ds-{{ .Name }}
-    component: dashboard
-  {{- with .Labels }}
-    {{- range $key, $value := . }}
-    {{ $key }}: {{ $value }}
-    {{- end }}
-  {{- end }}
-  {{- with .Annotations }}
-  annotations:
-    {{- range $key, $value := . }}
-    {{ $key }}: {{ $value }}
-    {{- end }}
-  {{- end }}
-spec:
-  selector:
-    app: ds-{{ .Name }}
-  ports:
-  - protocol: TCP
-    port: 3000
-    targetPort: 3000
-    name: http
-`
-
-const DashboardTemplate = `
-apiVersion: apps/v1
-kind: Deployment
-metadata:
-  name: ds-{{ .Name }}
-  namespace: {{ .Namespace }}
-  labels:
-    app: ds-{{ .Name }}
-    component: dashboard
-  {{- with .Labels }}
-    {{- range $key, $value := . }}
-    {{ $key }}: {{ $value }}
-    {{- end }}
-  {{- end }}
-  {{- with .Annotations }}
-  annotations:
-    {{- range $key, $value := . }}
-    {{ $key }}: {{ $value }}
-    {{- end }}
-  {{- end }}
-spec:
-  serviceName: ds-{{ .Name }}
-  replicas: {{ .Replicas }}
-  selector:
-    matchLabels:
-      app: ds-{{ .Name }}
-  template:
-    metadata:
-      labels:
-        app: ds-{{ .Name }}
-    spec:
-      containers:
-      - name: axon-dash
-        command:
-        - /bin/sh
-        - -c
-        - "sed -i 's|private_endpoints.*|private_endpoints: http://as-{{ .Name }}:8080|' /etc/axonops/axon-dash.yml && /usr/share/axonops/axon-dash --appimage-extract-and-run"
-        image: {{ .Image }}
-        ports:
-        - containerPort: 3000
-          name: http
-        env:
-        - name: node.name
-          valueFrom:
-            fieldRef:
-              fieldPath: metadata.name
-        {{- range $env := .Env }}
-        - name: {{ $env.Name }}
-          value: "{{ $env.Value }}"
-        {{- end }}
-        resources:
-          limits:
-            cpu: {{ .CpuLimit }}
-            memory: {{ .MemoryLimit }}
-          requests:
-            cpu: {{ .CpuRequest }}
-            memory: {{ .MemoryRequest }}
-`
-
-const DashboardIngressTemplate = `{{- if .IngressEnabled -}}
-apiVersion: {{ default "networking.k8s.io/v1" .APIVersion }}
-kind: Ingress
-metadata:
-  name: ds-{{ .Name }}
-  namespace: {{ .Namespace }}
-  labels:
-    app: ds-{{ .Name }}
-    component: dashboard
-  {{- with .Labels }}
-    {{- range $key, $value := . }}
-    {{ $key }}: {{ $value }}
-    {{- end }}
-  {{- end }}
-  {{- with .Annotations }}
-  annotations:
-    {{- range $key, $value := . }}
-    {{ $key }}: {{ $value }}
-    {{- end }}
-  {{- end }}
-spec:
-  {{- if .ClassName }}
-  ingressClassName: {{ default "" .ClassName }}
-  {{- end }}
-  {{- if .Tls }}
-  tls:
-    - hosts:
-        {{- range $host := .Hosts }}
-        - {{ $host }}
-        {{- end }}
-      secretName: {{ .Name }}-tls
-  {{- end }}
-  rules:
-    {{- range $host := .Hosts }}
-    - host: {{ $host | quote }}
-      http:
-        paths:
-          - pathType: {{ default $.PathType "Prefix" }}
-            path: {{ default $.Path "/" }}
-            backend:
-              service:
-                name: "ds-{{ $.Name }}"
-                port:
-                  number: 3000
-    {{- end }}
-{{- end }}`
-
-type DashboardServiceConfig struct {
-	Name        string
-	Namespace   string
-	Labels      map[string]string
-	Annotations map[string]string
-}
-
-type DashboardConfig struct {
-	Name          string
-	Namespace     string
-	Replicas      int
-	Image         string
-	Labels        map[string]string
-	Annotations   map[string]string
-	Env           []cassandraaxonopscomv1beta1.EnvVars
-	CpuLimit      string
-	MemoryLimit   string
-	CpuRequest    string
-	MemoryRequest string
-}
-
-type DashboardIngressConfig struct {
-	Name           string
-	Namespace      string
-	IngressEnabled bool
-	APIVersion     string
-	Labels         map[string]string
-	Annotations    map[string]string
-	ClassName      string
-	Tls            bool
-	Hosts          []string
-	Path           string
-	PathType       string
+// DashboardManagedEnv lists the environment variables the operator sets on the AxonOps dashboard container
+var DashboardManagedEnv = []string{
+	"node.name",
 }
 
-func GenerateDashboardConfig(cfg cassandraaxonopscomv1beta1.AxonOpsCassandra) (*appsv1.Deployment, error) {
-	config := DashboardConfig{
-		Name:      cfg.GetName(),
-		Namespace: cfg.GetNamespace(),
-		Replicas:  1,
-		Image: fmt.Sprintf("%s:%s",
-			utils.ValueOrDefault(cfg.Spec.AxonOps.Dashboard.Image.Repository, defaultDashboardImage),
-			utils.ValueOrDefault(cfg.Spec.AxonOps.Dashboard.Image.Tag, defaultDashboardTag),
-		),
-		Labels:        cfg.Spec.AxonOps.Dashboard.Labels,
-		Annotations:   cfg.Spec.AxonOps.Dashboard.Annotations,
-		Env:           cfg.Spec.AxonOps.Dashboard.Env,
-		CpuRequest:    utils.ValueOrDefault(cfg.Spec.AxonOps.Dashboard.Resources.Requests.Cpu().String(), "500m"),
-		MemoryRequest: utils.ValueOrDefault(cfg.Spec.AxonOps.Dashboard.Resources.Requests.Memory().String(), "256Mi"),
-		CpuLimit:      utils.ValueOrDefault(cfg.Spec.AxonOps.Dashboard.Resources.Limits.Cpu().String(), "1000m"),
-		MemoryLimit:   utils.ValueOrDefault(cfg.Spec.AxonOps.Dashboard.Resources.Limits.Memory().String(), "512Mi"),
-	}
-
-	Deployment := &appsv1.Deployment{}
-	b := bytes.NewBuffer(nil)
-	tmpl, err := template.New("Dashboard").Funcs(sprig.FuncMap()).Parse(DashboardTemplate)
-	if err != nil {
-		return Deployment, err
-	}
-
-	err = tmpl.Execute(b, config)
-	if err != nil {
-		return Deployment, err
-	}
-
-	obj := &unstructured.Unstructured{}
-	es := yaml.NewYAMLOrJSONDecoder(b, 500)
-	if err := es.Decode(obj); err != nil {
-		return Deployment, err
-	}
-
-	err = runtime.DefaultUnstructuredConverter.FromUnstructured(obj.Object, Deployment)
-	if err != nil {
-		return Deployment, err
+// GenerateDashboardConfig builds the Deployment ds-<name> of the AxonOps dashboard
+func GenerateDashboardConfig(cfg cassandraaxonopscomv1.AxonOpsCassandra) (*appsv1.Deployment, error) {
+	dashboard := cfg.Spec.AxonOps.Dashboard
+	name := "ds-" + cfg.GetName()
+	selector := map[string]string{"app": name}
+	replicas := int32(1)
+	deployment := &appsv1.Deployment{
+		TypeMeta: metav1.TypeMeta{APIVersion: "apps/v1", Kind: "Deployment"},
+		ObjectMeta: objectMeta(name, cfg.GetNamespace(), dashboard.Annotations,
+			map[string]string{"app": name, "component": "dashboard"}, dashboard.Labels),
+		Spec: appsv1.DeploymentSpec{
+			Replicas: &replicas,
+			Selector: &metav1.LabelSelector{MatchLabels: selector},
+			Template: corev1.PodTemplateSpec{
+				ObjectMeta: metav1.ObjectMeta{Labels: mergeLabels(selector)},
+				Spec: corev1.PodSpec{
+					Containers: []corev1.Container{{
+						Name: "axon-dash",
+						Command: []string{
+							"/bin/sh",
+							"-c",
+							fmt.Sprintf("sed -i 's|private_endpoints.*|private_endpoints: http://as-%s:8080|' /etc/axonops/axon-dash.yml && /usr/share/axonops/axon-dash --appimage-extract-and-run", cfg.GetName()),
+						},
+						Image: fmt.Sprintf("%s:%s",
+							utils.ValueOrDefault(dashboard.Image.Repository, defaultDashboardImage),
+							utils.ValueOrDefault(dashboard.Image.Tag, defaultDashboardTag),
+						),
+						Ports: []corev1.ContainerPort{
+							{ContainerPort: 3000, Name: "http"},
+						},
+						Env:       []corev1.EnvVar{nodeNameEnv()},
+						Resources: containerResources(dashboard.Resources),
+					}},
+				},
+			},
+		},
 	}
-	return Deployment, nil
+	appendEnv(&deployment.Spec.Template.Spec, dashboard.Env, dashboard.EnvFrom)
+	return deployment, nil
 }
 
-func GenerateDashboardServiceConfig(cfg cassandraaxonopscomv1beta1.AxonOpsCassandra) (*corev1.Service, error) {
-	config := DashboardServiceConfig{
-		Name:        cfg.GetName(),
-		Namespace:   cfg.GetNamespace(),
-		Labels:      cfg.Spec.AxonOps.Dashboard.Labels,
-		Annotations: cfg.Spec.AxonOps.Dashboard.Annotations,
-	}
-
-	svc := &corev1.Service{}
-	b := bytes.NewBuffer(nil)
-	tmpl, err := template.New("Dashboard").Funcs(sprig.FuncMap()).Parse(DashboardServiceTemplate)
-	if err != nil {
-		return svc, err
-	}
-
-	err = tmpl.Execute(b, config)
-	if err != nil {
-		return svc, err
-	}
-
-	obj := &unstructured.Unstructured{}
-	es := yaml.NewYAMLOrJSONDecoder(b, 500)
-	if err := es.Decode(obj); err != nil {
-		return svc, err
-	}
-
-	err = runtime.DefaultUnstructuredConverter.FromUnstructured(obj.Object, svc)
-	if err != nil {
-		return svc, err
-	}
-	return svc, nil
+// GenerateDashboardServiceConfig builds the service ds-<name> in front of the dashboard
+func GenerateDashboardServiceConfig(cfg cassandraaxonopscomv1.AxonOpsCassandra) (*corev1.Service, error) {
+	name := "ds-" + cfg.GetName()
+	return &corev1.Service{
+		TypeMeta: metav1.TypeMeta{APIVersion: "v1", Kind: "Service"},
+		ObjectMeta: objectMeta(name, cfg.GetNamespace(), cfg.Spec.AxonOps.Dashboard.Annotations,
+			map[string]string{"app": name, "component": "dashboard"}, cfg.Spec.AxonOps.Dashboard.Labels),
+		Spec: corev1.ServiceSpec{
+			Selector: map[string]string{"app": name},
+			Ports: []corev1.ServicePort{
+				{Protocol: corev1.ProtocolTCP, Port: 3000, TargetPort: intstr.FromInt32(3000), Name: "http"},
+			},
+		},
+	}, nil
 }
 
-func GenerateDashboardIngressConfig(cfg cassandraaxonopscomv1beta1.AxonOpsCassandra) (*networkingv1.Ingress, error) {
-	config := DashboardIngressConfig{
-		Name:           cfg.GetName(),
-		Namespace:      cfg.GetNamespace(),
-		IngressEnabled: utils.ValueOrDefaultBool(cfg.Spec.AxonOps.Dashboard.Ingress.Enabled, false),
-		APIVersion:     utils.ValueOrDefault(cfg.Spec.AxonOps.Dashboard.Ingress.ApiVersion, "networking.k8s.io/v1"),
-		Labels:         cfg.Spec.AxonOps.Dashboard.Ingress.Labels,
-		Annotations:    cfg.Spec.AxonOps.Dashboard.Ingress.Annotations,
-		ClassName:      utils.ValueOrDefault(cfg.Spec.AxonOps.Dashboard.Ingress.IngressClassName, ""),
-		Tls:            true,
-		Hosts:          cfg.Spec.AxonOps.Dashboard.Ingress.Hosts,
-		Path:           utils.ValueOrDefault(cfg.Spec.AxonOps.Dashboard.Ingress.Path, "/"),
-		PathType:       "Exact",
-	}
-
-	ingress := &networkingv1.Ingress{}
-	b := bytes.NewBuffer(nil)
-	tmpl, err := template.New("DashboardIngress").Funcs(sprig.FuncMap()).Parse(DashboardIngressTemplate)
-	if err != nil {
-		return ingress, err
+// GenerateDashboardIngressConfig builds the ingress ds-<name> exposing the dashboard on the
+// hosts of the spec. The dashboard is served from the root path and the certificate of the
+// hosts is read from the Secret <name>-tls.
+func GenerateDashboardIngressConfig(cfg cassandraaxonopscomv1.AxonOpsCassandra) (*networkingv1.Ingress, error) {
+	ingress := cfg.Spec.AxonOps.Dashboard.Ingress
+	name := "ds-" + cfg.GetName()
+	pathType := networkingv1.PathTypePrefix
+
+	var rules []networkingv1.IngressRule
+	for _, host := range ingress.Hosts {
+		rules = append(rules, networkingv1.IngressRule{
+			Host: host,
+			IngressRuleValue: networkingv1.IngressRuleValue{HTTP: &networkingv1.HTTPIngressRuleValue{
+				Paths: []networkingv1.HTTPIngressPath{{
+					PathType: &pathType,
+					Path:     defaultIngressPath,
+					Backend: networkingv1.IngressBackend{Service: &networkingv1.IngressServiceBackend{
+						Name: name,
+						Port: networkingv1.ServiceBackendPort{Number: 3000},
+					}},
+				}},
+			}},
+		})
 	}
 
-	err = tmpl.Execute(b, config)
-	if err != nil {
-		return ingress, err
+	obj := &networkingv1.Ingress{
+		TypeMeta: metav1.TypeMeta{
+			APIVersion: utils.ValueOrDefault(ingress.ApiVersion, defaultIngressAPIVersion),
+			Kind:       "Ingress",
+		},
+		ObjectMeta: objectMeta(name, cfg.GetNamespace(), ingress.Annotations,
+			map[string]string{"app": name, "component": "dashboard"}, ingress.Labels),
+		Spec: networkingv1.IngressSpec{
+			TLS: []networkingv1.IngressTLS{{
+				Hosts:      append([]string(nil), ingress.Hosts...),
+				SecretName: cfg.GetName() + "-tls",
+			}},
+			Rules: rules,
+		},
 	}
-
-	obj := &unstructured.Unstructured{}
-	es := yaml.NewYAMLOrJSONDecoder(b, 500)
-	if err := es.Decode(obj); err != nil {
-		return ingress, err
-	}
-
-	err = runtime.DefaultUnstructuredConverter.FromUnstructured(obj.Object, ingress)
-	if err != nil {
-		return ingress, err
+	if ingress.IngressClassName != "" {
+		obj.Spec.IngressClassName = &ingress.IngressClassName
 	}
-	return ingress, nil
+	return obj, nil
 }
@@ -0,0 +1,181 @@
+/*
+Copyright 2024 AxonOps Limited
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package apps
+
+import (
+	cassandraaxonopscomv1 "github.com/axonops/axonops-developer-operator/api/v1"
+	"github.com/axonops/axonops-developer-operator/utils"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+)
+
+const defaultCassandraReplicas = 1
+const defaultDC = "dc1"
+const defaultRack = "rack1"
+const defaultSeedsPerDC = 3
+
+// defaultMetricsEnabledDC is the data center given to the Cassandra cluster when the
+// metrics cluster is enabled and no data center is set
+const defaultMetricsEnabledDC = "axonops1"
+const defaultJavaOpts = "-Xms512m -Xmx512m"
+const defaultHeapSize = "512M"
+const defaultPullPolicy = "IfNotPresent"
+const defaultIngressAPIVersion = "networking.k8s.io/v1"
+const defaultIngressPath = "/"
+
+// resourceDefaults are the requests and limits used when a component does not set them
+type resourceDefaults struct {
+	cpuRequest    string
+	memoryRequest string
+	cpuLimit      string
+	memoryLimit   string
+}
+
+var (
+	cassandraResources     = resourceDefaults{cpuRequest: "500m", memoryRequest: "1Gi", cpuLimit: "1000m", memoryLimit: "2Gi"}
+	elasticsearchResources = resourceDefaults{cpuRequest: "500m", memoryRequest: "1Gi", cpuLimit: "1000m", memoryLimit: "2Gi"}
+	serverResources        = resourceDefaults{cpuRequest: "250m", memoryRequest: "256Mi", cpuLimit: "1000m", memoryLimit: "512Mi"}
+	dashboardResources     = resourceDefaults{cpuRequest: "500m", memoryRequest: "256Mi", cpuLimit: "1000m", memoryLimit: "512Mi"}
+)
+
+// SetDefaults writes the values the generators use for the unset fields into the spec,
+// so the stored AxonOpsCassandra shows what is deployed and a later release of the
+// operator changing a default does not change an existing environment.
+func SetDefaults(cr *cassandraaxonopscomv1.AxonOpsCassandra) {
+	spec := &cr.Spec
+
+	dc := defaultDC
+	if spec.AxonOps.Server.MetricsStore.Enabled {
+		dc = defaultMetricsEnabledDC
+	}
+	setCassandraDefaults(&spec.Cassandra, cr.GetName(), dc)
+	if store := &spec.AxonOps.Server.MetricsStore; store.Enabled {
+		if store.Replicas <= 0 {
+			store.Replicas = defaultCassandraReplicas
+		}
+		setImageDefaults(&store.Image, defaultCassandraImage, defaultCassandraTag)
+		setDefault(&store.ClusterName, "metrics-"+cr.GetName())
+		setDefault(&store.DC, defaultDC)
+		setDefault(&store.HeapSize, defaultHeapSize)
+		setPullPolicyDefault(&store.PullPolicy)
+		setResourceDefaults(&store.Resources, cassandraResources)
+	}
+
+	es := &spec.AxonOps.Elasticsearch
+	setImageDefaults(&es.Image, defaultElasticsearchImage, defaultElasticsearchTag)
+	setDefault(&es.ClusterName, cr.GetName())
+	setDefault(&es.JavaOpts, defaultJavaOpts)
+	setResourceDefaults(&es.Resources, elasticsearchResources)
+
+	server := &spec.AxonOps.Server
+	setImageDefaults(&server.Image, defaultServerImage, defaultServerTag)
+	setResourceDefaults(&server.Resources, serverResources)
+
+	dashboard := &spec.AxonOps.Dashboard
+	setImageDefaults(&dashboard.Image, defaultDashboardImage, defaultDashboardTag)
+	setResourceDefaults(&dashboard.Resources, dashboardResources)
+	if dashboard.Ingress.Enabled {
+		setDefault(&dashboard.Ingress.ApiVersion, defaultIngressAPIVersion)
+		setDefault(&dashboard.Ingress.Path, defaultIngressPath)
+	}
+
+	if spec.DriftPolicy == "" {
+		spec.DriftPolicy = cassandraaxonopscomv1.DriftPolicyRevert
+	}
+}
+
+func setCassandraDefaults(cluster *cassandraaxonopscomv1.AxonOpsCassandraCluster, name string, dc string) {
+	if len(cluster.Racks) == 0 && len(cluster.Datacenters) == 0 && cluster.Replicas <= 0 {
+		cluster.Replicas = defaultCassandraReplicas
+	}
+	if cluster.SeedsPerDC <= 0 {
+		cluster.SeedsPerDC = defaultSeedsPerDC
+	}
+	setRackDefaults(cluster.Racks)
+	for i := range cluster.Datacenters {
+		dc := &cluster.Datacenters[i]
+		if len(dc.Racks) == 0 && dc.Replicas <= 0 {
+			dc.Replicas = defaultCassandraReplicas
+		}
+		setRackDefaults(dc.Racks)
+	}
+	setImageDefaults(&cluster.Image, defaultCassandraImage, defaultCassandraTag)
+	setDefault(&cluster.ClusterName, name)
+	// the datacenters name themselves, the dc of the cluster is not used
+	if len(cluster.Datacenters) == 0 {
+		setDefault(&cluster.DC, dc)
+	}
+	setDefault(&cluster.HeapSize, defaultHeapSize)
+	setPullPolicyDefault(&cluster.PullPolicy)
+	setResourceDefaults(&cluster.Resources, cassandraResources)
+}
+
+func setRackDefaults(racks []cassandraaxonopscomv1.Rack) {
+	for i := range racks {
+		if racks[i].Replicas <= 0 {
+			racks[i].Replicas = defaultCassandraReplicas
+		}
+	}
+}
+
+func setImageDefaults(image *cassandraaxonopscomv1.ContainerImage, repository string, tag string) {
+	setDefault(&image.Repository, repository)
+	setDefault(&image.Tag, tag)
+}
+
+func setDefault(value *string, defaultValue string) {
+	*value = utils.ValueOrDefault(*value, defaultValue)
+}
+
+func setPullPolicyDefault(policy *corev1.PullPolicy) {
+	if *policy == "" {
+		*policy = defaultPullPolicy
+	}
+}
+
+// setResourceDefaults fills in the missing requests and limits. A defaulted request is
+// capped to the limit set by the user so the pair stays valid.
+func setResourceDefaults(resources *corev1.ResourceRequirements, defaults resourceDefaults) {
+	if resources.Limits == nil {
+		resources.Limits = corev1.ResourceList{}
+	}
+	if resources.Requests == nil {
+		resources.Requests = corev1.ResourceList{}
+	}
+	setQuantityDefault(resources.Limits, corev1.ResourceCPU, defaults.cpuLimit)
+	setQuantityDefault(resources.Limits, corev1.ResourceMemory, defaults.memoryLimit)
+
+	for name, value := range map[corev1.ResourceName]string{
+		corev1.ResourceCPU:    defaults.cpuRequest,
+		corev1.ResourceMemory: defaults.memoryRequest,
+	} {
+		if _, ok := resources.Requests[name]; ok {
+			continue
+		}
+		request := resource.MustParse(value)
+		if limit, ok := resources.Limits[name]; ok && request.Cmp(limit) > 0 {
+			request = limit.DeepCopy()
+		}
+		resources.Requests[name] = request
+	}
+}
+
+func setQuantityDefault(list corev1.ResourceList, name corev1.ResourceName, value string) {
+	if _, ok := list[name]; !ok {
+		list[name] = resource.MustParse(value)
+	}
+}
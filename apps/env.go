@@ -0,0 +1,37 @@
+/*
+Copyright 2024 AxonOps Limited
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package apps
+
+import (
+	corev1 "k8s.io/api/core/v1"
+)
+
+// appendEnv adds the user defined variables after the ones set by the operator, and the
+// ConfigMaps and Secrets of envFrom. Kubernetes gives env precedence over envFrom, so
+// envFrom cannot override the variables of the operator.
+func appendEnv(pod *corev1.PodSpec, env []corev1.EnvVar, envFrom []corev1.EnvFromSource) {
+	if len(pod.Containers) == 0 {
+		return
+	}
+	container := &pod.Containers[0]
+	for _, e := range env {
+		container.Env = append(container.Env, *e.DeepCopy())
+	}
+	for _, e := range envFrom {
+		container.EnvFrom = append(container.EnvFrom, *e.DeepCopy())
+	}
+}
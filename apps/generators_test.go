@@ -0,0 +1,302 @@
+/*
+ Copyright 2024 AxonOps Limited
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+      https://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package apps
+
+import (
+	"bytes"
+	"flag"
+	"os"
+	"path/filepath"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/yaml"
+
+	cassandraaxonopscomv1 "github.com/axonops/axonops-developer-operator/api/v1"
+)
+
+// The generated objects are compared with the files of testdata, run
+// go test ./apps -update to write them again after an intended change.
+var update = flag.Bool("update", false, "write the generated objects to the golden files")
+
+// generateAll builds every object the controller creates for cr, in the order of the controller
+func generateAll(cr cassandraaxonopscomv1.AxonOpsCassandra) []interface{} {
+	objects := []interface{}{}
+	add := func(obj interface{}, err error) {
+		Expect(err).NotTo(HaveOccurred())
+		objects = append(objects, obj)
+	}
+
+	add(GenerateElasticsearchConfig(cr))
+	add(GenerateElasticsearchServiceConfig(cr))
+	if store := cr.Spec.AxonOps.Server.MetricsStore; store.Enabled {
+		metricsCluster := MetricsStoreCluster(store)
+		metricsRacks := CassandraRacks("metrics-"+cr.GetName(), metricsCluster)
+		add(GenerateCassandraSeedsConfigMap("metrics-"+cr.GetName(), cr.GetNamespace(), metricsCluster,
+			CassandraSeeds("metrics-"+cr.GetName(), cr.GetNamespace(), metricsCluster, metricsRacks, "", nil)), nil)
+		add(GenerateCassandraConfig("metrics-"+cr.GetName(), cr.GetNamespace(), store.PersistentVolume,
+			metricsCluster, metricsRacks[0]))
+		add(GenerateCassandraHeadlessServiceConfig("metrics-"+cr.GetName(), cr.GetNamespace(),
+			cr.Spec.Cassandra.Labels, cr.Spec.Cassandra.Annotations))
+		add(GenerateCassandraServiceConfig("metrics-"+cr.GetName(), cr.GetNamespace(),
+			cr.Spec.Cassandra.Labels, cr.Spec.Cassandra.Annotations))
+	}
+	add(GenerateServerConfig(cr))
+	add(GenerateServerServiceConfig(cr))
+	add(GenerateDashboardConfig(cr))
+	add(GenerateDashboardServiceConfig(cr))
+	if cr.Spec.AxonOps.Dashboard.Ingress.Enabled {
+		add(GenerateDashboardIngressConfig(cr))
+	}
+	cluster := CassandraCluster(cr)
+	racks := CassandraRacks(cr.GetName(), cluster)
+	add(GenerateCassandraSeedsConfigMap(cr.GetName(), cr.GetNamespace(), cluster,
+		CassandraSeeds(cr.GetName(), cr.GetNamespace(), cluster, racks, "", nil)), nil)
+	for _, rack := range racks {
+		add(GenerateCassandraConfig(cr.GetName(), cr.GetNamespace(), cluster.PersistentVolume, cluster, rack))
+	}
+	add(GenerateCassandraServiceConfig(cr.GetName(), cr.GetNamespace(), cluster.Labels, cluster.Annotations))
+	add(GenerateCassandraHeadlessServiceConfig(cr.GetName(), cr.GetNamespace(), cluster.Labels, cluster.Annotations))
+	return objects
+}
+
+func expectGolden(name string, objects []interface{}) {
+	var b bytes.Buffer
+	for _, obj := range objects {
+		out, err := yaml.Marshal(obj)
+		Expect(err).NotTo(HaveOccurred())
+		b.WriteString("---\n")
+		b.Write(out)
+	}
+
+	path := filepath.Join("testdata", name+".golden.yaml")
+	if *update {
+		Expect(os.WriteFile(path, b.Bytes(), 0o644)).To(Succeed())
+		return
+	}
+	golden, err := os.ReadFile(path)
+	Expect(err).NotTo(HaveOccurred())
+	Expect(b.String()).To(Equal(string(golden)), "the objects differ from %s", path)
+}
+
+func newCassandra(spec cassandraaxonopscomv1.AxonOpsCassandraSpec) cassandraaxonopscomv1.AxonOpsCassandra {
+	return cassandraaxonopscomv1.AxonOpsCassandra{
+		ObjectMeta: metav1.ObjectMeta{Name: "sample", Namespace: "axonops-dev"},
+		Spec:       spec,
+	}
+}
+
+func quantity(value string) *resource.Quantity {
+	q := resource.MustParse(value)
+	return &q
+}
+
+// fullSpec sets every field read by the generators
+func fullSpec() cassandraaxonopscomv1.AxonOpsCassandraSpec {
+	env := []corev1.EnvVar{
+		{Name: "EXTRA", Value: "a value with \"quotes\"\nand a new line"},
+		{Name: "FROM_SECRET", ValueFrom: &corev1.EnvVarSource{
+			SecretKeyRef: &corev1.SecretKeySelector{
+				LocalObjectReference: corev1.LocalObjectReference{Name: "credentials"},
+				Key:                  "password",
+			},
+		}},
+	}
+	envFrom := []corev1.EnvFromSource{
+		{ConfigMapRef: &corev1.ConfigMapEnvSource{LocalObjectReference: corev1.LocalObjectReference{Name: "settings"}}},
+		{Prefix: "S_", SecretRef: &corev1.SecretEnvSource{LocalObjectReference: corev1.LocalObjectReference{Name: "secrets"}}},
+	}
+	resources := corev1.ResourceRequirements{
+		Limits: corev1.ResourceList{
+			corev1.ResourceCPU:    resource.MustParse("2"),
+			corev1.ResourceMemory: resource.MustParse("4Gi"),
+		},
+		Requests: corev1.ResourceList{
+			corev1.ResourceCPU:    resource.MustParse("1500m"),
+			corev1.ResourceMemory: resource.MustParse("3Gi"),
+		},
+	}
+
+	return cassandraaxonopscomv1.AxonOpsCassandraSpec{
+		Cassandra: cassandraaxonopscomv1.AxonOpsCassandraCluster{
+			Image: cassandraaxonopscomv1.ContainerImage{Repository: "example.com/cassandra", Tag: "4.1.7"},
+			Racks: []cassandraaxonopscomv1.Rack{
+				{Name: "r1", Replicas: 2, Zone: "zone-a"},
+				{Name: "r2", Replicas: 1, NodeSelector: map[string]string{"disk": "ssd"}},
+			},
+			ClusterName: "production",
+			DC:          "london",
+			Config: map[string]apiextensionsv1.JSON{
+				"num_tokens": {Raw: []byte("16")},
+			},
+			PersistentVolume: cassandraaxonopscomv1.PersistentVolumeSpec{StorageClass: "fast", Size: quantity("20Gi")},
+			HeapSize:         "1G",
+			Authentication:   cassandraaxonopscomv1.Authentication{Enabled: true},
+			TLS: cassandraaxonopscomv1.TLS{
+				Enabled:   true,
+				Internode: true,
+				Agent:     true,
+			},
+			Labels:      map[string]string{"team": "storage", "tier": "backend"},
+			Annotations: map[string]string{"example.com/owner": "storage"},
+			Env:         env,
+			EnvFrom:     envFrom,
+			Resources:   resources,
+			PullPolicy:  corev1.PullAlways,
+		},
+		AxonOps: cassandraaxonopscomv1.AxonOpsCluster{
+			Dashboard: cassandraaxonopscomv1.AxonOpsDashboard{
+				Image: cassandraaxonopscomv1.ContainerImage{Repository: "example.com/axon-dash", Tag: "2.0.1"},
+				Ingress: cassandraaxonopscomv1.Ingress{
+					Enabled:          true,
+					Annotations:      map[string]string{"example.com/ingress": "dashboard"},
+					Labels:           map[string]string{"exposed": "public"},
+					IngressClassName: "nginx",
+					Hosts:            []string{"axonops.example.com", "dashboard.example.com"},
+				},
+				Labels:      map[string]string{"team": "monitoring"},
+				Annotations: map[string]string{"example.com/owner": "monitoring"},
+				Env:         env,
+				EnvFrom:     envFrom,
+				Resources:   resources,
+			},
+			Server: cassandraaxonopscomv1.AxonOpsServer{
+				Image:       cassandraaxonopscomv1.ContainerImage{Repository: "example.com/axon-server", Tag: "2.0.3"},
+				Labels:      map[string]string{"team": "monitoring"},
+				Annotations: map[string]string{"example.com/owner": "monitoring"},
+				Env:         env,
+				EnvFrom:     envFrom,
+				Resources:   resources,
+				MetricsStore: cassandraaxonopscomv1.MetricsStore{
+					Enabled:          true,
+					Replicas:         2,
+					PersistentVolume: cassandraaxonopscomv1.PersistentVolumeSpec{Size: quantity("5Gi")},
+					Labels:           map[string]string{"store": "metrics"},
+					Env:              env,
+					EnvFrom:          envFrom,
+				},
+			},
+			Elasticsearch: cassandraaxonopscomv1.Elasticsearch{
+				Image:            cassandraaxonopscomv1.ContainerImage{Repository: "example.com/elasticsearch", Tag: "7.17.9"},
+				PersistentVolume: cassandraaxonopscomv1.PersistentVolumeSpec{StorageClass: "standard", Size: quantity("10Gi")},
+				JavaOpts:         "-Xms1g -Xmx1g",
+				ClusterName:      "search",
+				Env:              env,
+				EnvFrom:          envFrom,
+				Resources:        resources,
+			},
+		},
+	}
+}
+
+// datacentersSpec spreads the cluster over two datacenters, one of them with racks
+func datacentersSpec() cassandraaxonopscomv1.AxonOpsCassandraSpec {
+	return cassandraaxonopscomv1.AxonOpsCassandraSpec{
+		Cassandra: cassandraaxonopscomv1.AxonOpsCassandraCluster{
+			Datacenters: []cassandraaxonopscomv1.Datacenter{
+				{Name: "east", Replicas: 3},
+				{
+					Name: "west",
+					Racks: []cassandraaxonopscomv1.Rack{
+						{Name: "a", Replicas: 2, Zone: "west-a"},
+						{Name: "b", Replicas: 2, Zone: "west-b"},
+					},
+					PersistentVolume: cassandraaxonopscomv1.PersistentVolumeSpec{Size: quantity("50Gi")},
+					HeapSize:         "2G",
+				},
+			},
+			JVM: &cassandraaxonopscomv1.JVMOptions{
+				Heap:    cassandraaxonopscomv1.JVMHeapAuto,
+				GC:      cassandraaxonopscomv1.GarbageCollectorG1,
+				Options: []string{"-XX:+AlwaysPreTouch"},
+			},
+		},
+	}
+}
+
+// metricsStoreSpec enables the metrics store of an environment stored before the defaults were
+// written, its Cassandra cluster keeps the data center the controller used to give it
+func metricsStoreSpec() cassandraaxonopscomv1.AxonOpsCassandraSpec {
+	return cassandraaxonopscomv1.AxonOpsCassandraSpec{
+		AxonOps: cassandraaxonopscomv1.AxonOpsCluster{
+			Server: cassandraaxonopscomv1.AxonOpsServer{
+				MetricsStore: cassandraaxonopscomv1.MetricsStore{Enabled: true},
+			},
+		},
+	}
+}
+
+// agentTLSSpec only encrypts the connections of the agents, the nodes need their keystore
+// without any other setting requiring the configuration to be merged
+func agentTLSSpec() cassandraaxonopscomv1.AxonOpsCassandraSpec {
+	return cassandraaxonopscomv1.AxonOpsCassandraSpec{
+		Cassandra: cassandraaxonopscomv1.AxonOpsCassandraCluster{
+			TLS: cassandraaxonopscomv1.TLS{Agent: true},
+		},
+	}
+}
+
+// quotingSpec has label and annotation values which are not plain YAML strings, they broke
+// the documents or changed type when the objects were rendered from templates
+func quotingSpec() cassandraaxonopscomv1.AxonOpsCassandraSpec {
+	labels := map[string]string{"enabled": "true", "version": "1.10", "port": "9042", "empty": ""}
+	annotations := map[string]string{
+		"example.com/config": `{"replicas": 3}`,
+		"example.com/note":   "key: value # not a comment",
+		"example.com/list":   "- item",
+		"example.com/quote":  `it's "quoted"`,
+	}
+	return cassandraaxonopscomv1.AxonOpsCassandraSpec{
+		Cassandra: cassandraaxonopscomv1.AxonOpsCassandraCluster{Labels: labels, Annotations: annotations},
+		AxonOps: cassandraaxonopscomv1.AxonOpsCluster{
+			Dashboard: cassandraaxonopscomv1.AxonOpsDashboard{
+				Labels:      labels,
+				Annotations: annotations,
+				Ingress: cassandraaxonopscomv1.Ingress{
+					Enabled:     true,
+					Labels:      labels,
+					Annotations: annotations,
+					Hosts:       []string{"axonops.example.com"},
+				},
+			},
+			Server: cassandraaxonopscomv1.AxonOpsServer{Labels: labels, Annotations: annotations},
+		},
+	}
+}
+
+var _ = Describe("Generators", func() {
+	DescribeTable("should build the objects of the golden file",
+		func(name string, spec cassandraaxonopscomv1.AxonOpsCassandraSpec, defaults bool) {
+			cr := newCassandra(spec)
+			if defaults {
+				SetDefaults(&cr)
+			}
+			expectGolden(name, generateAll(cr))
+		},
+		Entry("for an empty spec", "empty", cassandraaxonopscomv1.AxonOpsCassandraSpec{}, false),
+		Entry("for the defaults", "defaults", cassandraaxonopscomv1.AxonOpsCassandraSpec{}, true),
+		Entry("for a full spec", "full", fullSpec(), true),
+		Entry("for datacenters", "datacenters", datacentersSpec(), true),
+		Entry("for labels and annotations needing quotes", "quoting", quotingSpec(), true),
+		Entry("for agent-only TLS", "agenttls", agentTLSSpec(), true),
+		Entry("for a metrics store stored without a data center", "metricsdc", metricsStoreSpec(), false),
+	)
+})
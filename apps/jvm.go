@@ -0,0 +1,209 @@
+/*
+Copyright 2024 AxonOps Limited
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package apps
+
+import (
+	"fmt"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+
+	cassandraaxonopscomv1 "github.com/axonops/axonops-developer-operator/api/v1"
+	"github.com/axonops/axonops-developer-operator/utils"
+	"k8s.io/apimachinery/pkg/api/resource"
+)
+
+// Options files of the image the JVM options of the spec are written to
+const (
+	jvmServerOptionsFile   = "jvm-server.options"
+	jvm11ServerOptionsFile = "jvm11-server.options"
+	jvm17ServerOptionsFile = "jvm17-server.options"
+	jvmReplacedOptionsFile = "replaced-options"
+)
+
+// heapSizePattern matches the sizes accepted by MAX_HEAP_SIZE, the same format as -Xmx
+var heapSizePattern = regexp.MustCompile(`^(\d+)([kKmMgG]?)$`)
+
+// gcOptionPattern matches the options of the garbage collectors in the options files of the
+// image, they are all dropped when a garbage collector is set in the spec
+const gcOptionPattern = `^-XX:[+-]?(UseConcMarkSweepGC|UseParNewGC|CMS[A-Za-z]*|UseCMSInitiatingOccupancyOnly|SurvivorRatio|` +
+	`MaxTenuringThreshold|UseG1GC|G1[A-Za-z]*|MaxGCPauseMillis|InitiatingHeapOccupancyPercent|ParallelRefProcEnabled|` +
+	`UseZGC|ZGenerational)(=|$)`
+
+// gcOptions are the options of each garbage collector, the ones of the options files of
+// Cassandra
+var gcOptions = map[cassandraaxonopscomv1.GarbageCollector][]string{
+	cassandraaxonopscomv1.GarbageCollectorG1: {
+		"-XX:+UseG1GC",
+		"-XX:+ParallelRefProcEnabled",
+		"-XX:MaxTenuringThreshold=1",
+		"-XX:G1HeapRegionSize=16m",
+		"-XX:MaxGCPauseMillis=300",
+		"-XX:InitiatingHeapOccupancyPercent=70",
+	},
+	cassandraaxonopscomv1.GarbageCollectorCMS: {
+		"-XX:+UseConcMarkSweepGC",
+		"-XX:+CMSParallelRemarkEnabled",
+		"-XX:SurvivorRatio=8",
+		"-XX:MaxTenuringThreshold=1",
+		"-XX:CMSInitiatingOccupancyFraction=75",
+		"-XX:+UseCMSInitiatingOccupancyOnly",
+		"-XX:CMSWaitDuration=10000",
+		"-XX:+CMSParallelInitialMarkEnabled",
+		"-XX:+CMSEdenChunksRecordAlways",
+		"-XX:+CMSClassUnloadingEnabled",
+	},
+	cassandraaxonopscomv1.GarbageCollectorZGC: {
+		"-XX:+UseZGC",
+	},
+}
+
+// JVMHeapOptions lists the options sizing the heap, the operator sets them
+var JVMHeapOptions = []string{"-Xms", "-Xmx", "-Xmn"}
+
+// ParseHeapSize converts a heap size such as 512M or 2G into bytes
+func ParseHeapSize(size string) (int64, bool) {
+	m := heapSizePattern.FindStringSubmatch(size)
+	if m == nil {
+		return 0, false
+	}
+	value, err := strconv.ParseInt(m[1], 10, 64)
+	if err != nil || value <= 0 {
+		return 0, false
+	}
+	switch strings.ToUpper(m[2]) {
+	case "K":
+		value <<= 10
+	case "M":
+		value <<= 20
+	case "G":
+		value <<= 30
+	}
+	return value, true
+}
+
+// jvmHeap returns the heap and the young generation of the nodes in MiB. The young generation
+// is sized like cassandra-env.sh does: 100M per core up to a quarter of the heap.
+func jvmHeap(cfg cassandraaxonopscomv1.AxonOpsCassandraCluster) (int64, int64) {
+	var heap int64
+	if cfg.JVM != nil && cfg.JVM.Heap == cassandraaxonopscomv1.JVMHeapAuto {
+		memory := resource.MustParse(cassandraResources.memoryLimit)
+		if limit := cfg.Resources.Limits.Memory(); !limit.IsZero() {
+			memory = *limit
+		}
+		ram := memory.Value() >> 20
+		heap = max(min(ram/2, 1024), min(ram/4, 8192))
+	} else {
+		size, ok := ParseHeapSize(utils.ValueOrDefault(cfg.HeapSize, defaultHeapSize))
+		if !ok {
+			size, _ = ParseHeapSize(defaultHeapSize)
+		}
+		heap = max(size>>20, 1)
+	}
+
+	cpu := resource.MustParse(cassandraResources.cpuLimit)
+	if limit := cfg.Resources.Limits.Cpu(); !limit.IsZero() {
+		cpu = *limit
+	}
+	cores := max((cpu.MilliValue()+999)/1000, 1)
+	return heap, max(min(cores*100, heap/4), 1)
+}
+
+// heapNewSize returns the HEAP_NEWSIZE of the nodes whose heap is set in the environment
+func heapNewSize(cfg cassandraaxonopscomv1.AxonOpsCassandraCluster) string {
+	_, newGen := jvmHeap(cfg)
+	return fmt.Sprintf("%dM", newGen)
+}
+
+// jvmHeapOptions returns the options sizing the heap of the nodes, the young generation is
+// only set for CMS as G1 and ZGC size it themselves
+func jvmHeapOptions(cfg cassandraaxonopscomv1.AxonOpsCassandraCluster) string {
+	heap, newGen := jvmHeap(cfg)
+	options := fmt.Sprintf("-Xms%dM -Xmx%dM", heap, heap)
+	if jvmGarbageCollector(cfg) == cassandraaxonopscomv1.GarbageCollectorCMS {
+		options += fmt.Sprintf(" -Xmn%dM", newGen)
+	}
+	return options
+}
+
+// jvmGarbageCollector returns the garbage collector of the nodes: the one of the spec or the
+// default of the options files of the Cassandra version, CMS before 5.0 and G1 since
+func jvmGarbageCollector(cfg cassandraaxonopscomv1.AxonOpsCassandraCluster) cassandraaxonopscomv1.GarbageCollector {
+	if cfg.JVM != nil && cfg.JVM.GC != "" {
+		return cfg.JVM.GC
+	}
+	switch version, _ := CassandraVersion(cfg.Image.Tag); version {
+	case "4.0", "4.1":
+		return cassandraaxonopscomv1.GarbageCollectorCMS
+	case "5.0":
+		return cassandraaxonopscomv1.GarbageCollectorG1
+	}
+	return ""
+}
+
+// jvmOptionPattern returns the pattern matching the lines of an options file setting the
+// same option: -XX:+Flag and -XX:-Flag, -XX:Name=, -Dname= and the -X sizes such as -Xss
+func jvmOptionPattern(option string) string {
+	switch {
+	case strings.HasPrefix(option, "-XX:+") || strings.HasPrefix(option, "-XX:-"):
+		return `^-XX:[+-]` + regexp.QuoteMeta(option[len("-XX:+"):]) + `$`
+	case strings.HasPrefix(option, "-XX:") && strings.Contains(option, "="):
+		return `^` + regexp.QuoteMeta(option[:strings.Index(option, "=")+1])
+	case strings.HasPrefix(option, "-D"):
+		name, _, _ := strings.Cut(option, "=")
+		return `^` + regexp.QuoteMeta(name) + `(=|$)`
+	}
+	for _, size := range []string{"-Xms", "-Xmx", "-Xmn", "-Xss"} {
+		if strings.HasPrefix(option, size) {
+			return `^` + size
+		}
+	}
+	return `^` + regexp.QuoteMeta(option) + `$`
+}
+
+// jvmOptionsFiles returns the options added to each options file of the image and the
+// patterns of the lines of the files they replace
+func jvmOptionsFiles(jvm *cassandraaxonopscomv1.JVMOptions) (map[string]string, []string) {
+	files := map[string]string{}
+	replaced := []string{}
+	for _, size := range JVMHeapOptions {
+		replaced = append(replaced, `^`+size)
+	}
+
+	server := []string{}
+	if jvm.GC != "" {
+		replaced = append(replaced, gcOptionPattern)
+		server = append(server, gcOptions[jvm.GC]...)
+	}
+	server = append(server, jvm.Options...)
+	for file, options := range map[string][]string{
+		jvmServerOptionsFile:   server,
+		jvm11ServerOptionsFile: jvm.JVM11Options,
+		jvm17ServerOptionsFile: jvm.JVM17Options,
+	} {
+		if len(options) == 0 {
+			continue
+		}
+		for _, option := range options {
+			replaced = append(replaced, jvmOptionPattern(option))
+		}
+		files[file] = strings.Join(options, "\n") + "\n"
+	}
+	slices.Sort(replaced)
+	return files, slices.Compact(replaced)
+}
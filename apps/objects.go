@@ -0,0 +1,115 @@
+/*
+ Copyright 2024 AxonOps Limited
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+      https://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package apps
+
+import (
+	cassandraaxonopscomv1 "github.com/axonops/axonops-developer-operator/api/v1"
+	"github.com/axonops/axonops-developer-operator/utils"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// dataVolume is the volume the StatefulSets keep their data in when it is persisted
+const dataVolume = "data"
+
+// objectMeta returns the metadata of a generated object. The labels are merged in order so
+// the labels of the spec come after the ones identifying the component.
+func objectMeta(name string, namespace string, annotations map[string]string, labels ...map[string]string) metav1.ObjectMeta {
+	return metav1.ObjectMeta{
+		Name:        name,
+		Namespace:   namespace,
+		Labels:      mergeLabels(labels...),
+		Annotations: copyAnnotations(annotations),
+	}
+}
+
+func mergeLabels(labels ...map[string]string) map[string]string {
+	merged := map[string]string{}
+	for _, l := range labels {
+		utils.MergeMap(merged, l)
+	}
+	return merged
+}
+
+// copyAnnotations returns a copy of the annotations of the spec, nil when there are none
+func copyAnnotations(annotations map[string]string) map[string]string {
+	if len(annotations) == 0 {
+		return nil
+	}
+	copied := map[string]string{}
+	utils.MergeMap(copied, annotations)
+	return copied
+}
+
+// containerResources returns the cpu and memory requests and limits of the spec. The
+// quantities it does not set are 0, SetDefaults fills them in when the object is admitted.
+func containerResources(spec corev1.ResourceRequirements) corev1.ResourceRequirements {
+	return corev1.ResourceRequirements{
+		Limits: corev1.ResourceList{
+			corev1.ResourceCPU:    resource.MustParse(spec.Limits.Cpu().String()),
+			corev1.ResourceMemory: resource.MustParse(spec.Limits.Memory().String()),
+		},
+		Requests: corev1.ResourceList{
+			corev1.ResourceCPU:    resource.MustParse(spec.Requests.Cpu().String()),
+			corev1.ResourceMemory: resource.MustParse(spec.Requests.Memory().String()),
+		},
+	}
+}
+
+// nodeNameEnv exposes the name of the pod to the container
+func nodeNameEnv() corev1.EnvVar {
+	return corev1.EnvVar{
+		Name:      "node.name",
+		ValueFrom: &corev1.EnvVarSource{FieldRef: &corev1.ObjectFieldSelector{FieldPath: "metadata.name"}},
+	}
+}
+
+// dataVolumeClaims returns the claim of the data volume mounted by a StatefulSet, none when
+// the persistent volume has no size and the data is not persisted
+func dataVolumeClaims(volume cassandraaxonopscomv1.PersistentVolumeSpec) []corev1.PersistentVolumeClaim {
+	if volume.Size == nil {
+		return nil
+	}
+	claim := corev1.PersistentVolumeClaim{
+		ObjectMeta: metav1.ObjectMeta{Name: dataVolume},
+		Spec: corev1.PersistentVolumeClaimSpec{
+			AccessModes: []corev1.PersistentVolumeAccessMode{corev1.ReadWriteOnce},
+			Resources: corev1.VolumeResourceRequirements{
+				Requests: corev1.ResourceList{corev1.ResourceStorage: resource.MustParse(volume.Size.String())},
+			},
+		},
+	}
+	if volume.StorageClass != "" {
+		claim.Spec.StorageClassName = &volume.StorageClass
+	}
+	return []corev1.PersistentVolumeClaim{claim}
+}
+
+// DataVolumeClaimName returns the name of the PersistentVolumeClaim the StatefulSet controller
+// creates for the data of a pod
+func DataVolumeClaimName(pod string) string {
+	return dataVolume + "-" + pod
+}
+
+// dataVolumeMounts mounts the data volume at path when the data is persisted
+func dataVolumeMounts(volume cassandraaxonopscomv1.PersistentVolumeSpec, path string) []corev1.VolumeMount {
+	if volume.Size == nil {
+		return nil
+	}
+	return []corev1.VolumeMount{{Name: dataVolume, MountPath: path}}
+}
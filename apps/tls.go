@@ -0,0 +1,300 @@
+/*
+Copyright 2024 AxonOps Limited
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package apps
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+
+	cassandraaxonopscomv1 "github.com/axonops/axonops-developer-operator/api/v1"
+	"github.com/axonops/axonops-developer-operator/utils"
+)
+
+// Keys of the Secret holding the keystores of the nodes. Every node has its keystore, its
+// certificate and its private key under its pod name, e.g. ca-<name>-0.p12.
+const (
+	TLSTruststoreKey = "truststore.p12"
+	TLSCAKey         = "ca.crt"
+	TLSPasswordKey   = "password"
+)
+
+// CqlshrcPath is the cqlshrc written next to cassandra.yaml when TLS is enabled, cqlsh reads
+// the certificates of the node from it
+const CqlshrcPath = cassandraConfigDir + "/cqlshrc"
+
+const (
+	cassandraTLSVolume  = "tls"
+	cassandraTLSDir     = cassandraConfigDir + "/tls"
+	keystorePasswordEnv = "CASSANDRA_KEYSTORE_PASSWORD"
+	// keystorePassword stands for the password of the keystores in the ConfigMap, the init
+	// container replaces it with the password of the Secret
+	keystorePassword = "@KEYSTORE_PASSWORD@"
+)
+
+// cassandraTLSScript copies the keystore of the node and the truststore to the configuration
+// directory, fills in their password and points cqlsh to the certificates of the node
+const cassandraTLSScript = `mkdir -p /config/tls
+cp /tls/` + TLSCAKey + ` /tls/` + TLSTruststoreKey + ` /tls/keystore.p12 /tls/node.crt /tls/node.key /config/tls/
+sed -i "s/` + keystorePassword + `/$` + keystorePasswordEnv + `/g" /config/cassandra.yaml
+cat > /config/cqlshrc <<EOF
+[connection]
+ssl = true
+[ssl]
+certfile = ` + cassandraTLSDir + `/ca.crt
+validate = false
+userkey = ` + cassandraTLSDir + `/node.key
+usercert = ` + cassandraTLSDir + `/node.crt
+EOF
+`
+
+// CertificateGVK is the cert-manager Certificate issuing the certificate of a node. The
+// operator does not depend on the cert-manager API, the Certificates are unstructured.
+var CertificateGVK = schema.GroupVersionKind{Group: "cert-manager.io", Version: "v1", Kind: "Certificate"}
+
+// Settings of cassandra.yaml configuring the encryption of the client connections and of the
+// connections between the nodes, they cannot be set in the config field once enabled
+const (
+	ClientEncryptionSetting = "client_encryption_options"
+	ServerEncryptionSetting = "server_encryption_options"
+)
+
+// agentTLSMode is the AXON_AGENT_TLS_MODE of the agents connecting to the server over TLS,
+// they connect in clear text with the none mode set by GenerateCassandraConfig otherwise
+const agentTLSMode = "TLS"
+
+// serverTLSDir is where the certificate of the AxonOps server is mounted
+const serverTLSDir = "/etc/axonops/tls"
+
+// TLSRequired tells if the nodes need their keystore, for any of the encrypted connections
+func TLSRequired(cfg cassandraaxonopscomv1.AxonOpsCassandraCluster) bool {
+	return cfg.TLS.Enabled || cfg.TLS.Internode || cfg.TLS.Agent
+}
+
+// ServerCertificateNode is the name of the certificate of the AxonOps server in the keystores
+// Secret, it is issued with the certificates of the nodes
+func ServerCertificateNode(name string) string {
+	return "as-" + name
+}
+
+// CassandraCASecretName returns the name of the Secret of the certificate authority the
+// operator generates
+func CassandraCASecretName(name string) string {
+	return "ca-" + name + "-ca"
+}
+
+// CassandraKeystoresSecretName returns the name of the Secret of the keystores of the nodes
+func CassandraKeystoresSecretName(name string) string {
+	return "ca-" + name + "-keystores"
+}
+
+// ServerTLSSecretName returns the name of the Secret of the certificate of the AxonOps server,
+// it is kept apart from the keystores of the nodes so they never get its key
+func ServerTLSSecretName(name string) string {
+	return "as-" + name + "-server-tls"
+}
+
+// NodeCertificateName returns the name of the cert-manager Certificate of a node and of the
+// Secret cert-manager writes it to
+func NodeCertificateName(pod string) string {
+	return pod + "-tls"
+}
+
+// NodeDNSNames returns the names a node is reached by: its name in the headless service and
+// the name of the service of the cluster. The AxonOps server is reached by its service.
+func NodeDNSNames(name string, namespace string, pod string) []string {
+	if pod == ServerCertificateNode(name) {
+		service := fmt.Sprintf("%s.%s.svc", pod, namespace)
+		return []string{pod, service, service + ".cluster.local"}
+	}
+	headless := fmt.Sprintf("%s.ca-%s-headless.%s.svc", pod, name, namespace)
+	service := fmt.Sprintf("ca-%s.%s.svc", name, namespace)
+	return []string{pod, headless, headless + ".cluster.local", "ca-" + name, service, service + ".cluster.local"}
+}
+
+// GenerateNodeCertificate renders the cert-manager Certificate of a node, cert-manager writes
+// the certificate, its key and the certificate of the issuer to the Secret of the same name
+func GenerateNodeCertificate(name string, namespace string, pod string, cfg cassandraaxonopscomv1.AxonOpsCassandraCluster) *unstructured.Unstructured {
+	issuer := cfg.TLS.IssuerRef
+	dnsNames := []interface{}{}
+	for _, dnsName := range NodeDNSNames(name, namespace, pod) {
+		dnsNames = append(dnsNames, dnsName)
+	}
+	labels := map[string]interface{}{"app": "ds-" + name, "component": "cassandra"}
+	for k, v := range cfg.Labels {
+		labels[k] = v
+	}
+	certificate := &unstructured.Unstructured{Object: map[string]interface{}{
+		"metadata": map[string]interface{}{
+			"name":      NodeCertificateName(pod),
+			"namespace": namespace,
+			"labels":    labels,
+		},
+		"spec": map[string]interface{}{
+			"secretName": NodeCertificateName(pod),
+			"commonName": pod,
+			"dnsNames":   dnsNames,
+			"usages":     []interface{}{"server auth", "client auth", "digital signature", "key encipherment"},
+			"privateKey": map[string]interface{}{"algorithm": "ECDSA", "size": int64(256), "encoding": "PKCS8"},
+			"issuerRef": map[string]interface{}{
+				"name":  issuer.Name,
+				"kind":  utils.ValueOrDefault(issuer.Kind, "Issuer"),
+				"group": utils.ValueOrDefault(issuer.Group, CertificateGVK.Group),
+			},
+		},
+	}}
+	certificate.SetGroupVersionKind(CertificateGVK)
+	return certificate
+}
+
+// withTLSSettings adds the client and the internode encryption options to the cassandra.yaml
+// settings. The nodes keep the SSL storage port 7001 for the encrypted connections between
+// them and require each other's certificate.
+func withTLSSettings(cfg cassandraaxonopscomv1.AxonOpsCassandraCluster, config map[string]apiextensionsv1.JSON) (map[string]apiextensionsv1.JSON, error) {
+	if !cfg.TLS.Enabled && !cfg.TLS.Internode {
+		return config, nil
+	}
+	settings := map[string]apiextensionsv1.JSON{}
+	for k, v := range config {
+		settings[k] = v
+	}
+	if cfg.TLS.Enabled {
+		options := keystoreOptions()
+		options["enabled"] = true
+		options["optional"] = cfg.TLS.Optional
+		options["require_client_auth"] = cfg.TLS.RequireClientAuth
+		raw, err := json.Marshal(options)
+		if err != nil {
+			return nil, err
+		}
+		settings[ClientEncryptionSetting] = apiextensionsv1.JSON{Raw: raw}
+	}
+	if cfg.TLS.Internode {
+		options := keystoreOptions()
+		options["internode_encryption"] = "all"
+		options["enable_legacy_ssl_storage_port"] = true
+		options["optional"] = cfg.TLS.Optional
+		options["require_client_auth"] = true
+		raw, err := json.Marshal(options)
+		if err != nil {
+			return nil, err
+		}
+		settings[ServerEncryptionSetting] = apiextensionsv1.JSON{Raw: raw}
+	}
+	return settings, nil
+}
+
+// keystoreOptions are the encryption options pointing to the keystore of the node and to
+// the truststore, shared by the client and the internode encryption
+func keystoreOptions() map[string]interface{} {
+	return map[string]interface{}{
+		"keystore":            cassandraTLSDir + "/keystore.p12",
+		"keystore_password":   keystorePassword,
+		"truststore":          cassandraTLSDir + "/truststore.p12",
+		"truststore_password": keystorePassword,
+		"store_type":          "PKCS12",
+	}
+}
+
+// mountTLS gives the keystore of its node to the init container merging the configuration,
+// which copies it next to cassandra.yaml. The keystores Secret holds the keys of every node,
+// the init container only mounts the files of its own pod and the ones shared by the nodes.
+func mountTLS(pod *corev1.PodSpec, name string) {
+	secret := CassandraKeystoresSecretName(name)
+	for i := range pod.InitContainers {
+		container := &pod.InitContainers[i]
+		if container.Name != CassandraConfigContainer {
+			continue
+		}
+		script := container.Command[len(container.Command)-1]
+		container.Command[len(container.Command)-1] = strings.TrimSuffix(script, "\n") + "\n" + cassandraTLSScript
+		container.Env = append(container.Env,
+			corev1.EnvVar{
+				Name:      "POD_NAME",
+				ValueFrom: &corev1.EnvVarSource{FieldRef: &corev1.ObjectFieldSelector{FieldPath: "metadata.name"}},
+			},
+			corev1.EnvVar{
+				Name: keystorePasswordEnv,
+				ValueFrom: &corev1.EnvVarSource{SecretKeyRef: &corev1.SecretKeySelector{
+					LocalObjectReference: corev1.LocalObjectReference{Name: secret},
+					Key:                  TLSPasswordKey,
+				}},
+			},
+		)
+		container.VolumeMounts = append(container.VolumeMounts,
+			corev1.VolumeMount{Name: cassandraTLSVolume, MountPath: "/tls/" + TLSCAKey, SubPath: TLSCAKey, ReadOnly: true},
+			corev1.VolumeMount{Name: cassandraTLSVolume, MountPath: "/tls/" + TLSTruststoreKey, SubPath: TLSTruststoreKey, ReadOnly: true},
+			corev1.VolumeMount{Name: cassandraTLSVolume, MountPath: "/tls/keystore.p12", SubPathExpr: "$(POD_NAME).p12", ReadOnly: true},
+			corev1.VolumeMount{Name: cassandraTLSVolume, MountPath: "/tls/node.crt", SubPathExpr: "$(POD_NAME).crt", ReadOnly: true},
+			corev1.VolumeMount{Name: cassandraTLSVolume, MountPath: "/tls/node.key", SubPathExpr: "$(POD_NAME).key", ReadOnly: true},
+		)
+	}
+	pod.Volumes = append(pod.Volumes, corev1.Volume{
+		Name:         cassandraTLSVolume,
+		VolumeSource: corev1.VolumeSource{Secret: &corev1.SecretVolumeSource{SecretName: secret}},
+	})
+}
+
+// setAgentTLS switches the AxonOps agent of the Cassandra container to TLS, it presents the
+// certificate of its node to the server and checks the certificate of the server
+func setAgentTLS(pod *corev1.PodSpec) {
+	for i := range pod.Containers {
+		container := &pod.Containers[i]
+		if container.Name != "cassandra" {
+			continue
+		}
+		for j := range container.Env {
+			if container.Env[j].Name == "AXON_AGENT_TLS_MODE" {
+				container.Env[j].Value = agentTLSMode
+			}
+		}
+		container.Env = append(container.Env,
+			corev1.EnvVar{Name: "AXON_AGENT_TLS_CAFILE", Value: cassandraTLSDir + "/ca.crt"},
+			corev1.EnvVar{Name: "AXON_AGENT_TLS_CERTFILE", Value: cassandraTLSDir + "/node.crt"},
+			corev1.EnvVar{Name: "AXON_AGENT_TLS_KEYFILE", Value: cassandraTLSDir + "/node.key"},
+		)
+	}
+}
+
+// MountServerTLS gives its certificate to the AxonOps server and requires the agents to present
+// a certificate of the same authority
+func MountServerTLS(pod *corev1.PodSpec, name string) {
+	for i := range pod.Containers {
+		container := &pod.Containers[i]
+		if container.Name != "axon-server" {
+			continue
+		}
+		container.Env = append(container.Env,
+			corev1.EnvVar{Name: "AXON_SERVER_TLS_MODE", Value: agentTLSMode},
+			corev1.EnvVar{Name: "AXON_SERVER_TLS_CAFILE", Value: serverTLSDir + "/" + TLSCAKey},
+			corev1.EnvVar{Name: "AXON_SERVER_TLS_CERTFILE", Value: serverTLSDir + "/" + corev1.TLSCertKey},
+			corev1.EnvVar{Name: "AXON_SERVER_TLS_KEYFILE", Value: serverTLSDir + "/" + corev1.TLSPrivateKeyKey},
+		)
+		container.VolumeMounts = append(container.VolumeMounts, corev1.VolumeMount{Name: cassandraTLSVolume, MountPath: serverTLSDir, ReadOnly: true})
+	}
+	pod.Volumes = append(pod.Volumes, corev1.Volume{
+		Name: cassandraTLSVolume,
+		VolumeSource: corev1.VolumeSource{Secret: &corev1.SecretVolumeSource{
+			SecretName: ServerTLSSecretName(name),
+		}},
+	})
+}
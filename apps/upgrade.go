@@ -0,0 +1,84 @@
+/*
+Copyright 2024 AxonOps Limited
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package apps
+
+import (
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/axonops/axonops-developer-operator/utils"
+)
+
+// CassandraVersions lists the Apache Cassandra major releases the generated StatefulSets can run, in
+// the order they are upgraded: a cluster only moves to the next version
+var CassandraVersions = []string{"4.0", "4.1", "5.0"}
+
+// cassandraVersionPattern extracts the major and minor version from an image tag like 5.0.2 or 4.1-jammy
+var cassandraVersionPattern = regexp.MustCompile(`^v?(\d+)\.(\d+)`)
+
+// CassandraVersion returns the major.minor version of an image tag, the default tag when it
+// is empty. It returns false for the tags that do not start with a version such as latest.
+func CassandraVersion(tag string) (string, bool) {
+	m := cassandraVersionPattern.FindStringSubmatch(utils.ValueOrDefault(tag, defaultCassandraTag))
+	if m == nil {
+		return "", false
+	}
+	return m[1] + "." + m[2], true
+}
+
+// IsCassandraMajorUpgrade tells if moving from one image tag to the other changes the major
+// version of Cassandra
+func IsCassandraMajorUpgrade(fromTag string, toTag string) bool {
+	from, okFrom := CassandraVersion(fromTag)
+	to, okTo := CassandraVersion(toTag)
+	return okFrom && okTo && from != to
+}
+
+// ValidateCassandraUpgrade returns why the image tag of a running cluster cannot be changed
+// from one tag to the other, or nil when the change is a supported upgrade or not a major
+// version change. The tags that are not versions cannot be checked and are accepted.
+func ValidateCassandraUpgrade(fromTag string, toTag string) error {
+	if !IsCassandraMajorUpgrade(fromTag, toTag) {
+		return nil
+	}
+	from, _ := CassandraVersion(fromTag)
+	to, _ := CassandraVersion(toTag)
+	i := slices.Index(CassandraVersions, from)
+	j := slices.Index(CassandraVersions, to)
+	switch {
+	case i < 0 || j < 0:
+		return fmt.Errorf("cannot upgrade Cassandra from %s to %s, the supported upgrades are %s",
+			from, to, strings.Join(CassandraVersions, " → "))
+	case j < i:
+		return fmt.Errorf("cannot downgrade Cassandra from %s to %s", from, to)
+	case j > i+1:
+		return fmt.Errorf("cannot upgrade Cassandra from %s to %s, upgrade to %s first", from, to, CassandraVersions[i+1])
+	}
+	return nil
+}
+
+// CassandraImageTag returns the tag of a Cassandra image reference, e.g. 5.0.2 for
+// ghcr.io/axonops/cassandra:5.0.2, or latest when it has none
+func CassandraImageTag(image string) string {
+	name := image[strings.LastIndex(image, "/")+1:]
+	if i := strings.LastIndex(name, ":"); i >= 0 {
+		return name[i+1:]
+	}
+	return "latest"
+}
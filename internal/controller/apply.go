@@ -0,0 +1,165 @@
+/*
+Copyright AxonOps Limited 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"fmt"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/apiutil"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+
+	cassandraaxonopscomv1 "github.com/axonops/axonops-developer-operator/api/v1"
+	"github.com/axonops/axonops-developer-operator/utils"
+)
+
+// fieldManager is the server-side apply field manager used for every object the operator writes
+const fieldManager = "axonops-developer-operator"
+
+// appliedHashAnnotation records the hash of the configuration last applied to an object.
+// It lets the operator skip the apply entirely when nothing changed.
+const appliedHashAnnotation = "axonops.com/applied-hash"
+
+// applyOwned sets the AxonOpsCassandra as the controller of obj, so that it is garbage
+// collected with it and the Owns watches fire, and server-side applies it. Only the fields
+// rendered by the operator are sent, so fields managed by someone else are left alone.
+// Nothing is written when the live object was generated from the same configuration,
+// unless it was modified since and the drift policy asks for it to be reverted. The dry-run
+// that looks for such modifications only runs when the live object changed since it was last
+// found without drift.
+func (r *AxonOpsCassandraReconciler) applyOwned(ctx context.Context, owner *cassandraaxonopscomv1.AxonOpsCassandra, obj client.Object, drift *driftReport) (controllerutil.OperationResult, error) {
+	if err := ctrl.SetControllerReference(owner, obj, r.Scheme); err != nil {
+		return controllerutil.OperationResultNone, err
+	}
+
+	desired, err := r.toApplyConfiguration(obj)
+	if err != nil {
+		return controllerutil.OperationResultNone, r.recordFailure(ctx, owner, eventRenderFailed,
+			fmt.Sprintf("Failed to convert %s", obj.GetName()), err)
+	}
+	kind := desired.GetKind()
+	hash, err := utils.HashObject(desired.Object)
+	if err != nil {
+		return controllerutil.OperationResultNone, r.recordFailure(ctx, owner, eventRenderFailed,
+			fmt.Sprintf("Failed to hash %s %s", kind, obj.GetName()), err)
+	}
+	annotations := desired.GetAnnotations()
+	if annotations == nil {
+		annotations = map[string]string{}
+	}
+	annotations[appliedHashAnnotation] = hash
+	desired.SetAnnotations(annotations)
+
+	live, ok := obj.DeepCopyObject().(client.Object)
+	if !ok {
+		return controllerutil.OperationResultNone, fmt.Errorf("unexpected object type %T", obj)
+	}
+	result := controllerutil.OperationResultUpdated
+	err = r.Get(ctx, client.ObjectKeyFromObject(obj), live)
+	switch {
+	case apierrors.IsNotFound(err):
+		result = controllerutil.OperationResultCreated
+		live = nil
+	case err != nil:
+		return controllerutil.OperationResultNone, r.recordFailure(ctx, owner, eventUpdateFailed,
+			fmt.Sprintf("Failed to get %s %s", kind, obj.GetName()), err)
+	case live.GetAnnotations()[appliedHashAnnotation] == hash:
+		if drift == nil || drift.policy == cassandraaxonopscomv1.DriftPolicyIgnore {
+			return controllerutil.OperationResultNone, nil
+		}
+		checkedKey := kind + "/" + live.GetNamespace() + "/" + live.GetName()
+		if checked, ok := r.driftChecked.Load(checkedKey); ok && checked == live.GetResourceVersion() {
+			return controllerutil.OperationResultNone, nil
+		}
+		fields, err := r.detectDrift(ctx, desired, live)
+		if err != nil {
+			return controllerutil.OperationResultNone, r.recordFailure(ctx, owner, eventUpdateFailed,
+				fmt.Sprintf("Failed to check %s %s for drift", kind, obj.GetName()), err)
+		}
+		if len(fields) == 0 {
+			r.driftChecked.Store(checkedKey, live.GetResourceVersion())
+			return controllerutil.OperationResultNone, nil
+		}
+		r.driftChecked.Delete(checkedKey)
+		drift.resources = append(drift.resources, resourceDrift{
+			kind:   kind,
+			name:   desired.GetName(),
+			fields: fields,
+		})
+		if drift.policy != cassandraaxonopscomv1.DriftPolicyRevert {
+			return controllerutil.OperationResultNone, nil
+		}
+	}
+
+	if err := r.Apply(ctx, client.ApplyConfigurationFromUnstructured(desired),
+		client.FieldOwner(fieldManager), client.ForceOwnership); err != nil {
+		reason := eventUpdateFailed
+		if result == controllerutil.OperationResultCreated {
+			reason = eventCreateFailed
+		}
+		return controllerutil.OperationResultNone, r.recordFailure(ctx, owner, reason,
+			fmt.Sprintf("Failed to apply %s %s", kind, obj.GetName()), err)
+	}
+	r.recordApplied(owner, kind, live, obj, result)
+	return result, nil
+}
+
+// toApplyConfiguration converts a rendered object into the unstructured form sent with
+// server-side apply. The status and the null values introduced by the typed structs
+// (e.g. creationTimestamp) are dropped so the operator does not claim ownership of them.
+func (r *AxonOpsCassandraReconciler) toApplyConfiguration(obj client.Object) (*unstructured.Unstructured, error) {
+	gvk, err := apiutil.GVKForObject(obj, r.Scheme)
+	if err != nil {
+		return nil, err
+	}
+
+	content, err := runtime.DefaultUnstructuredConverter.ToUnstructured(obj)
+	if err != nil {
+		return nil, err
+	}
+	delete(content, "status")
+	pruneNulls(content)
+
+	u := &unstructured.Unstructured{Object: content}
+	u.SetGroupVersionKind(gvk)
+	u.SetResourceVersion("")
+	u.SetManagedFields(nil)
+	return u, nil
+}
+
+// pruneNulls removes every nil value from the map and the maps nested in it
+func pruneNulls(m map[string]interface{}) {
+	for k, v := range m {
+		switch value := v.(type) {
+		case nil:
+			delete(m, k)
+		case map[string]interface{}:
+			pruneNulls(value)
+		case []interface{}:
+			for _, item := range value {
+				if nested, ok := item.(map[string]interface{}); ok {
+					pruneNulls(nested)
+				}
+			}
+		}
+	}
+}
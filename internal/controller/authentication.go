@@ -0,0 +1,214 @@
+/*
+Copyright AxonOps Limited 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	cassandraaxonopscomv1 "github.com/axonops/axonops-developer-operator/api/v1"
+	"github.com/axonops/axonops-developer-operator/apps"
+)
+
+// defaultRole is the superuser Cassandra creates on the first boot of a cluster with
+// PasswordAuthenticator, its password is cassandra
+const defaultRole = "cassandra"
+
+// createSuperuserScript logs in with the default role to create the superuser of the Secret
+func createSuperuserScript(cr *cassandraaxonopscomv1.AxonOpsCassandra) string {
+	return fmt.Sprintf(
+		`%[1]s -u %[2]s -p %[2]s -e "CREATE ROLE IF NOT EXISTS \"$%[3]s\" WITH SUPERUSER = true AND LOGIN = true AND PASSWORD = '$%[4]s'"`,
+		cqlshCommand(cr), defaultRole, apps.SuperuserEnv, apps.SuperuserPasswordEnv)
+}
+
+// ensureSuperuserSecret creates the Secret holding the superuser credentials when
+// authentication is enabled. The Secret is never updated so the password is generated once,
+// it is removed with the AxonOpsCassandra.
+func (r *AxonOpsCassandraReconciler) ensureSuperuserSecret(ctx context.Context, cr *cassandraaxonopscomv1.AxonOpsCassandra,
+	report *nodeOperationReport) error {
+	if !cr.Spec.Cassandra.Authentication.Enabled {
+		report.authentication = nil
+		return nil
+	}
+	name := apps.CassandraSuperuserSecretName(cr.GetName())
+	err := r.Get(ctx, client.ObjectKey{Namespace: cr.GetNamespace(), Name: name}, &corev1.Secret{})
+	switch {
+	case apierrors.IsNotFound(err):
+		secret, err := apps.GenerateSuperuserSecret(cr.GetName(), cr.GetNamespace(), cr.Spec.Cassandra)
+		if err != nil {
+			return r.recordFailure(ctx, cr, eventRenderFailed, "Failed to generate the superuser password", err)
+		}
+		if err := ctrl.SetControllerReference(cr, secret, r.Scheme); err != nil {
+			return err
+		}
+		if err := r.Create(ctx, secret); err != nil && !apierrors.IsAlreadyExists(err) {
+			return r.recordFailure(ctx, cr, eventCreateFailed, fmt.Sprintf("Failed to create Secret %s", name), err)
+		}
+		r.Recorder.Eventf(cr, corev1.EventTypeNormal, eventCreated, "Created Secret %s", name)
+	case err != nil:
+		return err
+	}
+	if report.authentication == nil || report.authentication.Secret != name {
+		report.authentication = &cassandraaxonopscomv1.AuthenticationStatus{Secret: name}
+	}
+	return nil
+}
+
+// setupAuthentication replaces the default cassandra role with the superuser of the Secret
+// and replicates system_auth to every node of each datacenter, so a login does not depend on
+// a single node. It runs once every node is ready and runs the current pod template, which
+// enables the authentication and holds the credentials. The factor is lowered before a node
+// is decommissioned and raised once the new nodes are ready, followed by a repair.
+func (r *AxonOpsCassandraReconciler) setupAuthentication(ctx context.Context, cr *cassandraaxonopscomv1.AxonOpsCassandra,
+	racks []apps.CassandraRack, report *nodeOperationReport) error {
+	auth := report.authentication
+	if auth == nil || report.upgrade.IsRunning() {
+		return nil
+	}
+	if op := report.operation; op.IsRunning() && op.Type != cassandraaxonopscomv1.NodeOperationDecommission {
+		return nil
+	}
+	nodes := map[string]int32{}
+	for _, rack := range racks {
+		sts, err := r.getSts(rack.StatefulSet, cr.GetNamespace())
+		if err != nil {
+			return client.IgnoreNotFound(err)
+		}
+		if sts.Status.ObservedGeneration < sts.Generation || sts.Spec.Replicas == nil || *sts.Spec.Replicas != rack.Replicas ||
+			sts.Status.ReadyReplicas != rack.Replicas || sts.Status.UpdatedReplicas != rack.Replicas {
+			auth.Message = "Waiting for every node to be ready with authentication enabled"
+			return nil
+		}
+		nodes[rack.DC] += rack.Replicas
+	}
+	if len(racks) == 0 || racks[0].Replicas == 0 {
+		return nil
+	}
+	coordinator := fmt.Sprintf("%s-0", racks[0].StatefulSet)
+
+	if !auth.SuperuserCreated {
+		superuser, err := r.createSuperuser(ctx, cr, coordinator)
+		if err != nil {
+			log.FromContext(ctx).Info("cannot create the superuser", "node", coordinator, "error", err.Error())
+			auth.Message = fmt.Sprintf("Waiting to create the superuser on %s: %v", coordinator, err)
+			return nil
+		}
+		auth.SuperuserCreated = true
+		r.Recorder.Eventf(cr, corev1.EventTypeNormal, eventSuperuserCreated,
+			"Created the superuser %s and dropped the default cassandra role", superuser)
+	}
+	auth.Message = ""
+
+	// the factor follows the requested nodes, which are fewer than the ready ones during a scale down
+	replication := map[string]int32{}
+	for _, rack := range apps.CassandraRacks(cr.GetName(), apps.CassandraCluster(*cr)) {
+		replication[rack.DC] += rack.Replicas
+	}
+	for dc, factor := range replication {
+		if factor = min(factor, nodes[dc]); factor > 0 {
+			replication[dc] = factor
+		} else {
+			delete(replication, dc)
+		}
+	}
+	if maps.Equal(auth.SystemAuthReplication, replication) {
+		return nil
+	}
+
+	dcs := slices.Sorted(maps.Keys(replication))
+	options := []string{"'class': 'NetworkTopologyStrategy'"}
+	factors := []string{}
+	raised := false
+	for _, dc := range dcs {
+		options = append(options, fmt.Sprintf("'%s': %d", dc, replication[dc]))
+		factors = append(factors, fmt.Sprintf("%d in %s", replication[dc], dc))
+		if current, ok := auth.SystemAuthReplication[dc]; !ok || replication[dc] > current {
+			raised = true
+		}
+	}
+	statement := fmt.Sprintf("ALTER KEYSPACE system_auth WITH replication = {%s}", strings.Join(options, ", "))
+	if _, err := r.cqlsh(ctx, cr, coordinator, statement); err != nil {
+		return r.recordFailure(ctx, cr, eventSystemAuthReplicateFailed, "Failed to change the replication of system_auth", err)
+	}
+	// the new replicas of the roles are streamed to the nodes by a repair
+	if raised {
+		if err := r.nodetoolBackground(ctx, cr.GetNamespace(), coordinator, "repair", "-full", "system_auth"); err != nil {
+			log.FromContext(ctx).Info("cannot repair system_auth", "node", coordinator, "error", err.Error())
+		}
+	}
+	auth.SystemAuthReplication = replication
+	r.Recorder.Eventf(cr, corev1.EventTypeNormal, eventSystemAuthReplicated,
+		"Replicated system_auth to %s nodes", strings.Join(factors, ", "))
+	return nil
+}
+
+// createSuperuser creates the superuser of the Secret with the default cassandra role, then
+// drops the default role. A superuser that can already log in is kept as it is. It returns the
+// name of the superuser.
+func (r *AxonOpsCassandraReconciler) createSuperuser(ctx context.Context, cr *cassandraaxonopscomv1.AxonOpsCassandra, pod string) (string, error) {
+	if r.Executor == nil {
+		return "", fmt.Errorf("no pod executor configured to run cqlsh")
+	}
+	// the superuser is the one of the Secret, which is kept when the spec is changed
+	secret := &corev1.Secret{}
+	key := client.ObjectKey{Namespace: cr.GetNamespace(), Name: apps.CassandraSuperuserSecretName(cr.GetName())}
+	if err := r.Get(ctx, key, secret); err != nil {
+		return "", err
+	}
+	superuser := string(secret.Data[apps.SuperuserUsernameKey])
+	const listRoles = "SELECT role FROM system_auth.roles"
+	out, err := r.cqlsh(ctx, cr, pod, listRoles)
+	if err != nil || !slices.Contains(parseRoles(out), superuser) {
+		if _, err := r.Executor.Exec(ctx, cr.GetNamespace(), pod, cassandraContainer, "bash", "-c", createSuperuserScript(cr)); err != nil {
+			return "", fmt.Errorf("cannot log in as the superuser nor as the default cassandra role: %w", err)
+		}
+		if out, err = r.cqlsh(ctx, cr, pod, listRoles); err != nil {
+			return "", err
+		}
+	}
+	roles := parseRoles(out)
+	if !slices.Contains(roles, superuser) {
+		return "", fmt.Errorf("the superuser %s is not listed in system_auth.roles", superuser)
+	}
+	if !slices.Contains(roles, defaultRole) {
+		return superuser, nil
+	}
+	_, err = r.cqlsh(ctx, cr, pod, "DROP ROLE IF EXISTS "+defaultRole)
+	return superuser, err
+}
+
+// parseRoles returns the roles listed by cqlsh, one per line after the header
+func parseRoles(out string) []string {
+	roles := []string{}
+	for _, line := range strings.Split(out, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || line == "role" || strings.HasPrefix(line, "---") || strings.HasPrefix(line, "(") {
+			continue
+		}
+		roles = append(roles, line)
+	}
+	return roles
+}
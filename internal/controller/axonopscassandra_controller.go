@@ -18,24 +18,36 @@ package controller
 
 import (
 	"context"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/axonops/axonops-developer-operator/apps"
 	"github.com/axonops/axonops-developer-operator/utils"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/wait"
 	"k8s.io/client-go/tools/record"
 	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/log"
 	"sigs.k8s.io/controller-runtime/pkg/predicate"
 
-	cassandraaxonopscomv1beta1 "github.com/axonops/axonops-developer-operator/api/v1beta1"
+	cassandraaxonopscomv1 "github.com/axonops/axonops-developer-operator/api/v1"
 	appsv1 "k8s.io/api/apps/v1"
 	corev1 "k8s.io/api/core/v1"
 	networkingv1 "k8s.io/api/networking/v1"
-	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
 
+// resyncJitterFactor is the maximum fraction of the ReconciliationPeriod added to each periodic requeue
+const resyncJitterFactor = 0.1
+
+// axonopsFinalizerName guards the cleanup of the resources not removed by the garbage collector
+const axonopsFinalizerName = "axonops.com/finalizer"
+
 // AxonOpsCassandraReconciler reconciles a AxonOpsCassandra object
 type AxonOpsCassandraReconciler struct {
 	client.Client
@@ -43,11 +55,26 @@ type AxonOpsCassandraReconciler struct {
 	Recorder             record.EventRecorder
 	Scheme               *runtime.Scheme
 	Ctx                  context.Context
+	// Executor runs nodetool in the Cassandra pods for the operations done node by node
+	Executor PodExecutor
+	// driftChecked remembers the resourceVersion of the objects found without drift, so they
+	// are only compared again once they were written to
+	driftChecked sync.Map
 }
 
 //+kubebuilder:rbac:groups=axonops.com,resources=axonopscassandras,verbs=get;list;watch;create;update;patch;delete
 //+kubebuilder:rbac:groups=axonops.com,resources=axonopscassandras/status,verbs=get;update;patch
 //+kubebuilder:rbac:groups=axonops.com,resources=axonopscassandras/finalizers,verbs=update
+//+kubebuilder:rbac:groups=apps,resources=statefulsets;deployments,verbs=get;list;watch;create;update;patch;delete
+//+kubebuilder:rbac:groups="",resources=services,verbs=get;list;watch;create;update;patch;delete
+//+kubebuilder:rbac:groups="",resources=configmaps,verbs=get;list;watch;create;update;patch;delete
+//+kubebuilder:rbac:groups="",resources=secrets,verbs=get;list;watch;create;update;patch;delete
+//+kubebuilder:rbac:groups="",resources=persistentvolumeclaims,verbs=get;list;watch;delete
+//+kubebuilder:rbac:groups="",resources=pods,verbs=get;list;watch;delete
+//+kubebuilder:rbac:groups="",resources=pods/exec,verbs=create
+//+kubebuilder:rbac:groups="",resources=events,verbs=create;patch
+//+kubebuilder:rbac:groups=networking.k8s.io,resources=ingresses,verbs=get;list;watch;create;update;patch;delete
+//+kubebuilder:rbac:groups=cert-manager.io,resources=certificates,verbs=get;list;watch;create;update;patch;delete
 
 // Reconcile is part of the main kubernetes reconciliation loop which aims to
 // move the current state of the cluster closer to the desired state.
@@ -61,7 +88,7 @@ type AxonOpsCassandraReconciler struct {
 func (r *AxonOpsCassandraReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
 	_ = log.FromContext(ctx)
 
-	var axonopsCassCluster cassandraaxonopscomv1beta1.AxonOpsCassandra
+	var axonopsCassCluster cassandraaxonopscomv1.AxonOpsCassandra
 
 	err := r.Get(ctx, req.NamespacedName, &axonopsCassCluster)
 	if err != nil {
@@ -72,7 +99,6 @@ func (r *AxonOpsCassandraReconciler) Reconcile(ctx context.Context, req ctrl.Req
 	var thisClusterNamespace = axonopsCassCluster.GetNamespace()
 
 	//! [finalizer]
-	axonopsFinalizerName := "axonops.com/finalizer"
 	if axonopsCassCluster.ObjectMeta.DeletionTimestamp.IsZero() {
 		if !utils.ContainsString(axonopsCassCluster.GetFinalizers(), axonopsFinalizerName) {
 			axonopsCassCluster.SetFinalizers(append(axonopsCassCluster.GetFinalizers(), axonopsFinalizerName))
@@ -81,44 +107,16 @@ func (r *AxonOpsCassandraReconciler) Reconcile(ctx context.Context, req ctrl.Req
 			}
 		}
 	} else {
-		statefulSetList := []string{
-			"es-" + thisClusterName,
-			"ca-" + thisClusterName,
-			"as-" + thisClusterName,
-		}
-		deploymentsList := []string{
-			"ds-" + thisClusterName,
-		}
-
-		if axonopsCassCluster.Spec.AxonOps.Server.CassandraMetricsEnabled {
-			statefulSetList = append(statefulSetList, "ca-mt-"+thisClusterName)
-		}
-
 		// The object is being deleted
 		if utils.ContainsString(axonopsCassCluster.GetFinalizers(), axonopsFinalizerName) {
-			// our finalizer is present, so lets handle any external dependency
-			for sts := range statefulSetList {
-				if err := r.deleteSts(statefulSetList[sts], thisClusterNamespace); err != nil {
-					return ctrl.Result{}, client.IgnoreNotFound(err)
-				}
-				if err := r.deleteSvc(statefulSetList[sts], thisClusterNamespace); err != nil {
-					return ctrl.Result{}, client.IgnoreNotFound(err)
-				}
-			}
-
-			for d := range deploymentsList {
-				if err := r.deleteDeployment(deploymentsList[d], thisClusterNamespace); err != nil {
-					return ctrl.Result{}, client.IgnoreNotFound(err)
-				}
-				if err := r.deleteSvc(deploymentsList[d], thisClusterNamespace); err != nil {
-					return ctrl.Result{}, client.IgnoreNotFound(err)
-				}
-			}
-
-			if err := r.deleteIngress("ds-"+thisClusterName, thisClusterNamespace); err != nil {
+			if err := r.updateDeletingStatus(ctx, &axonopsCassCluster); err != nil {
 				return ctrl.Result{}, client.IgnoreNotFound(err)
 			}
 
+			// Every generated object has a controller reference and is removed by the
+			// garbage collector. The volumes claimed by the StatefulSets are kept with
+			// their data, a recreated AxonOpsCassandra of the same name finds them again.
+
 			// remove our finalizer from the list and update it.
 			axonopsCassCluster.SetFinalizers(utils.RemoveString(axonopsCassCluster.GetFinalizers(), axonopsFinalizerName))
 			if err := r.Update(context.Background(), &axonopsCassCluster); err != nil {
@@ -134,368 +132,273 @@ func (r *AxonOpsCassandraReconciler) Reconcile(ctx context.Context, req ctrl.Req
 		return ctrl.Result{}, nil
 	}
 
+	drift := newDriftReport(&axonopsCassCluster)
+
+	components, err := r.componentStatuses(&axonopsCassCluster)
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+	gate := newStartupGate(&axonopsCassCluster, components)
+
 	/*
 		STEP 1:
 		Create the elastic search STS
 	*/
 
-	var elasticStatefulSet *appsv1.StatefulSet
-	var elasticCurrentStatefulSet *appsv1.StatefulSet
-	elasticCurrentStatefulSet, err = r.getSts("es-"+thisClusterName, thisClusterNamespace)
-
-	if client.IgnoreNotFound(err) != nil {
+	elasticStatefulSet, err := apps.GenerateElasticsearchConfig(axonopsCassCluster)
+	if err != nil {
+		return ctrl.Result{}, r.recordFailure(ctx, &axonopsCassCluster, eventRenderFailed, "Failed to render the Elasticsearch StatefulSet", err)
+	}
+	if _, err = r.applyOwned(ctx, &axonopsCassCluster, elasticStatefulSet, drift); err != nil {
 		return ctrl.Result{}, err
 	}
-	/* Create the elastic search STS */
-	elasticStatefulSet, err = apps.GenerateElasticsearchConfig(axonopsCassCluster)
+
+	/* Create the elastic search service */
+	elasticSvc, err := apps.GenerateElasticsearchServiceConfig(axonopsCassCluster)
 	if err != nil {
-		r.Recorder.Event(&axonopsCassCluster, corev1.EventTypeNormal, "Failed", "Failed to parse the Elasticsearch config: "+err.Error())
+		return ctrl.Result{}, r.recordFailure(ctx, &axonopsCassCluster, eventRenderFailed, "Failed to render the Elasticsearch service", err)
+	}
+	if _, err = r.applyOwned(ctx, &axonopsCassCluster, elasticSvc, drift); err != nil {
 		return ctrl.Result{}, err
 	}
 
-	if elasticCurrentStatefulSet == nil {
-		err = r.Create(ctx, elasticStatefulSet)
-		if err != nil {
-			r.Recorder.Event(&axonopsCassCluster, corev1.EventTypeNormal, "Failed", "Failed to create the Elasticsearch sts: "+err.Error())
+	/*
+		STEP 2:
+		Create the Cassandra STS for metrics if enabled
+	*/
+
+	if metricsStore := axonopsCassCluster.Spec.AxonOps.Server.MetricsStore; metricsStore.Enabled {
+		/* Create the cassandra search STS */
+		metricsCluster := apps.MetricsStoreCluster(metricsStore)
+		metricsRacks := apps.CassandraRacks("metrics-"+axonopsCassCluster.GetName(), metricsCluster)
+		if err := r.applySeeds(ctx, &axonopsCassCluster, "metrics-"+axonopsCassCluster.GetName(), metricsCluster, metricsRacks, drift); err != nil {
 			return ctrl.Result{}, err
 		}
-	} else {
-		/* Update the elastic search STS */
-		err = r.Update(ctx, elasticStatefulSet)
+		cassandraMetricsStatefulSet, err := apps.GenerateCassandraConfig(
+			"metrics-"+axonopsCassCluster.GetName(),
+			axonopsCassCluster.GetNamespace(),
+			metricsStore.PersistentVolume,
+			metricsCluster,
+			metricsRacks[0])
 		if err != nil {
-			r.Recorder.Event(&axonopsCassCluster, corev1.EventTypeNormal, "Failed", "Failed to update the Elasticsearch sts: "+err.Error())
+			return ctrl.Result{}, r.recordFailure(ctx, &axonopsCassCluster, eventRenderFailed, "Failed to render the metrics Cassandra StatefulSet", err)
+		}
+		if err := r.applyStatefulSet(ctx, &axonopsCassCluster, cassandraMetricsStatefulSet, drift); err != nil {
 			return ctrl.Result{}, err
 		}
-	}
 
-	var elasticSvc *corev1.Service
-	elasticSvc, err = r.getService("es-"+thisClusterName, thisClusterNamespace)
-	if client.IgnoreNotFound(err) != nil {
-		return ctrl.Result{}, err
-	}
-	if elasticSvc == nil {
-		/* Create the elastic search service */
-		elasticSvc, err = apps.GenerateElasticsearchServiceConfig(axonopsCassCluster)
+		/* Create the cassandra headless service */
+		cassandraHeadlessSvc, err := apps.GenerateCassandraHeadlessServiceConfig("metrics-"+axonopsCassCluster.GetName(),
+			axonopsCassCluster.GetNamespace(),
+			axonopsCassCluster.Spec.Cassandra.Labels,
+			axonopsCassCluster.Spec.Cassandra.Annotations)
 		if err != nil {
-			r.Recorder.Event(&axonopsCassCluster, corev1.EventTypeNormal, "Failed", "Failed to parse the Elasticsearch service config: "+err.Error())
+			return ctrl.Result{}, r.recordFailure(ctx, &axonopsCassCluster, eventRenderFailed, "Failed to render the metrics Cassandra headless service", err)
+		}
+		if _, err = r.applyOwned(ctx, &axonopsCassCluster, cassandraHeadlessSvc, drift); err != nil {
 			return ctrl.Result{}, err
 		}
 
-		err = r.Create(ctx, elasticSvc)
+		/* Create the cassandra service */
+		cassandraSvc, err := apps.GenerateCassandraServiceConfig("metrics-"+axonopsCassCluster.GetName(),
+			axonopsCassCluster.GetNamespace(),
+			axonopsCassCluster.Spec.Cassandra.Labels,
+			axonopsCassCluster.Spec.Cassandra.Annotations)
 		if err != nil {
+			return ctrl.Result{}, r.recordFailure(ctx, &axonopsCassCluster, eventRenderFailed, "Failed to render the metrics Cassandra service", err)
+		}
+		if _, err = r.applyOwned(ctx, &axonopsCassCluster, cassandraSvc, drift); err != nil {
 			return ctrl.Result{}, err
 		}
 	}
 
 	/*
-		STEP 2:
-		Create the Dashboard Config
+		STEP 3:
+		Create the AxonServer Config once its metrics storage is ready
 	*/
 
-	var dashDeployment *appsv1.Deployment
-	var dashDeploymentCurrent *appsv1.Deployment
-	dashDeploymentCurrent, err = r.getDeployment("ds-"+thisClusterName, thisClusterNamespace)
-
-	if client.IgnoreNotFound(err) != nil {
-		return ctrl.Result{}, err
-	}
-
-	/* Create the dash search STS */
-	dashDeployment, err = apps.GenerateDashboardConfig(axonopsCassCluster)
-	if err != nil {
-		return ctrl.Result{}, err
-	}
-
-	if dashDeploymentCurrent == nil {
-		err = r.Create(ctx, dashDeployment)
+	if gate.allow(stepAxonServer, cassandraaxonopscomv1.ConditionAxonServerReady,
+		cassandraaxonopscomv1.ConditionElasticsearchReady, cassandraaxonopscomv1.ConditionMetricsCassandraReady) {
+		axonServerSts, err := apps.GenerateServerConfig(axonopsCassCluster)
 		if err != nil {
-			r.Recorder.Event(&axonopsCassCluster, corev1.EventTypeNormal, "Failed", "Failed to create the AxonOps dashboard: "+err.Error())
-			return ctrl.Result{}, err
+			return ctrl.Result{}, r.recordFailure(ctx, &axonopsCassCluster, eventRenderFailed, "Failed to render the AxonOps server StatefulSet", err)
 		}
-	} else {
-		/* Update the dash search STS */
-		err = r.Update(ctx, dashDeployment)
-		if err != nil {
-			r.Recorder.Event(&axonopsCassCluster, corev1.EventTypeNormal, "Failed", "Failed to update the AxonOps dashboard: "+err.Error())
+		setServerTLS(&axonopsCassCluster, axonServerSts)
+		if _, err = r.applyOwned(ctx, &axonopsCassCluster, axonServerSts, drift); err != nil {
 			return ctrl.Result{}, err
 		}
-	}
 
-	var dashSvc *corev1.Service
-	dashSvc, err = r.getService("ds-"+thisClusterName, thisClusterNamespace)
-	if client.IgnoreNotFound(err) != nil {
-		return ctrl.Result{}, err
-	}
-	if dashSvc == nil {
-		/* Create the dash search service */
-		dashSvc, err = apps.GenerateDashboardServiceConfig(axonopsCassCluster)
+		/* Create the axonServer search service */
+		axonServerSvc, err := apps.GenerateServerServiceConfig(axonopsCassCluster)
 		if err != nil {
-			r.Recorder.Event(&axonopsCassCluster, corev1.EventTypeNormal, "Failed", "Failed to parse the AxonOps dashboard config: "+err.Error())
+			return ctrl.Result{}, r.recordFailure(ctx, &axonopsCassCluster, eventRenderFailed, "Failed to render the AxonOps server service", err)
+		}
+		if _, err = r.applyOwned(ctx, &axonopsCassCluster, axonServerSvc, drift); err != nil {
 			return ctrl.Result{}, err
 		}
+	}
 
-		err = r.Create(ctx, dashSvc)
+	/*
+		STEP 4:
+		Create the Dashboard Config once the AxonServer is ready
+	*/
+
+	if gate.allow(stepDashboard, cassandraaxonopscomv1.ConditionDashboardReady, cassandraaxonopscomv1.ConditionAxonServerReady) {
+		dashDeployment, err := apps.GenerateDashboardConfig(axonopsCassCluster)
 		if err != nil {
-			r.Recorder.Event(&axonopsCassCluster, corev1.EventTypeNormal, "Failed", "Failed to create the AxonOps service: "+err.Error())
-			return ctrl.Result{}, err
+			return ctrl.Result{}, r.recordFailure(ctx, &axonopsCassCluster, eventRenderFailed, "Failed to render the AxonOps dashboard Deployment", err)
 		}
-	}
-	if axonopsCassCluster.Spec.AxonOps.Dashboard.Ingress.Enabled {
-		/* Create the dash search Ingress */
-		var dashIngressCurrent *networkingv1.Ingress
-		var dashIngress *networkingv1.Ingress
-		dashIngressCurrent, err = r.getIngress("ds-"+thisClusterName, thisClusterNamespace)
-		if client.IgnoreNotFound(err) != nil {
+		if _, err = r.applyOwned(ctx, &axonopsCassCluster, dashDeployment, drift); err != nil {
 			return ctrl.Result{}, err
 		}
-		dashIngress, err = apps.GenerateDashboardIngressConfig(axonopsCassCluster)
+
+		/* Create the dash search service */
+		dashSvc, err := apps.GenerateDashboardServiceConfig(axonopsCassCluster)
 		if err != nil {
-			r.Recorder.Event(&axonopsCassCluster, corev1.EventTypeNormal, "Failed", "Could not parse the AxonOps ingress: "+err.Error())
+			return ctrl.Result{}, r.recordFailure(ctx, &axonopsCassCluster, eventRenderFailed, "Failed to render the AxonOps dashboard service", err)
+		}
+		if _, err = r.applyOwned(ctx, &axonopsCassCluster, dashSvc, drift); err != nil {
 			return ctrl.Result{}, err
 		}
 
-		if dashIngressCurrent == nil {
-			err = r.Create(ctx, dashIngress)
+		if axonopsCassCluster.Spec.AxonOps.Dashboard.Ingress.Enabled {
+			/* Create the dash search Ingress */
+			dashIngress, err := apps.GenerateDashboardIngressConfig(axonopsCassCluster)
 			if err != nil {
-				r.Recorder.Event(&axonopsCassCluster, corev1.EventTypeNormal, "Failed", "Failed to create the AxonOps ingress: "+err.Error())
-				return ctrl.Result{}, err
+				return ctrl.Result{}, r.recordFailure(ctx, &axonopsCassCluster, eventRenderFailed, "Failed to render the AxonOps dashboard ingress", err)
 			}
-		} else {
-			/* Update the dash search Ingress */
-			err = r.Update(ctx, dashIngress)
-			if err != nil {
-				r.Recorder.Event(&axonopsCassCluster, corev1.EventTypeNormal, "Failed", "Failed to update the AxonOps ingress: "+err.Error())
+			if _, err = r.applyOwned(ctx, &axonopsCassCluster, dashIngress, drift); err != nil {
 				return ctrl.Result{}, err
 			}
+		} else if err := r.deleteIngress(&axonopsCassCluster, "ds-"+thisClusterName, thisClusterNamespace); err != nil {
+			return ctrl.Result{}, r.recordFailure(ctx, &axonopsCassCluster, eventDeleteFailed, "Failed to delete the AxonOps dashboard ingress", err)
 		}
 	}
 
+	var nodeOps *nodeOperationReport
+
 	/*
-		STEP 3:
-		Create the Cassandra STS for metrics if enabled
+		STEP 5:
+		Create the Cassandra STS of every rack once the AxonServer is ready
 	*/
 
-	if axonopsCassCluster.Spec.AxonOps.Server.CassandraMetricsEnabled {
-		var cassandraMetricsStatefulSetCurrent *appsv1.StatefulSet
-		var cassandraMetricsStatefulSet *appsv1.StatefulSet
-		cassandraMetricsStatefulSetCurrent, err = r.getSts("ca-mt-"+thisClusterName, thisClusterNamespace)
-
-		if client.IgnoreNotFound(err) != nil {
+	if gate.allow(stepCassandra, cassandraaxonopscomv1.ConditionCassandraReady, cassandraaxonopscomv1.ConditionAxonServerReady) {
+		cluster := apps.CassandraCluster(axonopsCassCluster)
+		racks := apps.CassandraRacks(axonopsCassCluster.GetName(), cluster)
+		nodeOps = newNodeOperationReport(&axonopsCassCluster)
+		removed, err := r.removedRacks(ctx, &axonopsCassCluster, racks)
+		if err != nil {
 			return ctrl.Result{}, err
 		}
-
-		/* Create the cassandra search STS */
-		if axonopsCassCluster.Spec.Cassandra.DC == "" {
-			axonopsCassCluster.Spec.Cassandra.DC = "axonops1"
+		racks, err = r.scaleDown(ctx, &axonopsCassCluster, racks, removed, nodeOps)
+		if err != nil {
+			return ctrl.Result{}, err
 		}
-		cassandraMetricsStatefulSet, err = apps.GenerateCassandraConfig(
-			"metrics-"+axonopsCassCluster.GetName(),
-			axonopsCassCluster.GetNamespace(),
-			axonopsCassCluster.Spec.AxonOps.Server.CassandraMetricsCluster.PersistentVolume.Size,
-			axonopsCassCluster.Spec.AxonOps.Server.CassandraMetricsCluster.PersistentVolume.StorageClass,
-			axonopsCassCluster.Spec.AxonOps.Server.CassandraMetricsCluster)
+		if err := r.cleanup(ctx, &axonopsCassCluster, racks, nodeOps); err != nil {
+			return ctrl.Result{}, err
+		}
+		image, err := r.upgrade(ctx, &axonopsCassCluster, racks, nodeOps)
 		if err != nil {
-			r.Recorder.Event(&axonopsCassCluster, corev1.EventTypeNormal, "Failed", "Failed to parse the Cassandra configuration for the metrics storage: "+err.Error())
 			return ctrl.Result{}, err
 		}
-
-		if cassandraMetricsStatefulSetCurrent == nil {
-			err = r.Create(ctx, cassandraMetricsStatefulSet)
-			if err != nil {
-				//r.Recorder.Event(&axonopsCassCluster, corev1.EventTypeNormal, "Failed", "Failed to create the Cassandra Statefulset: "+err.Error())
-				return ctrl.Result{}, err
-			}
-			r.Recorder.Event(&axonopsCassCluster, corev1.EventTypeNormal, "Created", "Cassandra sts created successfully")
-		} else {
-			/* Update the cassandra search STS */
-			err = r.Update(ctx, cassandraMetricsStatefulSet)
-			if err != nil {
-				r.Recorder.Event(&axonopsCassCluster, corev1.EventTypeNormal, "Failed", "Failed to update the Cassandra Statefulset: "+err.Error())
-				return ctrl.Result{}, err
-			}
+		if image != "" {
+			// the cassandra.yaml settings are written for the version the nodes run
+			cluster.Image.Tag = apps.CassandraImageTag(image)
 		}
-		var cassandraSvc *corev1.Service
-		var cassandraSvcCurrent *corev1.Service
-		cassandraSvcCurrent, err = r.getService("ca-"+thisClusterName, thisClusterNamespace)
-		if client.IgnoreNotFound(err) != nil {
+		if err := r.applyCassandraConfig(ctx, &axonopsCassCluster, cluster, drift); err != nil {
 			return ctrl.Result{}, err
 		}
-		/* Create the cassandra service */
-		cassandraSvc, err = apps.GenerateCassandraServiceConfig("metrics-"+axonopsCassCluster.GetName(),
-			axonopsCassCluster.GetNamespace(),
-			axonopsCassCluster.Spec.Cassandra.Labels,
-			axonopsCassCluster.Spec.Cassandra.Annotations)
-		if err != nil {
-			r.Recorder.Event(&axonopsCassCluster, corev1.EventTypeNormal, "Failed", "Failed to create the Cassandra service: "+err.Error())
+		if err := r.ensureSuperuserSecret(ctx, &axonopsCassCluster, nodeOps); err != nil {
+			return ctrl.Result{}, err
+		}
+		if err := r.ensureTLS(ctx, &axonopsCassCluster, racks, nodeOps); err != nil {
+			return ctrl.Result{}, err
+		}
+		// the nodes of the removed racks are still part of the ring until they are decommissioned
+		if err := r.applySeeds(ctx, &axonopsCassCluster, axonopsCassCluster.GetName(), cluster,
+			append(slices.Clone(racks), removed...), drift); err != nil {
 			return ctrl.Result{}, err
 		}
-		if cassandraSvcCurrent == nil {
-			err = r.Create(ctx, cassandraSvc)
+		for _, rack := range racks {
+			cassandraStatefulSet, err := apps.GenerateCassandraConfig(
+				axonopsCassCluster.GetName(),
+				axonopsCassCluster.GetNamespace(),
+				cluster.PersistentVolume,
+				cluster,
+				rack)
 			if err != nil {
-				return ctrl.Result{}, err
+				return ctrl.Result{}, r.recordFailure(ctx, &axonopsCassCluster, eventRenderFailed,
+					fmt.Sprintf("Failed to render the Cassandra StatefulSet of rack %s", rack.Name), err)
 			}
-		} else {
-			/* Update the cassandra search service */
-			err = r.Update(ctx, cassandraSvc)
-			if err != nil {
-				r.Recorder.Event(&axonopsCassCluster, corev1.EventTypeNormal, "Failed", "Failed to update the Cassandra service: "+err.Error())
+			setRestartPolicy(&axonopsCassCluster, cassandraStatefulSet)
+			setTLSRotation(&cassandraStatefulSet.Spec.Template, nodeOps.tls)
+			if image != "" {
+				setCassandraImage(cassandraStatefulSet, image)
+			}
+			if err := r.applyStatefulSet(ctx, &axonopsCassCluster, cassandraStatefulSet, drift); err != nil {
 				return ctrl.Result{}, err
 			}
-			//r.Recorder.Event(&axonopsCassCluster, corev1.EventTypeNormal, "Created", "Cassandra service updated successfully")
 		}
-	}
-	/*
-		STEP 4:
-		Create the AxonServer Config
-	*/
-
-	var axonServerSts *appsv1.StatefulSet
-	var axonServerStsCurrent *appsv1.StatefulSet
-	axonServerStsCurrent, err = r.getSts("as-"+thisClusterName, thisClusterNamespace)
-
-	if client.IgnoreNotFound(err) != nil {
-		return ctrl.Result{}, err
-	}
-	/* Create the axonServer search STS */
-	axonServerSts, err = apps.GenerateServerConfig(axonopsCassCluster)
-	if err != nil {
-		r.Recorder.Event(&axonopsCassCluster, corev1.EventTypeNormal, "Failed", "Failed to parse the AxonOps configuration: "+err.Error())
-		return ctrl.Result{}, err
-	}
-	if axonServerStsCurrent == nil {
-		err = r.Create(ctx, axonServerSts)
-		if err != nil {
-			r.Recorder.Event(&axonopsCassCluster, corev1.EventTypeNormal, "Failed", "Failed to created the AxonOps service: "+err.Error())
+		if err := r.deleteStaleRacks(ctx, &axonopsCassCluster, racks); err != nil {
+			return ctrl.Result{}, r.recordFailure(ctx, &axonopsCassCluster, eventDeleteFailed, "Failed to delete the StatefulSet of a removed rack", err)
+		}
+		if err := r.rollingRestart(ctx, &axonopsCassCluster, racks, nodeOps); err != nil {
 			return ctrl.Result{}, err
 		}
-	} else {
-		/* Update the axonServer search STS */
-		err = r.Update(ctx, axonServerSts)
-		if err != nil {
+		if err := r.removeDeadNodes(ctx, &axonopsCassCluster, racks, nodeOps); err != nil {
+			return ctrl.Result{}, err
+		}
+		if err := r.setupAuthentication(ctx, &axonopsCassCluster, racks, nodeOps); err != nil {
 			return ctrl.Result{}, err
 		}
-	}
 
-	var axonServerSvcCurrent *corev1.Service
-	var axonServerSvc *corev1.Service
-	axonServerSvcCurrent, err = r.getService("as-"+thisClusterName, thisClusterNamespace)
-	if client.IgnoreNotFound(err) != nil {
-		return ctrl.Result{}, err
-	}
-	/* Create the axonServer search service */
-	axonServerSvc, err = apps.GenerateServerServiceConfig(axonopsCassCluster)
-	if err != nil {
-		r.Recorder.Event(&axonopsCassCluster, corev1.EventTypeNormal, "Failed", "Failed to parse the AxonOps configuration: "+err.Error())
-		return ctrl.Result{}, err
-	}
-	if axonServerSvcCurrent == nil {
-		err = r.Create(ctx, axonServerSvc)
+		/* Create the cassandra service */
+		cassandraSvc, err := apps.GenerateCassandraServiceConfig(axonopsCassCluster.GetName(), axonopsCassCluster.GetNamespace(),
+			axonopsCassCluster.Spec.Cassandra.Labels,
+			axonopsCassCluster.Spec.Cassandra.Annotations)
 		if err != nil {
-			r.Recorder.Event(&axonopsCassCluster, corev1.EventTypeNormal, "Failed", "Failed to create the AxonOps service: "+err.Error())
+			return ctrl.Result{}, r.recordFailure(ctx, &axonopsCassCluster, eventRenderFailed, "Failed to render the Cassandra service", err)
+		}
+		if _, err = r.applyOwned(ctx, &axonopsCassCluster, cassandraSvc, drift); err != nil {
 			return ctrl.Result{}, err
 		}
-	} else {
-		/* Update the axonServer search service */
-		err = r.Update(ctx, axonServerSvc)
+
+		/* Create the cassandra headless service */
+		cassandraHeadlessSvc, err := apps.GenerateCassandraHeadlessServiceConfig(axonopsCassCluster.GetName(), axonopsCassCluster.GetNamespace(),
+			axonopsCassCluster.Spec.Cassandra.Labels,
+			axonopsCassCluster.Spec.Cassandra.Annotations)
 		if err != nil {
-			r.Recorder.Event(&axonopsCassCluster, corev1.EventTypeNormal, "Failed", "Failed to update the AxonOps service: "+err.Error())
+			return ctrl.Result{}, r.recordFailure(ctx, &axonopsCassCluster, eventRenderFailed, "Failed to render the Cassandra headless service", err)
+		}
+		if _, err = r.applyOwned(ctx, &axonopsCassCluster, cassandraHeadlessSvc, drift); err != nil {
 			return ctrl.Result{}, err
 		}
 	}
 
-	/*
-		STEP 5:
-		Create the Cassandra STS
-	*/
-
-	var cassandraStatefulSetCurrent *appsv1.StatefulSet
-	var cassandraStatefulSet *appsv1.StatefulSet
-	cassandraStatefulSetCurrent, err = r.getSts("ca-"+thisClusterName, thisClusterNamespace)
-
-	if client.IgnoreNotFound(err) != nil {
+	if err := r.updateStatus(ctx, &axonopsCassCluster, drift, gate, nodeOps); err != nil {
 		return ctrl.Result{}, err
 	}
 
-	/* Create the cassandra search STS */
-	cassandraStatefulSet, err = apps.GenerateCassandraConfig(
-		axonopsCassCluster.GetName(),
-		axonopsCassCluster.GetNamespace(),
-		axonopsCassCluster.Spec.AxonOps.Server.CassandraMetricsCluster.PersistentVolume.Size,
-		axonopsCassCluster.Spec.AxonOps.Server.CassandraMetricsCluster.PersistentVolume.StorageClass,
-		axonopsCassCluster.Spec.Cassandra)
-	if err != nil {
-		r.Recorder.Event(&axonopsCassCluster, corev1.EventTypeNormal, "Failed", "Failed to parse the Cassandra configuration: "+err.Error())
-		return ctrl.Result{}, err
+	if gate.blocked() {
+		return ctrl.Result{RequeueAfter: startupBackoff(&axonopsCassCluster)}, nil
 	}
 
-	if cassandraStatefulSetCurrent == nil {
-		err = r.Create(ctx, cassandraStatefulSet)
-		if err != nil {
-			//r.Recorder.Event(&axonopsCassCluster, corev1.EventTypeNormal, "Failed", "Failed to create the Cassandra Statefulset: "+err.Error())
-			return ctrl.Result{}, err
-		}
-		r.Recorder.Event(&axonopsCassCluster, corev1.EventTypeNormal, "Created", "Cassandra sts created successfully")
-	} else {
-		/* Update the cassandra search STS */
-		err = r.Update(ctx, cassandraStatefulSet)
-		if err != nil {
-			r.Recorder.Event(&axonopsCassCluster, corev1.EventTypeNormal, "Failed", "Failed to update the Cassandra Statefulset: "+err.Error())
-			return ctrl.Result{}, err
-		}
-		//r.Recorder.Event(&axonopsCassCluster, corev1.EventTypeNormal, "Updated", "Cassandra sts updated successfully")
+	if axonopsCassCluster.Status.Phase != cassandraaxonopscomv1.PhaseReady || axonopsCassCluster.Status.Operation.IsRunning() ||
+		axonopsCassCluster.Status.Upgrade.IsRunning() {
+		return ctrl.Result{RequeueAfter: notReadyRequeueInterval}, nil
 	}
 
-	var cassandraSvc *corev1.Service
-	var cassandraSvcCurrent *corev1.Service
-	cassandraSvcCurrent, err = r.getService("ca-"+thisClusterName, thisClusterNamespace)
-	if client.IgnoreNotFound(err) != nil {
-		return ctrl.Result{}, err
-	}
-	/* Create the cassandra service */
-	cassandraSvc, err = apps.GenerateCassandraServiceConfig(axonopsCassCluster.GetName(), axonopsCassCluster.GetNamespace(),
-		axonopsCassCluster.Spec.Cassandra.Labels,
-		axonopsCassCluster.Spec.Cassandra.Annotations)
-	if err != nil {
-		r.Recorder.Event(&axonopsCassCluster, corev1.EventTypeNormal, "Failed", "Failed to create the Cassandra service: "+err.Error())
-		return ctrl.Result{}, err
+	return r.resyncResult(), nil
+}
+
+// resyncResult schedules the next periodic reconcile so the status is refreshed and drift
+// is caught even when nothing triggers a watch. The jitter keeps many environments from
+// being reconciled at the same time.
+func (r *AxonOpsCassandraReconciler) resyncResult() ctrl.Result {
+	if r.ReconciliationPeriod <= 0 {
+		return ctrl.Result{}
 	}
-	if cassandraSvcCurrent == nil {
-		err = r.Create(ctx, cassandraSvc)
-		if err != nil {
-			return ctrl.Result{}, err
-		}
-		//r.Recorder.Event(&axonopsCassCluster, corev1.EventTypeNormal, "Created", "Cassandra service created successfully")
-	} else {
-		/* Update the cassandra search service */
-		err = r.Update(ctx, cassandraSvc)
-		if err != nil {
-			r.Recorder.Event(&axonopsCassCluster, corev1.EventTypeNormal, "Failed", "Failed to update the Cassandra service: "+err.Error())
-			return ctrl.Result{}, err
-		}
-		//r.Recorder.Event(&axonopsCassCluster, corev1.EventTypeNormal, "Created", "Cassandra service updated successfully")
-	}
-
-	r.Recorder.Event(&axonopsCassCluster, corev1.EventTypeNormal, "Created", "Environment created successfully")
-
-	// condition := metav1.Condition{
-	// 	Type:               "Ready",
-	// 	Status:             metav1.ConditionTrue,
-	// 	Reason:             "DeploymentCreated",
-	// 	Message:            "The AxonOps and Cassandra deployment has been successfully created",
-	// 	LastTransitionTime: metav1.Now(),
-	// }
-	// statusUpdate := cassandraaxonopscomv1beta1.AxonOpsCassandraStatus{
-	// 	Reason:     "Deployment Created",
-	// 	Message:    "The AxonOps and Cassandra deployment has been successfully created",
-	// 	Conditions: []metav1.Condition{condition},
-	// }
-	// axonopsCassCluster.Status = statusUpdate
-	// err = r.Client.Status().Update(ctx, &axonopsCassCluster)
-	// if err != nil {
-	// 	return ctrl.Result{}, err
-	// }
-
-	return ctrl.Result{}, nil
+	return ctrl.Result{RequeueAfter: wait.Jitter(r.ReconciliationPeriod, resyncJitterFactor)}
 }
 
 // SetupWithManager sets up the controller with the Manager.
@@ -503,11 +406,16 @@ func (r *AxonOpsCassandraReconciler) SetupWithManager(mgr ctrl.Manager) error {
 	pred := predicate.GenerationChangedPredicate{}
 	r.Recorder = mgr.GetEventRecorderFor("AxonDev")
 
+	// Only filter the AxonOpsCassandra events by generation, the status of the owned
+	// workloads changes without a generation bump and is needed to compute the conditions
 	return ctrl.NewControllerManagedBy(mgr).
-		For(&cassandraaxonopscomv1beta1.AxonOpsCassandra{}).
-		Owns(&appsv1.StatefulSet{}).WithEventFilter(pred).
-		Owns(&appsv1.Deployment{}).WithEventFilter(pred).
-		Owns(&corev1.Service{}).WithEventFilter(pred).
+		For(&cassandraaxonopscomv1.AxonOpsCassandra{}, builder.WithPredicates(pred)).
+		Owns(&appsv1.StatefulSet{}).
+		Owns(&appsv1.Deployment{}).
+		Owns(&corev1.Service{}).
+		Owns(&corev1.ConfigMap{}).
+		Owns(&corev1.Secret{}).
+		Owns(&networkingv1.Ingress{}).
 		Complete(r)
 }
 
@@ -539,74 +447,149 @@ func (r *AxonOpsCassandraReconciler) getDeployment(name string, namespace string
 	return &dep, nil
 }
 
-func (r *AxonOpsCassandraReconciler) getService(name string, namespace string) (*corev1.Service, error) {
-	var svc corev1.Service
+func (r *AxonOpsCassandraReconciler) deleteIngress(cr *cassandraaxonopscomv1.AxonOpsCassandra, name string, namespace string) error {
+	var ingress networkingv1.Ingress
 
 	err := r.Get(r.Ctx, client.ObjectKey{
 		Namespace: namespace,
 		Name:      name,
-	}, &svc)
+	}, &ingress)
 	if err != nil {
-		return nil, err
+		return client.IgnoreNotFound(err)
 	}
 
-	return &svc, nil
-}
-
-func (r *AxonOpsCassandraReconciler) deleteSts(name string, namespace string) error {
-	statefulSet := &appsv1.StatefulSet{
-		ObjectMeta: metav1.ObjectMeta{
-			Namespace: namespace,
-			Name:      name,
-		},
+	if err := r.Delete(r.Ctx, &ingress); err != nil {
+		return client.IgnoreNotFound(err)
 	}
-
-	return client.IgnoreNotFound(r.Delete(r.Ctx, statefulSet))
+	r.Recorder.Eventf(cr, corev1.EventTypeNormal, eventDeleted, "Deleted Ingress %s", name)
+	return nil
 }
 
-func (r *AxonOpsCassandraReconciler) deleteDeployment(name string, namespace string) error {
-	dep := &appsv1.Deployment{
-		ObjectMeta: metav1.ObjectMeta{
-			Namespace: namespace,
-			Name:      name,
-		},
+// applyStatefulSet applies a Cassandra StatefulSet. A StatefulSet created with another
+// serviceName, which cannot be updated, is deleted first while keeping its pods and volumes;
+// the StatefulSet created on a later reconcile adopts them and rolls them out.
+func (r *AxonOpsCassandraReconciler) applyStatefulSet(ctx context.Context, cr *cassandraaxonopscomv1.AxonOpsCassandra,
+	sts *appsv1.StatefulSet, drift *driftReport) error {
+	live, err := r.getSts(sts.Name, sts.Namespace)
+	if client.IgnoreNotFound(err) != nil {
+		return err
 	}
-
-	return client.IgnoreNotFound(r.Delete(r.Ctx, dep))
+	if live != nil && live.Spec.ServiceName != sts.Spec.ServiceName {
+		if live.GetDeletionTimestamp() != nil {
+			return nil
+		}
+		if err := r.Delete(ctx, live, client.PropagationPolicy(metav1.DeletePropagationOrphan)); client.IgnoreNotFound(err) != nil {
+			return r.recordFailure(ctx, cr, eventDeleteFailed, fmt.Sprintf("Failed to replace StatefulSet %s", sts.Name), err)
+		}
+		r.Recorder.Eventf(cr, corev1.EventTypeNormal, eventDeleted,
+			"Deleted StatefulSet %s to change its service to %s, its pods and volumes are kept", sts.Name, sts.Spec.ServiceName)
+		return nil
+	}
+	_, err = r.applyOwned(ctx, cr, sts, drift)
+	return err
 }
 
-func (r *AxonOpsCassandraReconciler) deleteSvc(name string, namespace string) error {
-	dep := &corev1.Service{
-		ObjectMeta: metav1.ObjectMeta{
-			Namespace: namespace,
-			Name:      name,
-		},
+// applyCassandraConfig applies the ConfigMap of the cassandra.yaml settings of the spec, or
+// deletes it once the settings are removed
+func (r *AxonOpsCassandraReconciler) applyCassandraConfig(ctx context.Context, cr *cassandraaxonopscomv1.AxonOpsCassandra,
+	cluster cassandraaxonopscomv1.AxonOpsCassandraCluster, drift *driftReport) error {
+	configMap, err := apps.GenerateCassandraConfigMap(cr.GetName(), cr.GetNamespace(), cluster)
+	if err != nil {
+		return r.recordFailure(ctx, cr, eventRenderFailed, "Failed to render the cassandra.yaml settings", err)
+	}
+	if configMap != nil {
+		_, err := r.applyOwned(ctx, cr, configMap, drift)
+		return err
 	}
 
-	return client.IgnoreNotFound(r.Delete(r.Ctx, dep))
+	live := &corev1.ConfigMap{}
+	err = r.Get(ctx, client.ObjectKey{Namespace: cr.GetNamespace(), Name: apps.CassandraConfigMapName(cr.GetName())}, live)
+	if err != nil {
+		return client.IgnoreNotFound(err)
+	}
+	if err := r.Delete(ctx, live); client.IgnoreNotFound(err) != nil {
+		return r.recordFailure(ctx, cr, eventDeleteFailed, fmt.Sprintf("Failed to delete ConfigMap %s", live.Name), err)
+	}
+	r.Recorder.Eventf(cr, corev1.EventTypeNormal, eventDeleted, "Deleted ConfigMap %s", live.Name)
+	return nil
 }
 
-func (r *AxonOpsCassandraReconciler) getIngress(name string, namespace string) (*networkingv1.Ingress, error) {
-	var svc networkingv1.Ingress
+// staleStatefulSets returns the Cassandra StatefulSets that are no longer part of the topology,
+// such as the ca-<name> StatefulSet once racks are configured or the StatefulSet of a removed
+// rack or datacenter
+func (r *AxonOpsCassandraReconciler) staleStatefulSets(ctx context.Context, cr *cassandraaxonopscomv1.AxonOpsCassandra, racks []apps.CassandraRack) ([]appsv1.StatefulSet, error) {
+	desired := map[string]bool{}
+	for _, rack := range racks {
+		desired[rack.StatefulSet] = true
+	}
 
-	err := r.Get(r.Ctx, client.ObjectKey{
-		Namespace: namespace,
-		Name:      name,
-	}, &svc)
-	if err != nil {
+	var statefulSets appsv1.StatefulSetList
+	if err := r.List(ctx, &statefulSets,
+		client.InNamespace(cr.GetNamespace()),
+		client.MatchingLabels{"component": "cassandra"}); err != nil {
 		return nil, err
 	}
 
-	return &svc, nil
+	prefix := "ca-" + cr.GetName()
+	stale := []appsv1.StatefulSet{}
+	for _, sts := range statefulSets.Items {
+		if desired[sts.Name] || !metav1.IsControlledBy(&sts, cr) {
+			continue
+		}
+		_, isRack := sts.Labels["rack"]
+		_, isDC := sts.Labels["dc"]
+		if sts.Name != prefix && !((isRack || isDC) && strings.HasPrefix(sts.Name, prefix+"-")) {
+			continue
+		}
+		stale = append(stale, sts)
+	}
+	return stale, nil
 }
 
-func (r *AxonOpsCassandraReconciler) deleteIngress(name string, namespace string) error {
-	dep := &networkingv1.Ingress{
-		ObjectMeta: metav1.ObjectMeta{
-			Namespace: namespace,
-			Name:      name,
-		},
+// removedRacks returns the racks of the stale StatefulSets with their current replicas, so
+// their nodes are decommissioned like the ones of a scale down. The datacenter and the rack
+// are the ones the nodes were started with.
+func (r *AxonOpsCassandraReconciler) removedRacks(ctx context.Context, cr *cassandraaxonopscomv1.AxonOpsCassandra, racks []apps.CassandraRack) ([]apps.CassandraRack, error) {
+	stale, err := r.staleStatefulSets(ctx, cr, racks)
+	if err != nil {
+		return nil, r.recordFailure(ctx, cr, eventUpdateFailed, "Failed to list the StatefulSets of the removed racks", err)
+	}
+	removed := []apps.CassandraRack{}
+	for _, sts := range stale {
+		rack := apps.CassandraRack{StatefulSet: sts.Name}
+		if sts.Spec.Replicas != nil {
+			rack.Replicas = *sts.Spec.Replicas
+		}
+		for _, container := range sts.Spec.Template.Spec.Containers {
+			for _, env := range container.Env {
+				switch env.Name {
+				case "CASSANDRA_DC":
+					rack.DC = env.Value
+				case "CASSANDRA_RACK":
+					rack.Name = env.Value
+				}
+			}
+		}
+		removed = append(removed, rack)
 	}
+	return removed, nil
+}
 
-	return client.IgnoreNotFound(r.Delete(r.Ctx, dep))
+// deleteStaleRacks removes the stale StatefulSets once scaleDown decommissioned all their nodes
+func (r *AxonOpsCassandraReconciler) deleteStaleRacks(ctx context.Context, cr *cassandraaxonopscomv1.AxonOpsCassandra, racks []apps.CassandraRack) error {
+	stale, err := r.staleStatefulSets(ctx, cr, racks)
+	if err != nil {
+		return err
+	}
+	for i := range stale {
+		sts := &stale[i]
+		if sts.Spec.Replicas == nil || *sts.Spec.Replicas > 0 {
+			continue
+		}
+		if err := r.Delete(ctx, sts); client.IgnoreNotFound(err) != nil {
+			return err
+		}
+		r.Recorder.Eventf(cr, corev1.EventTypeNormal, eventDeleted, "Deleted StatefulSet %s", sts.Name)
+	}
+	return nil
 }
@@ -18,16 +18,28 @@ package controller
 
 import (
 	"context"
+	"slices"
+	"strings"
+	"time"
 
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
 	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/api/resource"
+	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/reconcile"
 
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 
-	cassandraaxonopscomv1beta1 "github.com/axonops/axonops-developer-operator/api/v1beta1"
+	cassandraaxonopscomv1 "github.com/axonops/axonops-developer-operator/api/v1"
 )
 
 var _ = Describe("AxonOpsCassandra Controller", func() {
@@ -40,13 +52,13 @@ var _ = Describe("AxonOpsCassandra Controller", func() {
 			Name:      resourceName,
 			Namespace: "default", // TODO(user):Modify as needed
 		}
-		axonopscassandra := &cassandraaxonopscomv1beta1.AxonOpsCassandra{}
+		axonopscassandra := &cassandraaxonopscomv1.AxonOpsCassandra{}
 
 		BeforeEach(func() {
 			By("creating the custom resource for the Kind AxonOpsCassandra")
 			err := k8sClient.Get(ctx, typeNamespacedName, axonopscassandra)
 			if err != nil && errors.IsNotFound(err) {
-				resource := &cassandraaxonopscomv1beta1.AxonOpsCassandra{
+				resource := &cassandraaxonopscomv1.AxonOpsCassandra{
 					ObjectMeta: metav1.ObjectMeta{
 						Name:      resourceName,
 						Namespace: "default",
@@ -59,7 +71,7 @@ var _ = Describe("AxonOpsCassandra Controller", func() {
 
 		AfterEach(func() {
 			// TODO(user): Cleanup logic after each test, like removing the resource instance.
-			resource := &cassandraaxonopscomv1beta1.AxonOpsCassandra{}
+			resource := &cassandraaxonopscomv1.AxonOpsCassandra{}
 			err := k8sClient.Get(ctx, typeNamespacedName, resource)
 			Expect(err).NotTo(HaveOccurred())
 
@@ -69,16 +81,1523 @@ var _ = Describe("AxonOpsCassandra Controller", func() {
 		It("should successfully reconcile the resource", func() {
 			By("Reconciling the created resource")
 			controllerReconciler := &AxonOpsCassandraReconciler{
-				Client: k8sClient,
-				Scheme: k8sClient.Scheme(),
+				Client:   k8sClient,
+				Scheme:   k8sClient.Scheme(),
+				Recorder: record.NewFakeRecorder(100),
+				Ctx:      ctx,
 			}
 
 			_, err := controllerReconciler.Reconcile(ctx, reconcile.Request{
 				NamespacedName: typeNamespacedName,
 			})
 			Expect(err).NotTo(HaveOccurred())
-			// TODO(user): Add more specific assertions depending on your controller's reconciliation logic.
-			// Example: If you expect a certain status condition after reconciliation, verify it here.
+
+			By("Checking the status reports every component")
+			resource := &cassandraaxonopscomv1.AxonOpsCassandra{}
+			Expect(k8sClient.Get(ctx, typeNamespacedName, resource)).To(Succeed())
+			Expect(resource.Status.ObservedGeneration).To(Equal(resource.GetGeneration()))
+			// envtest does not run the workload controllers so nothing becomes ready
+			Expect(resource.Status.Phase).To(Equal(cassandraaxonopscomv1.PhaseProvisioning))
+			for _, conditionType := range []string{
+				cassandraaxonopscomv1.ConditionElasticsearchReady,
+				cassandraaxonopscomv1.ConditionAxonServerReady,
+				cassandraaxonopscomv1.ConditionDashboardReady,
+				cassandraaxonopscomv1.ConditionCassandraReady,
+				cassandraaxonopscomv1.ConditionReady,
+			} {
+				cond := meta.FindStatusCondition(resource.Status.Conditions, conditionType)
+				Expect(cond).NotTo(BeNil(), conditionType)
+				Expect(cond.Status).To(Equal(metav1.ConditionFalse), conditionType)
+			}
+			Expect(meta.FindStatusCondition(resource.Status.Conditions,
+				cassandraaxonopscomv1.ConditionMetricsCassandraReady)).To(BeNil())
+		})
+	})
+
+	Context("When deleting a cr", func() {
+		const resourceName = "test-cleanup"
+
+		ctx := context.Background()
+
+		typeNamespacedName := types.NamespacedName{
+			Name:      resourceName,
+			Namespace: "default",
+		}
+
+		It("should own every generated object and leave nothing behind", func() {
+			By("creating an environment with every optional component enabled")
+			cr := &cassandraaxonopscomv1.AxonOpsCassandra{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      resourceName,
+					Namespace: "default",
+				},
+				Spec: cassandraaxonopscomv1.AxonOpsCassandraSpec{
+					ParallelStartup: true,
+					AxonOps: cassandraaxonopscomv1.AxonOpsCluster{
+						Dashboard: cassandraaxonopscomv1.AxonOpsDashboard{
+							Ingress: cassandraaxonopscomv1.Ingress{
+								Enabled: true,
+								Hosts:   []string{"axonops.localhost"},
+							},
+						},
+						Server: cassandraaxonopscomv1.AxonOpsServer{
+							MetricsStore: cassandraaxonopscomv1.MetricsStore{Enabled: true},
+						},
+					},
+				},
+			}
+			Expect(k8sClient.Create(ctx, cr)).To(Succeed())
+
+			controllerReconciler := &AxonOpsCassandraReconciler{
+				Client:   k8sClient,
+				Scheme:   k8sClient.Scheme(),
+				Recorder: record.NewFakeRecorder(100),
+				Ctx:      ctx,
+			}
+			_, err := controllerReconciler.Reconcile(ctx, reconcile.Request{NamespacedName: typeNamespacedName})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(k8sClient.Get(ctx, typeNamespacedName, cr)).To(Succeed())
+
+			By("checking every generated object is controlled by the AxonOpsCassandra")
+			var children []client.Object
+			stsList := &appsv1.StatefulSetList{}
+			Expect(k8sClient.List(ctx, stsList, client.InNamespace("default"))).To(Succeed())
+			for i := range stsList.Items {
+				children = append(children, &stsList.Items[i])
+			}
+			depList := &appsv1.DeploymentList{}
+			Expect(k8sClient.List(ctx, depList, client.InNamespace("default"))).To(Succeed())
+			for i := range depList.Items {
+				children = append(children, &depList.Items[i])
+			}
+			svcList := &corev1.ServiceList{}
+			Expect(k8sClient.List(ctx, svcList, client.InNamespace("default"))).To(Succeed())
+			for i := range svcList.Items {
+				if svcList.Items[i].Name != "kubernetes" {
+					children = append(children, &svcList.Items[i])
+				}
+			}
+			ingList := &networkingv1.IngressList{}
+			Expect(k8sClient.List(ctx, ingList, client.InNamespace("default"))).To(Succeed())
+			for i := range ingList.Items {
+				children = append(children, &ingList.Items[i])
+			}
+
+			names := map[string]bool{}
+			for _, child := range children {
+				if !strings.Contains(child.GetName(), resourceName) {
+					continue
+				}
+				names[child.GetName()] = true
+				owner := metav1.GetControllerOf(child)
+				Expect(owner).NotTo(BeNil(), child.GetName())
+				Expect(owner.UID).To(Equal(cr.GetUID()), child.GetName())
+			}
+			for _, name := range []string{"es-", "as-", "ds-", "ca-", "ca-metrics-"} {
+				Expect(names).To(HaveKey(name + resourceName))
+			}
+			Expect(names).To(HaveKey("ca-" + resourceName + "-headless"))
+			Expect(names).To(HaveKey("ca-metrics-" + resourceName + "-headless"))
+
+			By("simulating a volume claimed by the Cassandra StatefulSet")
+			pvc := &corev1.PersistentVolumeClaim{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      "data-ca-" + resourceName + "-0",
+					Namespace: "default",
+					Labels:    map[string]string{"app": "ca-" + resourceName},
+				},
+				Spec: corev1.PersistentVolumeClaimSpec{
+					AccessModes: []corev1.PersistentVolumeAccessMode{corev1.ReadWriteOnce},
+					Resources: corev1.VolumeResourceRequirements{
+						Requests: corev1.ResourceList{corev1.ResourceStorage: resource.MustParse("1Gi")},
+					},
+				},
+			}
+			Expect(k8sClient.Create(ctx, pvc)).To(Succeed())
+
+			By("deleting the AxonOpsCassandra")
+			Expect(k8sClient.Delete(ctx, cr)).To(Succeed())
+			_, err = controllerReconciler.Reconcile(ctx, reconcile.Request{NamespacedName: typeNamespacedName})
+			Expect(err).NotTo(HaveOccurred())
+
+			err = k8sClient.Get(ctx, typeNamespacedName, cr)
+			Expect(errors.IsNotFound(err)).To(BeTrue())
+
+			By("collecting the children the way the garbage collector would")
+			// envtest runs no garbage collector, so do its work for the objects owned by the CR
+			for _, child := range children {
+				if !strings.Contains(child.GetName(), resourceName) {
+					continue
+				}
+				Expect(client.IgnoreNotFound(k8sClient.Delete(ctx, child,
+					client.PropagationPolicy(metav1.DeletePropagationBackground)))).To(Succeed(), child.GetName())
+			}
+			for _, child := range children {
+				if !strings.Contains(child.GetName(), resourceName) {
+					continue
+				}
+				Eventually(func() bool {
+					return errors.IsNotFound(k8sClient.Get(ctx, client.ObjectKeyFromObject(child), child))
+				}, 10*time.Second, 100*time.Millisecond).Should(BeTrue(), child.GetName())
+			}
+
+			By("keeping the data of the Cassandra nodes")
+			Expect(k8sClient.Get(ctx, client.ObjectKeyFromObject(pvc), pvc)).To(Succeed())
+			Expect(pvc.GetDeletionTimestamp()).To(BeNil())
+			Expect(k8sClient.Delete(ctx, pvc)).To(Succeed())
+		})
+	})
+
+	Context("When a generated object is edited by hand", func() {
+		const resourceName = "test-drift"
+
+		ctx := context.Background()
+
+		typeNamespacedName := types.NamespacedName{
+			Name:      resourceName,
+			Namespace: "default",
+		}
+		stsName := types.NamespacedName{
+			Name:      "es-" + resourceName,
+			Namespace: "default",
+		}
+
+		It("should report the drift and revert it according to the drift policy", func() {
+			cr := &cassandraaxonopscomv1.AxonOpsCassandra{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      resourceName,
+					Namespace: "default",
+				},
+				Spec: cassandraaxonopscomv1.AxonOpsCassandraSpec{
+					DriftPolicy: cassandraaxonopscomv1.DriftPolicyReport,
+				},
+			}
+			Expect(k8sClient.Create(ctx, cr)).To(Succeed())
+
+			controllerReconciler := &AxonOpsCassandraReconciler{
+				Client:   k8sClient,
+				Scheme:   k8sClient.Scheme(),
+				Recorder: record.NewFakeRecorder(100),
+				Ctx:      ctx,
+			}
+			_, err := controllerReconciler.Reconcile(ctx, reconcile.Request{NamespacedName: typeNamespacedName})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(k8sClient.Get(ctx, typeNamespacedName, cr)).To(Succeed())
+			cond := meta.FindStatusCondition(cr.Status.Conditions, cassandraaxonopscomv1.ConditionDriftDetected)
+			Expect(cond).NotTo(BeNil())
+			Expect(cond.Status).To(Equal(metav1.ConditionFalse))
+
+			By("changing the Elasticsearch image outside of the operator")
+			sts := &appsv1.StatefulSet{}
+			Expect(k8sClient.Get(ctx, stsName, sts)).To(Succeed())
+			renderedImage := sts.Spec.Template.Spec.Containers[0].Image
+			sts.Spec.Template.Spec.Containers[0].Image = "busybox:latest"
+			Expect(k8sClient.Update(ctx, sts)).To(Succeed())
+
+			By("reporting the drift without touching the object")
+			_, err = controllerReconciler.Reconcile(ctx, reconcile.Request{NamespacedName: typeNamespacedName})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(k8sClient.Get(ctx, typeNamespacedName, cr)).To(Succeed())
+			cond = meta.FindStatusCondition(cr.Status.Conditions, cassandraaxonopscomv1.ConditionDriftDetected)
+			Expect(cond).NotTo(BeNil())
+			Expect(cond.Status).To(Equal(metav1.ConditionTrue))
+			Expect(cond.Reason).To(Equal(reasonDriftReported))
+			Expect(cond.Message).To(ContainSubstring("StatefulSet/es-" + resourceName))
+			Expect(cond.Message).To(ContainSubstring("spec.template.spec.containers[0].image"))
+			Expect(k8sClient.Get(ctx, stsName, sts)).To(Succeed())
+			Expect(sts.Spec.Template.Spec.Containers[0].Image).To(Equal("busybox:latest"))
+
+			By("reverting the drift once the policy is Revert")
+			cr.Spec.DriftPolicy = cassandraaxonopscomv1.DriftPolicyRevert
+			Expect(k8sClient.Update(ctx, cr)).To(Succeed())
+			_, err = controllerReconciler.Reconcile(ctx, reconcile.Request{NamespacedName: typeNamespacedName})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(k8sClient.Get(ctx, stsName, sts)).To(Succeed())
+			Expect(sts.Spec.Template.Spec.Containers[0].Image).To(Equal(renderedImage))
+			Expect(k8sClient.Get(ctx, typeNamespacedName, cr)).To(Succeed())
+			cond = meta.FindStatusCondition(cr.Status.Conditions, cassandraaxonopscomv1.ConditionDriftDetected)
+			Expect(cond).NotTo(BeNil())
+			Expect(cond.Reason).To(Equal(reasonDriftReverted))
+
+			By("finding nothing left to revert")
+			_, err = controllerReconciler.Reconcile(ctx, reconcile.Request{NamespacedName: typeNamespacedName})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(k8sClient.Get(ctx, typeNamespacedName, cr)).To(Succeed())
+			Expect(meta.IsStatusConditionFalse(cr.Status.Conditions, cassandraaxonopscomv1.ConditionDriftDetected)).To(BeTrue())
+
+			Expect(k8sClient.Delete(ctx, cr)).To(Succeed())
+		})
+	})
+
+	Context("When an unchanged AxonOpsCassandra is reconciled again", func() {
+		const resourceName = "test-noop"
+
+		ctx := context.Background()
+
+		typeNamespacedName := types.NamespacedName{
+			Name:      resourceName,
+			Namespace: "default",
+		}
+		stsName := types.NamespacedName{
+			Name:      "ca-" + resourceName,
+			Namespace: "default",
+		}
+
+		It("should not write the generated objects nor check them for drift again", func() {
+			cr := &cassandraaxonopscomv1.AxonOpsCassandra{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      resourceName,
+					Namespace: "default",
+				},
+				Spec: cassandraaxonopscomv1.AxonOpsCassandraSpec{
+					ParallelStartup: true,
+					DriftPolicy:     cassandraaxonopscomv1.DriftPolicyRevert,
+				},
+			}
+			Expect(k8sClient.Create(ctx, cr)).To(Succeed())
+
+			applies := &applyRecorder{Client: k8sClient}
+			controllerReconciler := &AxonOpsCassandraReconciler{
+				Client:   applies,
+				Scheme:   k8sClient.Scheme(),
+				Recorder: record.NewFakeRecorder(100),
+				Ctx:      ctx,
+				Executor: &fakeExecutor{mode: "NORMAL"},
+			}
+			_, err := controllerReconciler.Reconcile(ctx, reconcile.Request{NamespacedName: typeNamespacedName})
+			Expect(err).NotTo(HaveOccurred())
+			sts := &appsv1.StatefulSet{}
+			Expect(k8sClient.Get(ctx, stsName, sts)).To(Succeed())
+			Expect(sts.Annotations).To(HaveKey(appliedHashAnnotation))
+			resourceVersion, generation := sts.ResourceVersion, sts.Generation
+			hash := sts.Annotations[appliedHashAnnotation]
+
+			By("skipping the apply of the StatefulSet generated from the same configuration")
+			applies.reset()
+			_, err = controllerReconciler.Reconcile(ctx, reconcile.Request{NamespacedName: typeNamespacedName})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(applies.applied).NotTo(ContainElement("StatefulSet/" + stsName.Name))
+			Expect(applies.dryRuns).To(ContainElement("StatefulSet/" + stsName.Name))
+			Expect(k8sClient.Get(ctx, stsName, sts)).To(Succeed())
+			Expect(sts.ResourceVersion).To(Equal(resourceVersion))
+			Expect(sts.Generation).To(Equal(generation))
+			Expect(sts.Annotations).To(HaveKeyWithValue(appliedHashAnnotation, hash))
+
+			By("not checking the StatefulSet for drift while it is unchanged")
+			applies.reset()
+			_, err = controllerReconciler.Reconcile(ctx, reconcile.Request{NamespacedName: typeNamespacedName})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(applies.applied).NotTo(ContainElement("StatefulSet/" + stsName.Name))
+			Expect(applies.dryRuns).NotTo(ContainElement("StatefulSet/" + stsName.Name))
+			Expect(k8sClient.Get(ctx, stsName, sts)).To(Succeed())
+			Expect(sts.ResourceVersion).To(Equal(resourceVersion))
+
+			Expect(k8sClient.Delete(ctx, cr)).To(Succeed())
+		})
+	})
+
+	Context("When starting a new environment", func() {
+		const resourceName = "test-startup"
+
+		ctx := context.Background()
+
+		typeNamespacedName := types.NamespacedName{
+			Name:      resourceName,
+			Namespace: "default",
+		}
+
+		// markReady fakes the StatefulSet controller, which does not run in envtest
+		markReady := func(name string) {
+			sts := &appsv1.StatefulSet{}
+			Expect(k8sClient.Get(ctx, types.NamespacedName{Name: name, Namespace: "default"}, sts)).To(Succeed())
+			sts.Status.ObservedGeneration = sts.Generation
+			sts.Status.Replicas = *sts.Spec.Replicas
+			sts.Status.ReadyReplicas = *sts.Spec.Replicas
+			sts.Status.UpdatedReplicas = *sts.Spec.Replicas
+			sts.Status.CurrentRevision = "rev-1"
+			sts.Status.UpdateRevision = "rev-1"
+			Expect(k8sClient.Status().Update(ctx, sts)).To(Succeed())
+		}
+
+		exists := func(obj client.Object, name string) bool {
+			err := k8sClient.Get(ctx, types.NamespacedName{Name: name, Namespace: "default"}, obj)
+			if err != nil {
+				Expect(errors.IsNotFound(err)).To(BeTrue())
+				return false
+			}
+			return true
+		}
+
+		It("should create each component once its dependencies are ready", func() {
+			cr := &cassandraaxonopscomv1.AxonOpsCassandra{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      resourceName,
+					Namespace: "default",
+				},
+			}
+			Expect(k8sClient.Create(ctx, cr)).To(Succeed())
+
+			controllerReconciler := &AxonOpsCassandraReconciler{
+				Client:   k8sClient,
+				Scheme:   k8sClient.Scheme(),
+				Recorder: record.NewFakeRecorder(100),
+				Ctx:      ctx,
+			}
+
+			By("creating only Elasticsearch at first")
+			result, err := controllerReconciler.Reconcile(ctx, reconcile.Request{NamespacedName: typeNamespacedName})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(result.RequeueAfter).To(BeNumerically(">=", minStartupBackoff))
+			Expect(exists(&appsv1.StatefulSet{}, "es-"+resourceName)).To(BeTrue())
+			Expect(exists(&appsv1.StatefulSet{}, "as-"+resourceName)).To(BeFalse())
+			Expect(exists(&appsv1.Deployment{}, "ds-"+resourceName)).To(BeFalse())
+			Expect(exists(&appsv1.StatefulSet{}, "ca-"+resourceName)).To(BeFalse())
+
+			Expect(k8sClient.Get(ctx, typeNamespacedName, cr)).To(Succeed())
+			Expect(cr.Status.BlockedOn).To(Equal(stepAxonServer))
+			ready := meta.FindStatusCondition(cr.Status.Conditions, cassandraaxonopscomv1.ConditionReady)
+			Expect(ready).NotTo(BeNil())
+			Expect(ready.Reason).To(Equal(reasonWaitingForDependencies))
+			Expect(ready.Message).To(ContainSubstring("es-" + resourceName))
+
+			By("creating the AxonOps server once Elasticsearch is ready")
+			markReady("es-" + resourceName)
+			_, err = controllerReconciler.Reconcile(ctx, reconcile.Request{NamespacedName: typeNamespacedName})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(exists(&appsv1.StatefulSet{}, "as-"+resourceName)).To(BeTrue())
+			Expect(exists(&appsv1.Deployment{}, "ds-"+resourceName)).To(BeFalse())
+			Expect(exists(&appsv1.StatefulSet{}, "ca-"+resourceName)).To(BeFalse())
+			Expect(k8sClient.Get(ctx, typeNamespacedName, cr)).To(Succeed())
+			Expect(cr.Status.BlockedOn).To(Equal(stepDashboard))
+
+			By("creating the dashboard and Cassandra once the AxonOps server is ready")
+			markReady("as-" + resourceName)
+			_, err = controllerReconciler.Reconcile(ctx, reconcile.Request{NamespacedName: typeNamespacedName})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(exists(&appsv1.Deployment{}, "ds-"+resourceName)).To(BeTrue())
+			Expect(exists(&appsv1.StatefulSet{}, "ca-"+resourceName)).To(BeTrue())
+			Expect(k8sClient.Get(ctx, typeNamespacedName, cr)).To(Succeed())
+			Expect(cr.Status.BlockedOn).To(BeEmpty())
+
+			By("resyncing periodically once everything is ready")
+			markReady("ca-" + resourceName)
+			dep := &appsv1.Deployment{}
+			Expect(k8sClient.Get(ctx, types.NamespacedName{Name: "ds-" + resourceName, Namespace: "default"}, dep)).To(Succeed())
+			dep.Status.ObservedGeneration = dep.Generation
+			dep.Status.Replicas = *dep.Spec.Replicas
+			dep.Status.ReadyReplicas = *dep.Spec.Replicas
+			dep.Status.UpdatedReplicas = *dep.Spec.Replicas
+			Expect(k8sClient.Status().Update(ctx, dep)).To(Succeed())
+
+			controllerReconciler.ReconciliationPeriod = time.Minute
+			result, err = controllerReconciler.Reconcile(ctx, reconcile.Request{NamespacedName: typeNamespacedName})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(k8sClient.Get(ctx, typeNamespacedName, cr)).To(Succeed())
+			Expect(cr.Status.Phase).To(Equal(cassandraaxonopscomv1.PhaseReady))
+			Expect(result.RequeueAfter).To(BeNumerically(">=", time.Minute))
+			Expect(result.RequeueAfter).To(BeNumerically("<=", time.Minute+6*time.Second))
+
+			Expect(k8sClient.Delete(ctx, cr)).To(Succeed())
+		})
+	})
+
+	Context("When the Cassandra cluster is scaled down", func() {
+		const resourceName = "test-scaledown"
+
+		ctx := context.Background()
+
+		typeNamespacedName := types.NamespacedName{
+			Name:      resourceName,
+			Namespace: "default",
+		}
+
+		replicas := func() int32 {
+			sts := &appsv1.StatefulSet{}
+			Expect(k8sClient.Get(ctx, types.NamespacedName{Name: "ca-" + resourceName, Namespace: "default"}, sts)).To(Succeed())
+			return *sts.Spec.Replicas
+		}
+
+		It("should decommission the nodes one at a time before removing them", func() {
+			cr := &cassandraaxonopscomv1.AxonOpsCassandra{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      resourceName,
+					Namespace: "default",
+				},
+				Spec: cassandraaxonopscomv1.AxonOpsCassandraSpec{
+					ParallelStartup: true,
+					Cassandra:       cassandraaxonopscomv1.AxonOpsCassandraCluster{Replicas: 3},
+				},
+			}
+			Expect(k8sClient.Create(ctx, cr)).To(Succeed())
+
+			executor := &fakeExecutor{mode: "NORMAL"}
+			controllerReconciler := &AxonOpsCassandraReconciler{
+				Client:   k8sClient,
+				Scheme:   k8sClient.Scheme(),
+				Recorder: record.NewFakeRecorder(100),
+				Ctx:      ctx,
+				Executor: executor,
+			}
+			_, err := controllerReconciler.Reconcile(ctx, reconcile.Request{NamespacedName: typeNamespacedName})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(replicas()).To(Equal(int32(3)))
+
+			By("refusing to go below the replication factor of a keyspace")
+			Expect(k8sClient.Get(ctx, typeNamespacedName, cr)).To(Succeed())
+			cr.Spec.Cassandra.Replicas = 2
+			Expect(k8sClient.Update(ctx, cr)).To(Succeed())
+			executor.keyspaces = keyspacesOutput("'dc1': '3'")
+			_, err = controllerReconciler.Reconcile(ctx, reconcile.Request{NamespacedName: typeNamespacedName})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(replicas()).To(Equal(int32(3)))
+			Expect(k8sClient.Get(ctx, typeNamespacedName, cr)).To(Succeed())
+			Expect(meta.IsStatusConditionTrue(cr.Status.Conditions, cassandraaxonopscomv1.ConditionScaleDownBlocked)).To(BeTrue())
+			Expect(executor.ran("decommission")).To(BeFalse())
+
+			By("checking the system keyspaces replicated across the nodes")
+			executor.keyspaces = strings.Replace(keyspacesOutput("'dc1': '2'"), "'replication_factor': '2'", "'replication_factor': '3'", 1)
+			_, err = controllerReconciler.Reconcile(ctx, reconcile.Request{NamespacedName: typeNamespacedName})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(replicas()).To(Equal(int32(3)))
+			Expect(k8sClient.Get(ctx, typeNamespacedName, cr)).To(Succeed())
+			cond := meta.FindStatusCondition(cr.Status.Conditions, cassandraaxonopscomv1.ConditionScaleDownBlocked)
+			Expect(cond).NotTo(BeNil())
+			Expect(cond.Message).To(ContainSubstring("system_traces"))
+			Expect(executor.ran("decommission")).To(BeFalse())
+
+			By("decommissioning the highest ordinal first")
+			executor.keyspaces = keyspacesOutput("'dc1': '2'")
+			_, err = controllerReconciler.Reconcile(ctx, reconcile.Request{NamespacedName: typeNamespacedName})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(replicas()).To(Equal(int32(3)))
+			Expect(executor.ran("ca-" + resourceName + "-2: bash -c")).To(BeTrue())
+			Expect(executor.ran("nodetool decommission")).To(BeTrue())
+			Expect(k8sClient.Get(ctx, typeNamespacedName, cr)).To(Succeed())
+			Expect(meta.FindStatusCondition(cr.Status.Conditions, cassandraaxonopscomv1.ConditionScaleDownBlocked)).To(BeNil())
+			Expect(cr.Status.Operation).NotTo(BeNil())
+			Expect(cr.Status.Operation.Node).To(Equal("ca-" + resourceName + "-2"))
+
+			By("scaling the StatefulSet down and deleting the volume claim once the node left the ring")
+			claim := &corev1.PersistentVolumeClaim{
+				ObjectMeta: metav1.ObjectMeta{Name: "data-ca-" + resourceName + "-2", Namespace: "default"},
+				Spec: corev1.PersistentVolumeClaimSpec{
+					AccessModes: []corev1.PersistentVolumeAccessMode{corev1.ReadWriteOnce},
+					Resources: corev1.VolumeResourceRequirements{
+						Requests: corev1.ResourceList{corev1.ResourceStorage: resource.MustParse("1Gi")},
+					},
+				},
+			}
+			Expect(k8sClient.Create(ctx, claim)).To(Succeed())
+			executor.mode = "DECOMMISSIONED"
+			_, err = controllerReconciler.Reconcile(ctx, reconcile.Request{NamespacedName: typeNamespacedName})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(replicas()).To(Equal(int32(2)))
+			Expect(k8sClient.Get(ctx, typeNamespacedName, cr)).To(Succeed())
+			Expect(cr.Status.Operation.Completed).To(ConsistOf("ca-" + resourceName + "-2"))
+			// the claim may be held by its protection finalizer, which no controller removes in envtest
+			err = k8sClient.Get(ctx, client.ObjectKeyFromObject(claim), claim)
+			Expect(errors.IsNotFound(err) || claim.GetDeletionTimestamp() != nil).To(BeTrue())
+
+			_, err = controllerReconciler.Reconcile(ctx, reconcile.Request{NamespacedName: typeNamespacedName})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(k8sClient.Get(ctx, typeNamespacedName, cr)).To(Succeed())
+			Expect(cr.Status.Operation.IsRunning()).To(BeFalse())
+			Expect(cr.Status.Operation.Completed).To(ConsistOf("ca-" + resourceName + "-2"))
+
+			Expect(k8sClient.Delete(ctx, cr)).To(Succeed())
+		})
+	})
+
+	Context("When a rack is removed", func() {
+		const resourceName = "test-removerack"
+
+		ctx := context.Background()
+
+		typeNamespacedName := types.NamespacedName{
+			Name:      resourceName,
+			Namespace: "default",
+		}
+		removedRack := types.NamespacedName{Name: "ca-" + resourceName + "-rack2", Namespace: "default"}
+
+		It("should decommission its nodes before deleting its StatefulSet", func() {
+			cr := &cassandraaxonopscomv1.AxonOpsCassandra{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      resourceName,
+					Namespace: "default",
+				},
+				Spec: cassandraaxonopscomv1.AxonOpsCassandraSpec{
+					ParallelStartup: true,
+					Cassandra: cassandraaxonopscomv1.AxonOpsCassandraCluster{
+						Racks: []cassandraaxonopscomv1.Rack{
+							{Name: "rack1", Replicas: 1},
+							{Name: "rack2", Replicas: 1},
+						},
+					},
+				},
+			}
+			Expect(k8sClient.Create(ctx, cr)).To(Succeed())
+
+			executor := &fakeExecutor{mode: "NORMAL"}
+			controllerReconciler := &AxonOpsCassandraReconciler{
+				Client:   k8sClient,
+				Scheme:   k8sClient.Scheme(),
+				Recorder: record.NewFakeRecorder(100),
+				Ctx:      ctx,
+				Executor: executor,
+			}
+			_, err := controllerReconciler.Reconcile(ctx, reconcile.Request{NamespacedName: typeNamespacedName})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(k8sClient.Get(ctx, removedRack, &appsv1.StatefulSet{})).To(Succeed())
+
+			By("waiting for the remaining racks to be ready")
+			Expect(k8sClient.Get(ctx, typeNamespacedName, cr)).To(Succeed())
+			cr.Spec.Cassandra.Racks = cr.Spec.Cassandra.Racks[:1]
+			Expect(k8sClient.Update(ctx, cr)).To(Succeed())
+			_, err = controllerReconciler.Reconcile(ctx, reconcile.Request{NamespacedName: typeNamespacedName})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(k8sClient.Get(ctx, removedRack, &appsv1.StatefulSet{})).To(Succeed())
+			Expect(executor.ran("decommission")).To(BeFalse())
+
+			By("decommissioning the nodes of the removed rack")
+			sts := &appsv1.StatefulSet{}
+			Expect(k8sClient.Get(ctx, types.NamespacedName{Name: "ca-" + resourceName + "-rack1", Namespace: "default"}, sts)).To(Succeed())
+			sts.Status.Replicas = 1
+			sts.Status.ReadyReplicas = 1
+			Expect(k8sClient.Status().Update(ctx, sts)).To(Succeed())
+			_, err = controllerReconciler.Reconcile(ctx, reconcile.Request{NamespacedName: typeNamespacedName})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(executor.ran("ca-" + resourceName + "-rack2-0: bash -c")).To(BeTrue())
+			Expect(executor.ran("nodetool decommission")).To(BeTrue())
+			Expect(k8sClient.Get(ctx, removedRack, sts)).To(Succeed())
+			Expect(*sts.Spec.Replicas).To(Equal(int32(1)))
+
+			By("deleting the StatefulSet once its nodes left the ring")
+			executor.mode = "DECOMMISSIONED"
+			_, err = controllerReconciler.Reconcile(ctx, reconcile.Request{NamespacedName: typeNamespacedName})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(errors.IsNotFound(k8sClient.Get(ctx, removedRack, &appsv1.StatefulSet{}))).To(BeTrue())
+			Expect(k8sClient.Get(ctx, typeNamespacedName, cr)).To(Succeed())
+			Expect(cr.Status.Operation.Completed).To(ConsistOf("ca-" + resourceName + "-rack2-0"))
+
+			Expect(k8sClient.Delete(ctx, cr)).To(Succeed())
+		})
+	})
+
+	Context("When the Cassandra cluster is scaled up", func() {
+		const resourceName = "test-scaleup"
+
+		ctx := context.Background()
+
+		typeNamespacedName := types.NamespacedName{
+			Name:      resourceName,
+			Namespace: "default",
+		}
+
+		markReady := func() {
+			sts := &appsv1.StatefulSet{}
+			Expect(k8sClient.Get(ctx, types.NamespacedName{Name: "ca-" + resourceName, Namespace: "default"}, sts)).To(Succeed())
+			sts.Status.ObservedGeneration = sts.Generation
+			sts.Status.Replicas = *sts.Spec.Replicas
+			sts.Status.ReadyReplicas = *sts.Spec.Replicas
+			sts.Status.UpdatedReplicas = *sts.Spec.Replicas
+			Expect(k8sClient.Status().Update(ctx, sts)).To(Succeed())
+		}
+
+		It("should clean up the existing nodes once the new ones are ready", func() {
+			cr := &cassandraaxonopscomv1.AxonOpsCassandra{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      resourceName,
+					Namespace: "default",
+				},
+				Spec: cassandraaxonopscomv1.AxonOpsCassandraSpec{
+					ParallelStartup: true,
+					Cassandra:       cassandraaxonopscomv1.AxonOpsCassandraCluster{Replicas: 1},
+				},
+			}
+			Expect(k8sClient.Create(ctx, cr)).To(Succeed())
+
+			executor := &fakeExecutor{mode: "NORMAL"}
+			controllerReconciler := &AxonOpsCassandraReconciler{
+				Client:   k8sClient,
+				Scheme:   k8sClient.Scheme(),
+				Recorder: record.NewFakeRecorder(100),
+				Ctx:      ctx,
+				Executor: executor,
+			}
+			_, err := controllerReconciler.Reconcile(ctx, reconcile.Request{NamespacedName: typeNamespacedName})
+			Expect(err).NotTo(HaveOccurred())
+			markReady()
+
+			By("queueing the existing nodes when the replicas are raised")
+			Expect(k8sClient.Get(ctx, typeNamespacedName, cr)).To(Succeed())
+			cr.Spec.Cassandra.Replicas = 3
+			Expect(k8sClient.Update(ctx, cr)).To(Succeed())
+			_, err = controllerReconciler.Reconcile(ctx, reconcile.Request{NamespacedName: typeNamespacedName})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(k8sClient.Get(ctx, typeNamespacedName, cr)).To(Succeed())
+			Expect(cr.Status.Operation.Type).To(Equal(cassandraaxonopscomv1.NodeOperationCleanup))
+			Expect(cr.Status.Operation.Pending).To(ConsistOf("ca-" + resourceName + "-0"))
+			Expect(executor.ran("nodetool cleanup")).To(BeFalse())
+
+			By("running the cleanup once the new nodes are ready")
+			markReady()
+			_, err = controllerReconciler.Reconcile(ctx, reconcile.Request{NamespacedName: typeNamespacedName})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(executor.ran("ca-" + resourceName + "-0: bash -c")).To(BeTrue())
+			Expect(executor.ran("nodetool cleanup")).To(BeTrue())
+			Expect(k8sClient.Get(ctx, typeNamespacedName, cr)).To(Succeed())
+			Expect(cr.Status.Operation.Node).To(Equal("ca-" + resourceName + "-0"))
+			Expect(cr.Status.Operation.Pending).To(BeEmpty())
+
+			By("recording the cleaned up node")
+			executor.done = "0"
+			result, err := controllerReconciler.Reconcile(ctx, reconcile.Request{NamespacedName: typeNamespacedName})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(k8sClient.Get(ctx, typeNamespacedName, cr)).To(Succeed())
+			Expect(cr.Status.Operation.IsRunning()).To(BeFalse())
+			Expect(cr.Status.Operation.Completed).To(ConsistOf("ca-" + resourceName + "-0"))
+			Expect(result.RequeueAfter).To(BeNumerically(">", 0))
+
+			Expect(k8sClient.Delete(ctx, cr)).To(Succeed())
+		})
+	})
+
+	Context("When a restart of the Cassandra nodes is requested", func() {
+		const resourceName = "test-restart"
+
+		ctx := context.Background()
+
+		typeNamespacedName := types.NamespacedName{
+			Name:      resourceName,
+			Namespace: "default",
+		}
+
+		// createPod stands in for the StatefulSet controller, which does not run in envtest
+		createPod := func(name string, revision string) {
+			pod := &corev1.Pod{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      "ca-" + name + "-0",
+					Namespace: "default",
+					Labels:    map[string]string{appsv1.ControllerRevisionHashLabelKey: revision},
+				},
+				Spec: corev1.PodSpec{Containers: []corev1.Container{{Name: "cassandra", Image: "cassandra"}}},
+			}
+			Expect(k8sClient.Create(ctx, pod)).To(Succeed())
+			pod.Status.PodIP = "10.0.0.1"
+			pod.Status.Conditions = []corev1.PodCondition{{Type: corev1.PodReady, Status: corev1.ConditionTrue}}
+			Expect(k8sClient.Status().Update(ctx, pod)).To(Succeed())
+		}
+
+		It("should drain and restart the nodes one at a time", func() {
+			size := resource.MustParse("1Gi")
+			cr := &cassandraaxonopscomv1.AxonOpsCassandra{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      resourceName,
+					Namespace: "default",
+				},
+				Spec: cassandraaxonopscomv1.AxonOpsCassandraSpec{
+					ParallelStartup: true,
+					Cassandra: cassandraaxonopscomv1.AxonOpsCassandraCluster{
+						Replicas:         1,
+						PersistentVolume: cassandraaxonopscomv1.PersistentVolumeSpec{Size: &size},
+					},
+				},
+			}
+			Expect(k8sClient.Create(ctx, cr)).To(Succeed())
+
+			executor := &fakeExecutor{mode: "NORMAL"}
+			controllerReconciler := &AxonOpsCassandraReconciler{
+				Client:   k8sClient,
+				Scheme:   k8sClient.Scheme(),
+				Recorder: record.NewFakeRecorder(100),
+				Ctx:      ctx,
+				Executor: executor,
+			}
+			_, err := controllerReconciler.Reconcile(ctx, reconcile.Request{NamespacedName: typeNamespacedName})
+			Expect(err).NotTo(HaveOccurred())
+
+			By("leaving the restarts to the operator")
+			sts := &appsv1.StatefulSet{}
+			Expect(k8sClient.Get(ctx, types.NamespacedName{Name: "ca-" + resourceName, Namespace: "default"}, sts)).To(Succeed())
+			Expect(sts.Spec.UpdateStrategy.Type).To(Equal(appsv1.OnDeleteStatefulSetStrategyType))
+			Expect(sts.Spec.Template.Annotations).To(HaveKey(cassandraaxonopscomv1.ConfigHashAnnotation))
+
+			By("copying the restart-at annotation to the pod template")
+			Expect(k8sClient.Get(ctx, typeNamespacedName, cr)).To(Succeed())
+			cr.Annotations = map[string]string{cassandraaxonopscomv1.RestartAtAnnotation: "2024-06-01T10:00:00Z"}
+			Expect(k8sClient.Update(ctx, cr)).To(Succeed())
+			_, err = controllerReconciler.Reconcile(ctx, reconcile.Request{NamespacedName: typeNamespacedName})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(k8sClient.Get(ctx, types.NamespacedName{Name: "ca-" + resourceName, Namespace: "default"}, sts)).To(Succeed())
+			Expect(sts.Spec.Template.Annotations).To(HaveKeyWithValue(cassandraaxonopscomv1.RestartAtAnnotation, "2024-06-01T10:00:00Z"))
+
+			By("draining and deleting the pod running the previous template")
+			createPod(resourceName, "rev1")
+			sts.Status.ObservedGeneration = sts.Generation
+			sts.Status.Replicas = 1
+			sts.Status.ReadyReplicas = 1
+			sts.Status.UpdateRevision = "rev2"
+			Expect(k8sClient.Status().Update(ctx, sts)).To(Succeed())
+			_, err = controllerReconciler.Reconcile(ctx, reconcile.Request{NamespacedName: typeNamespacedName})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(executor.ran("ca-" + resourceName + "-0: nodetool drain")).To(BeTrue())
+			pod := &corev1.Pod{}
+			err = k8sClient.Get(ctx, types.NamespacedName{Name: "ca-" + resourceName + "-0", Namespace: "default"}, pod)
+			Expect(errors.IsNotFound(err)).To(BeTrue())
+			Expect(k8sClient.Get(ctx, typeNamespacedName, cr)).To(Succeed())
+			Expect(cr.Status.Operation.Type).To(Equal(cassandraaxonopscomv1.NodeOperationRestart))
+			Expect(cr.Status.Operation.Node).To(Equal("ca-" + resourceName + "-0"))
+
+			By("waiting for the node to be up and normal")
+			createPod(resourceName, "rev2")
+			executor.status = "DN  10.0.0.1  100 KiB  16  100.0%  8d5ed9f4  rack1\n"
+			_, err = controllerReconciler.Reconcile(ctx, reconcile.Request{NamespacedName: typeNamespacedName})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(k8sClient.Get(ctx, typeNamespacedName, cr)).To(Succeed())
+			Expect(cr.Status.Operation.IsRunning()).To(BeTrue())
+
+			executor.status = "UN  10.0.0.1  100 KiB  16  100.0%  8d5ed9f4  rack1\n"
+			_, err = controllerReconciler.Reconcile(ctx, reconcile.Request{NamespacedName: typeNamespacedName})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(k8sClient.Get(ctx, typeNamespacedName, cr)).To(Succeed())
+			Expect(cr.Status.Operation.IsRunning()).To(BeFalse())
+			Expect(cr.Status.Operation.Completed).To(ConsistOf("ca-" + resourceName + "-0"))
+
+			Expect(k8sClient.Delete(ctx, pod)).To(Or(Succeed(), Satisfy(errors.IsNotFound)))
+			Expect(k8sClient.Delete(ctx, cr)).To(Succeed())
+		})
+
+		It("should restart the nodes keeping their data on the container filesystem without draining them", func() {
+			name := resourceName + "-ephemeral"
+			cr := &cassandraaxonopscomv1.AxonOpsCassandra{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      name,
+					Namespace: "default",
+				},
+				Spec: cassandraaxonopscomv1.AxonOpsCassandraSpec{
+					ParallelStartup: true,
+					Cassandra:       cassandraaxonopscomv1.AxonOpsCassandraCluster{Replicas: 1},
+				},
+			}
+			Expect(k8sClient.Create(ctx, cr)).To(Succeed())
+
+			executor := &fakeExecutor{mode: "NORMAL"}
+			controllerReconciler := &AxonOpsCassandraReconciler{
+				Client:   k8sClient,
+				Scheme:   k8sClient.Scheme(),
+				Recorder: record.NewFakeRecorder(100),
+				Ctx:      ctx,
+				Executor: executor,
+			}
+			request := reconcile.Request{NamespacedName: types.NamespacedName{Name: name, Namespace: "default"}}
+			_, err := controllerReconciler.Reconcile(ctx, request)
+			Expect(err).NotTo(HaveOccurred())
+
+			By("deleting the outdated pod so its preStop hook decommissions the node")
+			createPod(name, "rev1")
+			sts := &appsv1.StatefulSet{}
+			Expect(k8sClient.Get(ctx, types.NamespacedName{Name: "ca-" + name, Namespace: "default"}, sts)).To(Succeed())
+			sts.Status.ObservedGeneration = sts.Generation
+			sts.Status.Replicas = 1
+			sts.Status.ReadyReplicas = 1
+			sts.Status.UpdateRevision = "rev2"
+			Expect(k8sClient.Status().Update(ctx, sts)).To(Succeed())
+			_, err = controllerReconciler.Reconcile(ctx, request)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(executor.ran("nodetool drain")).To(BeFalse())
+			pod := &corev1.Pod{}
+			err = k8sClient.Get(ctx, types.NamespacedName{Name: "ca-" + name + "-0", Namespace: "default"}, pod)
+			Expect(errors.IsNotFound(err)).To(BeTrue())
+			Expect(k8sClient.Get(ctx, request.NamespacedName, cr)).To(Succeed())
+			Expect(cr.Status.Operation.Type).To(Equal(cassandraaxonopscomv1.NodeOperationRestart))
+			Expect(cr.Status.Operation.Node).To(Equal("ca-" + name + "-0"))
+
+			Expect(k8sClient.Delete(ctx, cr)).To(Succeed())
+		})
+	})
+
+	Context("When the Cassandra major version is changed", func() {
+		const resourceName = "test-upgrade"
+
+		ctx := context.Background()
+
+		typeNamespacedName := types.NamespacedName{
+			Name:      resourceName,
+			Namespace: "default",
+		}
+
+		statefulSet := func() *appsv1.StatefulSet {
+			sts := &appsv1.StatefulSet{}
+			Expect(k8sClient.Get(ctx, types.NamespacedName{Name: "ca-" + resourceName, Namespace: "default"}, sts)).To(Succeed())
+			return sts
+		}
+
+		It("should snapshot, restart and upgrade the SSTables of the nodes", func() {
+			size := resource.MustParse("1Gi")
+			cr := &cassandraaxonopscomv1.AxonOpsCassandra{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      resourceName,
+					Namespace: "default",
+				},
+				Spec: cassandraaxonopscomv1.AxonOpsCassandraSpec{
+					ParallelStartup: true,
+					Cassandra: cassandraaxonopscomv1.AxonOpsCassandraCluster{
+						Replicas:         1,
+						Image:            cassandraaxonopscomv1.ContainerImage{Repository: "cassandra", Tag: "4.1.5"},
+						PersistentVolume: cassandraaxonopscomv1.PersistentVolumeSpec{Size: &size},
+					},
+				},
+			}
+			Expect(k8sClient.Create(ctx, cr)).To(Succeed())
+
+			executor := &fakeExecutor{mode: "NORMAL"}
+			controllerReconciler := &AxonOpsCassandraReconciler{
+				Client:   k8sClient,
+				Scheme:   k8sClient.Scheme(),
+				Recorder: record.NewFakeRecorder(100),
+				Ctx:      ctx,
+				Executor: executor,
+			}
+			_, err := controllerReconciler.Reconcile(ctx, reconcile.Request{NamespacedName: typeNamespacedName})
+			Expect(err).NotTo(HaveOccurred())
+
+			By("taking a snapshot before the new image is rolled out")
+			Expect(k8sClient.Get(ctx, typeNamespacedName, cr)).To(Succeed())
+			cr.Spec.Cassandra.Image.Tag = "5.0.2"
+			Expect(k8sClient.Update(ctx, cr)).To(Succeed())
+			_, err = controllerReconciler.Reconcile(ctx, reconcile.Request{NamespacedName: typeNamespacedName})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(executor.ran("ca-" + resourceName + "-0: nodetool snapshot -t pre-upgrade-")).To(BeTrue())
+			Expect(k8sClient.Get(ctx, typeNamespacedName, cr)).To(Succeed())
+			Expect(cr.Status.Upgrade.From).To(Equal("cassandra:4.1.5"))
+			Expect(cr.Status.Upgrade.To).To(Equal("cassandra:5.0.2"))
+			Expect(cr.Status.Upgrade.Phase).To(Equal(cassandraaxonopscomv1.UpgradePhaseRestart))
+			Expect(statefulSet().Spec.Template.Spec.Containers[0].Image).To(Equal("cassandra:5.0.2"))
+
+			By("upgrading the SSTables once every node runs the new version")
+			sts := statefulSet()
+			sts.Status.ObservedGeneration = sts.Generation
+			sts.Status.Replicas = 1
+			sts.Status.ReadyReplicas = 1
+			sts.Status.UpdatedReplicas = 1
+			Expect(k8sClient.Status().Update(ctx, sts)).To(Succeed())
+			for i := 0; i < 2; i++ {
+				_, err = controllerReconciler.Reconcile(ctx, reconcile.Request{NamespacedName: typeNamespacedName})
+				Expect(err).NotTo(HaveOccurred())
+			}
+			Expect(executor.ran("nodetool upgradesstables")).To(BeTrue())
+			Expect(k8sClient.Get(ctx, typeNamespacedName, cr)).To(Succeed())
+			Expect(cr.Status.Upgrade.Phase).To(Equal(cassandraaxonopscomv1.UpgradePhaseUpgradeSSTables))
+			Expect(cr.Status.Operation.Node).To(Equal("ca-" + resourceName + "-0"))
+
+			executor.done = "0"
+			_, err = controllerReconciler.Reconcile(ctx, reconcile.Request{NamespacedName: typeNamespacedName})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(k8sClient.Get(ctx, typeNamespacedName, cr)).To(Succeed())
+			Expect(cr.Status.Upgrade.Phase).To(Equal(cassandraaxonopscomv1.UpgradePhaseCompleted))
+			Expect(cr.Status.Operation.Completed).To(ConsistOf("ca-" + resourceName + "-0"))
+
+			Expect(k8sClient.Delete(ctx, cr)).To(Succeed())
+		})
+
+		It("should halt the upgrade of the nodes without a persistent volume", func() {
+			name := resourceName + "-ephemeral"
+			cr := &cassandraaxonopscomv1.AxonOpsCassandra{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      name,
+					Namespace: "default",
+				},
+				Spec: cassandraaxonopscomv1.AxonOpsCassandraSpec{
+					ParallelStartup: true,
+					Cassandra: cassandraaxonopscomv1.AxonOpsCassandraCluster{
+						Replicas: 1,
+						Image:    cassandraaxonopscomv1.ContainerImage{Repository: "cassandra", Tag: "4.1.5"},
+					},
+				},
+			}
+			Expect(k8sClient.Create(ctx, cr)).To(Succeed())
+
+			executor := &fakeExecutor{mode: "NORMAL"}
+			controllerReconciler := &AxonOpsCassandraReconciler{
+				Client:   k8sClient,
+				Scheme:   k8sClient.Scheme(),
+				Recorder: record.NewFakeRecorder(100),
+				Ctx:      ctx,
+				Executor: executor,
+			}
+			request := reconcile.Request{NamespacedName: types.NamespacedName{Name: name, Namespace: "default"}}
+			_, err := controllerReconciler.Reconcile(ctx, request)
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(k8sClient.Get(ctx, request.NamespacedName, cr)).To(Succeed())
+			cr.Spec.Cassandra.Image.Tag = "5.0.2"
+			Expect(k8sClient.Update(ctx, cr)).To(Succeed())
+			_, err = controllerReconciler.Reconcile(ctx, request)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(executor.ran("nodetool snapshot")).To(BeFalse())
+			sts := &appsv1.StatefulSet{}
+			Expect(k8sClient.Get(ctx, types.NamespacedName{Name: "ca-" + name, Namespace: "default"}, sts)).To(Succeed())
+			Expect(sts.Spec.Template.Spec.Containers[0].Image).To(Equal("cassandra:4.1.5"))
+			Expect(k8sClient.Get(ctx, request.NamespacedName, cr)).To(Succeed())
+			cond := meta.FindStatusCondition(cr.Status.Conditions, cassandraaxonopscomv1.ConditionUpgradeHalted)
+			Expect(cond).NotTo(BeNil())
+			Expect(cond.Reason).To(Equal(reasonNoPersistentVolume))
+
+			Expect(k8sClient.Delete(ctx, cr)).To(Succeed())
+		})
+	})
+
+	Context("When a pod of the Cassandra cluster lost its volume", func() {
+		const resourceName = "test-deadnode"
+		const deadHostID = "9b7e2a44-1c2d-4e5f-8a9b-0c1d2e3f4a5b"
+
+		ctx := context.Background()
+
+		typeNamespacedName := types.NamespacedName{
+			Name:      resourceName,
+			Namespace: "default",
+		}
+
+		It("should report the dead node and remove it when asked to", func() {
+			cr := &cassandraaxonopscomv1.AxonOpsCassandra{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      resourceName,
+					Namespace: "default",
+				},
+				Spec: cassandraaxonopscomv1.AxonOpsCassandraSpec{
+					ParallelStartup: true,
+					Cassandra:       cassandraaxonopscomv1.AxonOpsCassandraCluster{Replicas: 1},
+				},
+			}
+			Expect(k8sClient.Create(ctx, cr)).To(Succeed())
+
+			executor := &fakeExecutor{mode: "NORMAL", status: `Datacenter: dc1
+--  Address   Load        Tokens  Owns (effective)  Host ID                               Rack
+UN  10.0.0.2  104.33 KiB  16      100.0%            1d2f5c1e-7a43-4f3e-9b8e-2f6a0f0c9c11  rack1
+DN  10.0.0.1  ?           16      100.0%            ` + deadHostID + `  rack1
+`}
+			controllerReconciler := &AxonOpsCassandraReconciler{
+				Client:   k8sClient,
+				Scheme:   k8sClient.Scheme(),
+				Recorder: record.NewFakeRecorder(100),
+				Ctx:      ctx,
+				Executor: executor,
+			}
+			_, err := controllerReconciler.Reconcile(ctx, reconcile.Request{NamespacedName: typeNamespacedName})
+			Expect(err).NotTo(HaveOccurred())
+
+			sts := &appsv1.StatefulSet{}
+			Expect(k8sClient.Get(ctx, types.NamespacedName{Name: "ca-" + resourceName, Namespace: "default"}, sts)).To(Succeed())
+			sts.Status.ObservedGeneration = sts.Generation
+			sts.Status.Replicas = 1
+			sts.Status.ReadyReplicas = 1
+			sts.Status.UpdatedReplicas = 1
+			Expect(k8sClient.Status().Update(ctx, sts)).To(Succeed())
+			pod := &corev1.Pod{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      "ca-" + resourceName + "-0",
+					Namespace: "default",
+					Labels:    map[string]string{"app": "ca-" + resourceName},
+				},
+				Spec: corev1.PodSpec{Containers: []corev1.Container{{Name: "cassandra", Image: "cassandra"}}},
+			}
+			Expect(k8sClient.Create(ctx, pod)).To(Succeed())
+			pod.Status.PodIP = "10.0.0.2"
+			Expect(k8sClient.Status().Update(ctx, pod)).To(Succeed())
+
+			By("reporting the node down that no pod runs")
+			_, err = controllerReconciler.Reconcile(ctx, reconcile.Request{NamespacedName: typeNamespacedName})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(k8sClient.Get(ctx, typeNamespacedName, cr)).To(Succeed())
+			Expect(cr.Status.DeadNodes).To(ConsistOf(cassandraaxonopscomv1.DeadNode{
+				HostID: deadHostID, Address: "10.0.0.1", DC: "dc1", Rack: "rack1",
+			}))
+			Expect(meta.IsStatusConditionTrue(cr.Status.Conditions, cassandraaxonopscomv1.ConditionDeadNodes)).To(BeTrue())
+			Expect(executor.ran("removenode")).To(BeFalse())
+
+			By("removing it once its host ID is in the annotation")
+			cr.Annotations = map[string]string{cassandraaxonopscomv1.RemoveNodeAnnotation: deadHostID}
+			Expect(k8sClient.Update(ctx, cr)).To(Succeed())
+			_, err = controllerReconciler.Reconcile(ctx, reconcile.Request{NamespacedName: typeNamespacedName})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(executor.ran("nodetool removenode " + deadHostID)).To(BeTrue())
+			Expect(k8sClient.Get(ctx, typeNamespacedName, cr)).To(Succeed())
+			Expect(cr.Status.Operation.Type).To(Equal(cassandraaxonopscomv1.NodeOperationRemoveNode))
+			Expect(cr.Status.Operation.Node).To(Equal(deadHostID))
+
+			executor.done = "0"
+			executor.status = ""
+			_, err = controllerReconciler.Reconcile(ctx, reconcile.Request{NamespacedName: typeNamespacedName})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(k8sClient.Get(ctx, typeNamespacedName, cr)).To(Succeed())
+			Expect(cr.Status.Operation.IsRunning()).To(BeFalse())
+			Expect(cr.Status.Operation.Completed).To(ConsistOf(deadHostID))
+			Expect(cr.Status.DeadNodes).To(BeEmpty())
+			Expect(meta.FindStatusCondition(cr.Status.Conditions, cassandraaxonopscomv1.ConditionDeadNodes)).To(BeNil())
+
+			Expect(k8sClient.Delete(ctx, pod)).To(Succeed())
+			Expect(k8sClient.Delete(ctx, cr)).To(Succeed())
+		})
+	})
+
+	Context("When cassandra.yaml settings are configured", func() {
+		const resourceName = "test-config"
+
+		ctx := context.Background()
+
+		typeNamespacedName := types.NamespacedName{
+			Name:      resourceName,
+			Namespace: "default",
+		}
+
+		It("should merge them through a ConfigMap and restart the nodes when they change", func() {
+			cr := &cassandraaxonopscomv1.AxonOpsCassandra{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      resourceName,
+					Namespace: "default",
+				},
+				Spec: cassandraaxonopscomv1.AxonOpsCassandraSpec{
+					ParallelStartup: true,
+					Cassandra: cassandraaxonopscomv1.AxonOpsCassandraCluster{
+						Replicas: 1,
+						Image:    cassandraaxonopscomv1.ContainerImage{Tag: "4.0.13"},
+						Config: map[string]apiextensionsv1.JSON{
+							"read_request_timeout": {Raw: []byte(`"10s"`)},
+						},
+					},
+				},
+			}
+			Expect(k8sClient.Create(ctx, cr)).To(Succeed())
+
+			controllerReconciler := &AxonOpsCassandraReconciler{
+				Client:   k8sClient,
+				Scheme:   k8sClient.Scheme(),
+				Recorder: record.NewFakeRecorder(100),
+				Ctx:      ctx,
+				Executor: &fakeExecutor{mode: "NORMAL"},
+			}
+			_, err := controllerReconciler.Reconcile(ctx, reconcile.Request{NamespacedName: typeNamespacedName})
+			Expect(err).NotTo(HaveOccurred())
+
+			By("writing the settings with the names of the Cassandra version")
+			configMap := &corev1.ConfigMap{}
+			configMapName := types.NamespacedName{Name: "ca-" + resourceName + "-config", Namespace: "default"}
+			Expect(k8sClient.Get(ctx, configMapName, configMap)).To(Succeed())
+			Expect(configMap.Data).To(HaveKeyWithValue("cassandra.yaml", "read_request_timeout_in_ms: 10000\n"))
+			Expect(configMap.Data["replaced-keys"]).To(ContainSubstring("read_request_timeout\n"))
+
+			By("merging them into cassandra.yaml before Cassandra starts")
+			sts := &appsv1.StatefulSet{}
+			Expect(k8sClient.Get(ctx, types.NamespacedName{Name: "ca-" + resourceName, Namespace: "default"}, sts)).To(Succeed())
+			Expect(sts.Spec.Template.Spec.InitContainers).To(HaveLen(1))
+			Expect(sts.Spec.Template.Spec.Containers[0].VolumeMounts).To(ContainElement(
+				HaveField("MountPath", "/etc/cassandra")))
+			hash := sts.Spec.Template.Annotations[cassandraaxonopscomv1.ConfigHashAnnotation]
+
+			By("changing the hash of the pod template when they change")
+			Expect(k8sClient.Get(ctx, typeNamespacedName, cr)).To(Succeed())
+			cr.Spec.Cassandra.Config["read_request_timeout"] = apiextensionsv1.JSON{Raw: []byte(`"20s"`)}
+			Expect(k8sClient.Update(ctx, cr)).To(Succeed())
+			_, err = controllerReconciler.Reconcile(ctx, reconcile.Request{NamespacedName: typeNamespacedName})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(k8sClient.Get(ctx, types.NamespacedName{Name: "ca-" + resourceName, Namespace: "default"}, sts)).To(Succeed())
+			Expect(sts.Spec.Template.Annotations[cassandraaxonopscomv1.ConfigHashAnnotation]).NotTo(Equal(hash))
+
+			By("deleting the ConfigMap once the settings are removed")
+			Expect(k8sClient.Get(ctx, typeNamespacedName, cr)).To(Succeed())
+			cr.Spec.Cassandra.Config = nil
+			Expect(k8sClient.Update(ctx, cr)).To(Succeed())
+			_, err = controllerReconciler.Reconcile(ctx, reconcile.Request{NamespacedName: typeNamespacedName})
+			Expect(err).NotTo(HaveOccurred())
+			err = k8sClient.Get(ctx, configMapName, configMap)
+			Expect(errors.IsNotFound(err)).To(BeTrue())
+			Expect(k8sClient.Get(ctx, types.NamespacedName{Name: "ca-" + resourceName, Namespace: "default"}, sts)).To(Succeed())
+			Expect(sts.Spec.Template.Spec.InitContainers).To(BeEmpty())
+
+			Expect(k8sClient.Delete(ctx, cr)).To(Succeed())
+		})
+	})
+
+	Context("When authentication is enabled", func() {
+		const resourceName = "test-auth"
+
+		ctx := context.Background()
+
+		typeNamespacedName := types.NamespacedName{
+			Name:      resourceName,
+			Namespace: "default",
+		}
+
+		It("should generate the superuser credentials once and enable PasswordAuthenticator", func() {
+			cr := &cassandraaxonopscomv1.AxonOpsCassandra{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      resourceName,
+					Namespace: "default",
+				},
+				Spec: cassandraaxonopscomv1.AxonOpsCassandraSpec{
+					ParallelStartup: true,
+					Cassandra: cassandraaxonopscomv1.AxonOpsCassandraCluster{
+						Replicas:       1,
+						Authentication: cassandraaxonopscomv1.Authentication{Enabled: true},
+					},
+				},
+			}
+			Expect(k8sClient.Create(ctx, cr)).To(Succeed())
+
+			controllerReconciler := &AxonOpsCassandraReconciler{
+				Client:   k8sClient,
+				Scheme:   k8sClient.Scheme(),
+				Recorder: record.NewFakeRecorder(100),
+				Ctx:      ctx,
+				Executor: &fakeExecutor{mode: "NORMAL"},
+			}
+			_, err := controllerReconciler.Reconcile(ctx, reconcile.Request{NamespacedName: typeNamespacedName})
+			Expect(err).NotTo(HaveOccurred())
+
+			By("storing a random password for the admin superuser in a Secret owned by the resource")
+			secret := &corev1.Secret{}
+			secretName := types.NamespacedName{Name: "ca-" + resourceName + "-superuser", Namespace: "default"}
+			Expect(k8sClient.Get(ctx, secretName, secret)).To(Succeed())
+			Expect(secret.Data).To(HaveKeyWithValue("username", []byte("admin")))
+			Expect(secret.Data["password"]).To(HaveLen(24))
+			Expect(secret.OwnerReferences).To(ContainElement(HaveField("Name", resourceName)))
+			password := secret.Data["password"]
+
+			By("reporting the Secret in the status")
+			Expect(k8sClient.Get(ctx, typeNamespacedName, cr)).To(Succeed())
+			Expect(cr.Status.Authentication).NotTo(BeNil())
+			Expect(cr.Status.Authentication.Secret).To(Equal(secretName.Name))
+
+			By("enabling the authentication in cassandra.yaml")
+			configMap := &corev1.ConfigMap{}
+			Expect(k8sClient.Get(ctx, types.NamespacedName{Name: "ca-" + resourceName + "-config", Namespace: "default"}, configMap)).To(Succeed())
+			Expect(configMap.Data["cassandra.yaml"]).To(ContainSubstring("authenticator: PasswordAuthenticator"))
+			Expect(configMap.Data["cassandra.yaml"]).To(ContainSubstring("authorizer: CassandraAuthorizer"))
+
+			By("giving the credentials to the Cassandra container")
+			sts := &appsv1.StatefulSet{}
+			Expect(k8sClient.Get(ctx, types.NamespacedName{Name: "ca-" + resourceName, Namespace: "default"}, sts)).To(Succeed())
+			Expect(sts.Spec.Template.Spec.Containers[0].Env).To(ContainElement(And(
+				HaveField("Name", "CASSANDRA_SUPERUSER_PASSWORD"),
+				HaveField("ValueFrom.SecretKeyRef.Name", secretName.Name))))
+
+			By("keeping the password on the next reconcile")
+			_, err = controllerReconciler.Reconcile(ctx, reconcile.Request{NamespacedName: typeNamespacedName})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(k8sClient.Get(ctx, secretName, secret)).To(Succeed())
+			Expect(secret.Data["password"]).To(Equal(password))
+
+			Expect(k8sClient.Delete(ctx, cr)).To(Succeed())
+		})
+	})
+
+	Context("When TLS is enabled", func() {
+		const resourceName = "test-tls"
+
+		ctx := context.Background()
+
+		typeNamespacedName := types.NamespacedName{
+			Name:      resourceName,
+			Namespace: "default",
+		}
+
+		It("should issue the keystores of the nodes from the certificate authority of the operator", func() {
+			cr := &cassandraaxonopscomv1.AxonOpsCassandra{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      resourceName,
+					Namespace: "default",
+				},
+				Spec: cassandraaxonopscomv1.AxonOpsCassandraSpec{
+					ParallelStartup: true,
+					Cassandra: cassandraaxonopscomv1.AxonOpsCassandraCluster{
+						Replicas: 2,
+						TLS:      cassandraaxonopscomv1.TLS{Enabled: true},
+					},
+				},
+			}
+			Expect(k8sClient.Create(ctx, cr)).To(Succeed())
+
+			controllerReconciler := &AxonOpsCassandraReconciler{
+				Client:   k8sClient,
+				Scheme:   k8sClient.Scheme(),
+				Recorder: record.NewFakeRecorder(100),
+				Ctx:      ctx,
+				Executor: &fakeExecutor{mode: "NORMAL"},
+			}
+			_, err := controllerReconciler.Reconcile(ctx, reconcile.Request{NamespacedName: typeNamespacedName})
+			Expect(err).NotTo(HaveOccurred())
+
+			By("generating the certificate authority in a Secret owned by the resource")
+			ca := &corev1.Secret{}
+			caName := types.NamespacedName{Name: "ca-" + resourceName + "-ca", Namespace: "default"}
+			Expect(k8sClient.Get(ctx, caName, ca)).To(Succeed())
+			Expect(ca.Type).To(Equal(corev1.SecretTypeTLS))
+			Expect(ca.Data).To(HaveKey("tls.key"))
+			Expect(ca.OwnerReferences).To(ContainElement(HaveField("Name", resourceName)))
+
+			By("writing a keystore per node and the truststore")
+			keystores := &corev1.Secret{}
+			keystoresName := types.NamespacedName{Name: "ca-" + resourceName + "-keystores", Namespace: "default"}
+			Expect(k8sClient.Get(ctx, keystoresName, keystores)).To(Succeed())
+			for _, key := range []string{"ca-" + resourceName + "-0.p12", "ca-" + resourceName + "-1.p12", "truststore.p12", "password"} {
+				Expect(keystores.Data).To(HaveKey(key))
+			}
+			Expect(keystores.Data["ca.crt"]).To(Equal(ca.Data["tls.crt"]))
+			keystore := keystores.Data["ca-"+resourceName+"-0.p12"]
+
+			By("reporting the Secrets in the status")
+			Expect(k8sClient.Get(ctx, typeNamespacedName, cr)).To(Succeed())
+			Expect(cr.Status.TLS).NotTo(BeNil())
+			Expect(cr.Status.TLS.Secret).To(Equal(keystoresName.Name))
+			Expect(cr.Status.TLS.CASecret).To(Equal(caName.Name))
+
+			By("enabling the client encryption in cassandra.yaml without the password")
+			configMap := &corev1.ConfigMap{}
+			Expect(k8sClient.Get(ctx, types.NamespacedName{Name: "ca-" + resourceName + "-config", Namespace: "default"}, configMap)).To(Succeed())
+			Expect(configMap.Data["cassandra.yaml"]).To(ContainSubstring("client_encryption_options"))
+			Expect(configMap.Data["cassandra.yaml"]).NotTo(ContainSubstring(string(keystores.Data["password"])))
+
+			By("mounting the keystores in the init container")
+			sts := &appsv1.StatefulSet{}
+			Expect(k8sClient.Get(ctx, types.NamespacedName{Name: "ca-" + resourceName, Namespace: "default"}, sts)).To(Succeed())
+			Expect(sts.Spec.Template.Spec.InitContainers).To(ContainElement(And(
+				HaveField("Name", "cassandra-config"),
+				HaveField("VolumeMounts", ContainElement(HaveField("MountPath", "/tls"))))))
+			Expect(sts.Spec.Template.Spec.Volumes).To(ContainElement(HaveField("Secret.SecretName", keystoresName.Name)))
+
+			By("keeping the keystores on the next reconcile")
+			_, err = controllerReconciler.Reconcile(ctx, reconcile.Request{NamespacedName: typeNamespacedName})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(k8sClient.Get(ctx, keystoresName, keystores)).To(Succeed())
+			Expect(keystores.Data["ca-"+resourceName+"-0.p12"]).To(Equal(keystore))
+			Expect(keystores.Annotations).NotTo(HaveKey(cassandraaxonopscomv1.TLSRotatedAtAnnotation))
+
+			Expect(k8sClient.Delete(ctx, cr)).To(Succeed())
+		})
+	})
+
+	Context("When internode and agent encryption are enabled", func() {
+		const resourceName = "test-internode"
+
+		ctx := context.Background()
+
+		typeNamespacedName := types.NamespacedName{
+			Name:      resourceName,
+			Namespace: "default",
+		}
+
+		It("should encrypt the connections between the nodes and to the AxonOps server", func() {
+			cr := &cassandraaxonopscomv1.AxonOpsCassandra{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      resourceName,
+					Namespace: "default",
+				},
+				Spec: cassandraaxonopscomv1.AxonOpsCassandraSpec{
+					ParallelStartup: true,
+					Cassandra: cassandraaxonopscomv1.AxonOpsCassandraCluster{
+						Replicas: 1,
+						TLS:      cassandraaxonopscomv1.TLS{Internode: true, Agent: true},
+					},
+				},
+			}
+			Expect(k8sClient.Create(ctx, cr)).To(Succeed())
+
+			controllerReconciler := &AxonOpsCassandraReconciler{
+				Client:   k8sClient,
+				Scheme:   k8sClient.Scheme(),
+				Recorder: record.NewFakeRecorder(100),
+				Ctx:      ctx,
+				Executor: &fakeExecutor{mode: "NORMAL"},
+			}
+			_, err := controllerReconciler.Reconcile(ctx, reconcile.Request{NamespacedName: typeNamespacedName})
+			Expect(err).NotTo(HaveOccurred())
+
+			By("issuing a certificate for the AxonOps server along with the nodes")
+			keystores := &corev1.Secret{}
+			keystoresName := types.NamespacedName{Name: "ca-" + resourceName + "-keystores", Namespace: "default"}
+			Expect(k8sClient.Get(ctx, keystoresName, keystores)).To(Succeed())
+			Expect(keystores.Data).To(HaveKey("ca-" + resourceName + "-0.p12"))
+			Expect(keystores.Data).NotTo(HaveKey("as-" + resourceName + ".crt"))
+			Expect(keystores.Data).NotTo(HaveKey("as-" + resourceName + ".key"))
+			serverTLS := &corev1.Secret{}
+			Expect(k8sClient.Get(ctx, types.NamespacedName{Name: "as-" + resourceName + "-server-tls", Namespace: "default"}, serverTLS)).To(Succeed())
+			Expect(serverTLS.Data).To(HaveKey("tls.crt"))
+			Expect(serverTLS.Data).To(HaveKey("tls.key"))
+
+			By("reporting the expiry of the certificates")
+			Expect(k8sClient.Get(ctx, typeNamespacedName, cr)).To(Succeed())
+			Expect(cr.Status.TLS).NotTo(BeNil())
+			Expect(cr.Status.TLS.CANotAfter).NotTo(BeNil())
+			Expect(cr.Status.TLS.Certificates).To(ConsistOf(
+				HaveField("Name", "ca-"+resourceName+"-0"),
+				HaveField("Name", "as-"+resourceName)))
+
+			By("encrypting the internode connections only")
+			configMap := &corev1.ConfigMap{}
+			Expect(k8sClient.Get(ctx, types.NamespacedName{Name: "ca-" + resourceName + "-config", Namespace: "default"}, configMap)).To(Succeed())
+			Expect(configMap.Data["cassandra.yaml"]).To(ContainSubstring("internode_encryption: all"))
+			Expect(configMap.Data["cassandra.yaml"]).NotTo(ContainSubstring("client_encryption_options"))
+
+			By("switching the agents to TLS")
+			sts := &appsv1.StatefulSet{}
+			Expect(k8sClient.Get(ctx, types.NamespacedName{Name: "ca-" + resourceName, Namespace: "default"}, sts)).To(Succeed())
+			Expect(sts.Spec.Template.Spec.Containers[0].Env).To(ContainElement(And(
+				HaveField("Name", "AXON_AGENT_TLS_MODE"), HaveField("Value", "TLS"))))
+
+			By("mounting the certificate of the AxonOps server once it is issued")
+			_, err = controllerReconciler.Reconcile(ctx, reconcile.Request{NamespacedName: typeNamespacedName})
+			Expect(err).NotTo(HaveOccurred())
+			server := &appsv1.StatefulSet{}
+			Expect(k8sClient.Get(ctx, types.NamespacedName{Name: "as-" + resourceName, Namespace: "default"}, server)).To(Succeed())
+			Expect(server.Spec.Template.Spec.Volumes).To(ContainElement(HaveField("Secret.SecretName", "as-"+resourceName+"-server-tls")))
+			Expect(server.Spec.Template.Spec.Volumes).NotTo(ContainElement(HaveField("Secret.SecretName", keystoresName.Name)))
+
+			Expect(k8sClient.Delete(ctx, cr)).To(Succeed())
+		})
+	})
+
+	Context("When a generated object is rejected by the API server", func() {
+		const resourceName = "test-events"
+
+		ctx := context.Background()
+
+		typeNamespacedName := types.NamespacedName{
+			Name:      resourceName,
+			Namespace: "default",
+		}
+
+		It("should emit a single Warning event and report the failure in the status", func() {
+			cr := &cassandraaxonopscomv1.AxonOpsCassandra{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      resourceName,
+					Namespace: "default",
+				},
+				Spec: cassandraaxonopscomv1.AxonOpsCassandraSpec{
+					ParallelStartup: true,
+					Cassandra: cassandraaxonopscomv1.AxonOpsCassandraCluster{
+						// Label values must start with an alphanumeric character
+						Labels: map[string]string{"team": "-invalid-"},
+					},
+				},
+			}
+			Expect(k8sClient.Create(ctx, cr)).To(Succeed())
+
+			recorder := record.NewFakeRecorder(100)
+			controllerReconciler := &AxonOpsCassandraReconciler{
+				Client:   k8sClient,
+				Scheme:   k8sClient.Scheme(),
+				Recorder: recorder,
+				Ctx:      ctx,
+			}
+			for i := 0; i < 2; i++ {
+				_, err := controllerReconciler.Reconcile(ctx, reconcile.Request{NamespacedName: typeNamespacedName})
+				Expect(err).To(HaveOccurred())
+			}
+
+			warnings := []string{}
+			created := 0
+			for len(recorder.Events) > 0 {
+				event := <-recorder.Events
+				if strings.HasPrefix(event, corev1.EventTypeWarning) {
+					warnings = append(warnings, event)
+				}
+				if strings.HasPrefix(event, corev1.EventTypeNormal+" "+eventCreated+" ") {
+					created++
+				}
+			}
+			Expect(warnings).To(HaveLen(1))
+			Expect(warnings[0]).To(HavePrefix(corev1.EventTypeWarning + " " + eventCreateFailed + " "))
+			Expect(warnings[0]).To(ContainSubstring("ca-" + resourceName))
+			Expect(created).To(BeNumerically(">", 0))
+
+			Expect(k8sClient.Get(ctx, typeNamespacedName, cr)).To(Succeed())
+			cond := meta.FindStatusCondition(cr.Status.Conditions, cassandraaxonopscomv1.ConditionReconciled)
+			Expect(cond).NotTo(BeNil())
+			Expect(cond.Status).To(Equal(metav1.ConditionFalse))
+			Expect(cond.Reason).To(Equal(eventCreateFailed))
+
+			Expect(k8sClient.Delete(ctx, cr)).To(Succeed())
 		})
 	})
 })
+
+// applyRecorder lists the objects server-side applied through it, the dry-runs of the drift
+// check apart from the writes
+type applyRecorder struct {
+	client.Client
+	applied []string
+	dryRuns []string
+}
+
+func (a *applyRecorder) Apply(ctx context.Context, obj runtime.ApplyConfiguration, opts ...client.ApplyOption) error {
+	name := "unknown"
+	if u, ok := obj.(interface {
+		GetKind() string
+		GetName() string
+	}); ok {
+		name = u.GetKind() + "/" + u.GetName()
+	}
+	if slices.Contains(opts, client.ApplyOption(client.DryRunAll)) {
+		a.dryRuns = append(a.dryRuns, name)
+	} else {
+		a.applied = append(a.applied, name)
+	}
+	return a.Client.Apply(ctx, obj, opts...)
+}
+
+func (a *applyRecorder) reset() {
+	a.applied = nil
+	a.dryRuns = nil
+}
+
+// fakeExecutor answers the nodetool and cqlsh commands the operator runs in the Cassandra pods
+type fakeExecutor struct {
+	mode      string
+	keyspaces string
+	// done is the exit code of the background nodetool commands, empty while they run
+	done string
+	// status is the output of nodetool status
+	status   string
+	commands []string
+}
+
+func (f *fakeExecutor) Exec(_ context.Context, _ string, pod string, _ string, command ...string) (string, error) {
+	f.commands = append(f.commands, pod+": "+strings.Join(command, " "))
+	switch command[0] {
+	case "nodetool":
+		if command[1] == "status" {
+			return f.status, nil
+		}
+		return "Mode: " + f.mode + "\n", nil
+	case "cqlsh":
+		return f.keyspaces, nil
+	case "bash":
+		if strings.HasPrefix(command[len(command)-1], "cat ") {
+			return f.done, nil
+		}
+	}
+	return "", nil
+}
+
+// ran tells if a command containing the text was run, the commands are prefixed with the pod name
+func (f *fakeExecutor) ran(text string) bool {
+	for _, c := range f.commands {
+		if strings.Contains(c, text) {
+			return true
+		}
+	}
+	return false
+}
+
+// keyspacesOutput renders the cqlsh output listing a keyspace replicated with NetworkTopologyStrategy
+func keyspacesOutput(factors string) string {
+	return `
+ keyspace_name | replication
+---------------+------------------------------------------------------------------------------
+        system | {'class': 'org.apache.cassandra.locator.LocalStrategy'}
+ system_traces | {'class': 'org.apache.cassandra.locator.SimpleStrategy', 'replication_factor': '2'}
+         users | {'class': 'org.apache.cassandra.locator.NetworkTopologyStrategy', ` + factors + `}
+
+(3 rows)
+`
+}
@@ -0,0 +1,117 @@
+/*
+Copyright AxonOps Limited 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"fmt"
+	"slices"
+
+	appsv1 "k8s.io/api/apps/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	cassandraaxonopscomv1 "github.com/axonops/axonops-developer-operator/api/v1"
+	"github.com/axonops/axonops-developer-operator/apps"
+)
+
+// cleanup runs nodetool cleanup on the nodes that were there before a scale up, so they drop
+// the data now owned by the new nodes. It is called before the StatefulSets are applied: a
+// rack with fewer live replicas than requested is being scaled up and the existing nodes of
+// its datacenter are queued. The queued nodes are cleaned up one at a time once every rack
+// has all its nodes ready.
+func (r *AxonOpsCassandraReconciler) cleanup(ctx context.Context, cr *cassandraaxonopscomv1.AxonOpsCassandra,
+	racks []apps.CassandraRack, report *nodeOperationReport) error {
+	if op := report.operation; op.IsRunning() && op.Type == cassandraaxonopscomv1.NodeOperationDecommission {
+		return nil
+	}
+
+	live := map[string]*appsv1.StatefulSet{}
+	scaledUp := map[string]bool{}
+	for _, rack := range racks {
+		sts, err := r.getSts(rack.StatefulSet, cr.GetNamespace())
+		if client.IgnoreNotFound(err) != nil {
+			return err
+		}
+		live[rack.StatefulSet] = sts
+		if sts != nil && sts.Spec.Replicas != nil && *sts.Spec.Replicas < rack.Replicas {
+			scaledUp[rack.DC] = true
+		}
+	}
+
+	if cr.Spec.Cassandra.DisableCleanup {
+		if op := report.operation; op.IsRunning() && op.Type == cassandraaxonopscomv1.NodeOperationCleanup {
+			now := metav1.Now()
+			op.Pending = nil
+			op.Node = ""
+			op.StartedAt = nil
+			op.CompletedAt = &now
+			op.Message = "Cleanup disabled"
+		}
+		return nil
+	}
+
+	var nodes []string
+	for _, rack := range racks {
+		sts := live[rack.StatefulSet]
+		if !scaledUp[rack.DC] || sts == nil || sts.Spec.Replicas == nil {
+			continue
+		}
+		for i := int32(0); i < min(*sts.Spec.Replicas, rack.Replicas); i++ {
+			nodes = append(nodes, fmt.Sprintf("%s-%d", rack.StatefulSet, i))
+		}
+	}
+	if len(nodes) > 0 {
+		if !report.operation.IsRunning() || report.operation.Type != cassandraaxonopscomv1.NodeOperationCleanup {
+			report.operation = &cassandraaxonopscomv1.NodeOperationStatus{Type: cassandraaxonopscomv1.NodeOperationCleanup}
+		}
+		op := report.operation
+		for _, node := range nodes {
+			if node != op.Node && !slices.Contains(op.Pending, node) {
+				op.Pending = append(op.Pending, node)
+			}
+		}
+		op.Message = fmt.Sprintf("Waiting for the new nodes to be ready to clean up %d nodes", len(op.Pending))
+		return nil
+	}
+
+	op := report.operation
+	if !op.IsRunning() || op.Type != cassandraaxonopscomv1.NodeOperationCleanup {
+		return nil
+	}
+	for _, rack := range racks {
+		sts := live[rack.StatefulSet]
+		if sts == nil || sts.Spec.Replicas == nil || *sts.Spec.Replicas != rack.Replicas || sts.Status.ReadyReplicas != rack.Replicas {
+			op.Message = fmt.Sprintf("Waiting for the new nodes to be ready to clean up %d nodes", len(op.Pending))
+			return nil
+		}
+	}
+
+	return r.runNodetoolTask(ctx, cr, op, cleanupTask)
+}
+
+// cleanupTask runs nodetool cleanup on the nodes of a Cleanup operation
+var cleanupTask = nodetoolTask{
+	command:       "cleanup",
+	startedReason: eventCleaningUp,
+	doneReason:    eventCleanedUp,
+	failedReason:  eventCleanupFailed,
+	started:       "Cleaning up Cassandra node %s",
+	done:          "Cleaned up Cassandra node %s",
+	failed:        "Failed to clean up Cassandra node %s",
+	completed:     "Cleaned up %d nodes",
+}
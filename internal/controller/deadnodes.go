@@ -0,0 +1,157 @@
+/*
+Copyright AxonOps Limited 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	cassandraaxonopscomv1 "github.com/axonops/axonops-developer-operator/api/v1"
+	"github.com/axonops/axonops-developer-operator/apps"
+)
+
+// Reasons used in the DeadNodes condition
+const (
+	reasonVolumeLost = "VolumeLost"
+)
+
+// removeDeadNodes looks for the nodes down in the ring that no pod runs anymore. A pod whose
+// volume was deleted comes back with an empty disk and joins the ring as a new node, while
+// its previous host ID stays down. The dead nodes are reported in the status and the ones
+// listed in the remove-node annotation are removed with nodetool removenode, one at a time.
+// The ring is only checked when every node is ready, a node being restarted is down too.
+func (r *AxonOpsCassandraReconciler) removeDeadNodes(ctx context.Context, cr *cassandraaxonopscomv1.AxonOpsCassandra,
+	racks []apps.CassandraRack, report *nodeOperationReport) error {
+	op := report.operation
+	if op.IsRunning() && op.Type != cassandraaxonopscomv1.NodeOperationRemoveNode {
+		return nil
+	}
+	for _, rack := range racks {
+		sts, err := r.getSts(rack.StatefulSet, cr.GetNamespace())
+		if err != nil {
+			return client.IgnoreNotFound(err)
+		}
+		if sts.Spec.Replicas == nil || *sts.Spec.Replicas != rack.Replicas || sts.Status.ReadyReplicas != rack.Replicas {
+			return nil
+		}
+	}
+	if len(racks) == 0 || racks[0].Replicas == 0 {
+		return nil
+	}
+	coordinator := fmt.Sprintf("%s-0", racks[0].StatefulSet)
+
+	if op.IsRunning() && op.Node != "" {
+		done, err := r.nodetoolResult(ctx, cr.GetNamespace(), coordinator, "removenode")
+		if !done {
+			if err != nil {
+				op.Message = fmt.Sprintf("Waiting for node %s to be reachable: %v", coordinator, err)
+			}
+			return nil
+		}
+		if err != nil {
+			op.Failed = append(op.Failed, op.Node)
+			r.Recorder.Eventf(cr, corev1.EventTypeWarning, eventRemoveNodeFailed, "Failed to remove the dead Cassandra node %s: %v", op.Node, err)
+		} else {
+			op.Completed = append(op.Completed, op.Node)
+			r.Recorder.Eventf(cr, corev1.EventTypeNormal, eventRemovedNode, "Removed the dead Cassandra node %s from the ring", op.Node)
+		}
+		op.Node = ""
+		op.StartedAt = nil
+	}
+
+	members, err := r.ring(ctx, cr.GetNamespace(), coordinator)
+	if err != nil {
+		log.FromContext(ctx).Info("cannot list the nodes of the ring", "node", coordinator, "error", err.Error())
+		return nil
+	}
+	pods := &corev1.PodList{}
+	if err := r.List(ctx, pods, client.InNamespace(cr.GetNamespace()), client.MatchingLabels{"app": "ca-" + cr.GetName()}); err != nil {
+		return err
+	}
+	addresses := map[string]bool{}
+	for _, pod := range pods.Items {
+		addresses[pod.Status.PodIP] = true
+	}
+	dead := []cassandraaxonopscomv1.DeadNode{}
+	for _, m := range members {
+		if strings.HasPrefix(m.state, "D") && !addresses[m.address] && m.hostID != "" {
+			dead = append(dead, cassandraaxonopscomv1.DeadNode{HostID: m.hostID, Address: m.address, DC: m.dc, Rack: m.rack})
+		}
+	}
+	report.deadNodes = dead
+
+	requested := strings.Split(cr.GetAnnotations()[cassandraaxonopscomv1.RemoveNodeAnnotation], ",")
+	var targets []string
+	for _, node := range dead {
+		if slices.Contains(requested, node.HostID) && !(op.IsRunning() && slices.Contains(op.Failed, node.HostID)) {
+			targets = append(targets, node.HostID)
+		}
+	}
+	if len(targets) == 0 {
+		if op.IsRunning() {
+			now := metav1.Now()
+			op.Pending = nil
+			op.CompletedAt = &now
+			op.Message = fmt.Sprintf("Removed %d dead nodes", len(op.Completed))
+		}
+		return nil
+	}
+
+	if !op.IsRunning() {
+		op = &cassandraaxonopscomv1.NodeOperationStatus{Type: cassandraaxonopscomv1.NodeOperationRemoveNode}
+		report.operation = op
+	}
+	node := targets[0]
+	if err := r.nodetoolBackground(ctx, cr.GetNamespace(), coordinator, "removenode", node); err != nil {
+		return r.recordFailure(ctx, cr, eventRemoveNodeFailed, fmt.Sprintf("Failed to remove the dead node %s", node), err)
+	}
+	now := metav1.Now()
+	op.Node = node
+	op.Pending = targets[1:]
+	op.StartedAt = &now
+	op.Message = fmt.Sprintf("Removing the dead node %s from the ring, its data is streamed from the other replicas", node)
+	r.Recorder.Eventf(cr, corev1.EventTypeNormal, eventRemovingNode, "Removing the dead Cassandra node %s from the ring", node)
+	return nil
+}
+
+// setDeadNodesCondition reports the dead nodes in the DeadNodes condition
+func setDeadNodesCondition(cr *cassandraaxonopscomv1.AxonOpsCassandra) {
+	if len(cr.Status.DeadNodes) == 0 {
+		meta.RemoveStatusCondition(&cr.Status.Conditions, cassandraaxonopscomv1.ConditionDeadNodes)
+		return
+	}
+	nodes := []string{}
+	for _, node := range cr.Status.DeadNodes {
+		nodes = append(nodes, fmt.Sprintf("%s (%s, rack %s)", node.HostID, node.Address, node.Rack))
+	}
+	meta.SetStatusCondition(&cr.Status.Conditions, metav1.Condition{
+		Type:   cassandraaxonopscomv1.ConditionDeadNodes,
+		Status: metav1.ConditionTrue,
+		Reason: reasonVolumeLost,
+		Message: fmt.Sprintf("No pod runs the nodes %s down in the ring, set the %s annotation to their host IDs to remove them",
+			strings.Join(nodes, ", "), cassandraaxonopscomv1.RemoveNodeAnnotation),
+		ObservedGeneration: cr.GetGeneration(),
+	})
+}
@@ -0,0 +1,204 @@
+/*
+Copyright AxonOps Limited 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	cassandraaxonopscomv1 "github.com/axonops/axonops-developer-operator/api/v1"
+)
+
+// maxDriftFields limits how many diverging fields are listed per object
+const maxDriftFields = 10
+
+// Reasons used in the DriftDetected condition
+const (
+	reasonNoDrift       = "NoDrift"
+	reasonDriftReported = "DriftReported"
+	reasonDriftReverted = "DriftReverted"
+)
+
+// resourceDrift lists the fields of a generated object that no longer match what the operator rendered
+type resourceDrift struct {
+	kind   string
+	name   string
+	fields []string
+}
+
+func (d resourceDrift) String() string {
+	return fmt.Sprintf("%s/%s: %s", d.kind, d.name, strings.Join(d.fields, ", "))
+}
+
+// driftReport collects the drift found while applying the objects of one reconcile
+type driftReport struct {
+	policy    cassandraaxonopscomv1.DriftPolicy
+	resources []resourceDrift
+}
+
+func newDriftReport(cr *cassandraaxonopscomv1.AxonOpsCassandra) *driftReport {
+	policy := cr.Spec.DriftPolicy
+	if policy == "" {
+		policy = cassandraaxonopscomv1.DriftPolicyRevert
+	}
+	return &driftReport{policy: policy}
+}
+
+// condition returns the DriftDetected condition, or nil when drift is ignored
+func (d *driftReport) condition(generation int64) *metav1.Condition {
+	if d.policy == cassandraaxonopscomv1.DriftPolicyIgnore {
+		return nil
+	}
+	cond := &metav1.Condition{
+		Type:               cassandraaxonopscomv1.ConditionDriftDetected,
+		Status:             metav1.ConditionFalse,
+		Reason:             reasonNoDrift,
+		Message:            "The generated objects match the AxonOpsCassandra spec",
+		ObservedGeneration: generation,
+	}
+	if len(d.resources) == 0 {
+		return cond
+	}
+
+	cond.Status = metav1.ConditionTrue
+	cond.Reason = reasonDriftReported
+	if d.policy == cassandraaxonopscomv1.DriftPolicyRevert {
+		cond.Reason = reasonDriftReverted
+	}
+	messages := make([]string, 0, len(d.resources))
+	for _, res := range d.resources {
+		messages = append(messages, res.String())
+	}
+	cond.Message = strings.Join(messages, "; ")
+	return cond
+}
+
+// setDriftCondition records the drift found in this reconcile in the status
+func setDriftCondition(cr *cassandraaxonopscomv1.AxonOpsCassandra, drift *driftReport) {
+	if drift == nil {
+		return
+	}
+	cond := drift.condition(cr.GetGeneration())
+	if cond == nil {
+		meta.RemoveStatusCondition(&cr.Status.Conditions, cassandraaxonopscomv1.ConditionDriftDetected)
+		return
+	}
+	meta.SetStatusCondition(&cr.Status.Conditions, *cond)
+}
+
+// detectDrift server-side applies the desired object in dry-run mode and compares the
+// result with the live object. Any difference is a field the operator manages that was
+// changed by someone else since the last apply.
+func (r *AxonOpsCassandraReconciler) detectDrift(ctx context.Context, desired *unstructured.Unstructured, live client.Object) ([]string, error) {
+	dryRun := desired.DeepCopy()
+	if err := r.Apply(ctx, client.ApplyConfigurationFromUnstructured(dryRun),
+		client.FieldOwner(fieldManager), client.ForceOwnership, client.DryRunAll); err != nil {
+		return nil, err
+	}
+
+	// Round trip the dry-run result through the typed object so both sides are normalised the same way
+	result, ok := live.DeepCopyObject().(client.Object)
+	if !ok {
+		return nil, fmt.Errorf("unexpected object type %T", live)
+	}
+	if err := runtime.DefaultUnstructuredConverter.FromUnstructured(dryRun.Object, result); err != nil {
+		return nil, err
+	}
+
+	after, err := comparableContent(result)
+	if err != nil {
+		return nil, err
+	}
+	before, err := comparableContent(live)
+	if err != nil {
+		return nil, err
+	}
+
+	fields := diffFields("", before, after, nil)
+	sort.Strings(fields)
+	if len(fields) > maxDriftFields {
+		fields = append(fields[:maxDriftFields], fmt.Sprintf("and %d more", len(fields)-maxDriftFields))
+	}
+	return fields, nil
+}
+
+// comparableContent drops the bookkeeping fields that change on every write
+func comparableContent(obj client.Object) (map[string]interface{}, error) {
+	content, err := runtime.DefaultUnstructuredConverter.ToUnstructured(obj)
+	if err != nil {
+		return nil, err
+	}
+	delete(content, "status")
+	if metadata, ok := content["metadata"].(map[string]interface{}); ok {
+		delete(metadata, "managedFields")
+		delete(metadata, "resourceVersion")
+		delete(metadata, "generation")
+	}
+	return content, nil
+}
+
+// diffFields returns the paths where a and b differ
+func diffFields(path string, a, b interface{}, fields []string) []string {
+	switch av := a.(type) {
+	case map[string]interface{}:
+		bv, ok := b.(map[string]interface{})
+		if !ok {
+			return append(fields, path)
+		}
+		keys := map[string]struct{}{}
+		for k := range av {
+			keys[k] = struct{}{}
+		}
+		for k := range bv {
+			keys[k] = struct{}{}
+		}
+		for k := range keys {
+			fields = diffFields(joinPath(path, k), av[k], bv[k], fields)
+		}
+		return fields
+	case []interface{}:
+		bv, ok := b.([]interface{})
+		if !ok || len(av) != len(bv) {
+			return append(fields, path)
+		}
+		for i := range av {
+			fields = diffFields(fmt.Sprintf("%s[%d]", path, i), av[i], bv[i], fields)
+		}
+		return fields
+	default:
+		if !reflect.DeepEqual(a, b) {
+			return append(fields, path)
+		}
+		return fields
+	}
+}
+
+func joinPath(path string, key string) string {
+	if path == "" {
+		return key
+	}
+	return path + "." + key
+}
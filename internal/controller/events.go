@@ -0,0 +1,161 @@
+/*
+Copyright AxonOps Limited 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"fmt"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	cassandraaxonopscomv1 "github.com/axonops/axonops-developer-operator/api/v1"
+)
+
+// Event reasons. Every event is emitted once per transition: objects are only written when
+// they change and failures are tracked in the Reconciled condition, so a failure that
+// persists across reconciles is reported once.
+const (
+	eventCreated           = "Created"
+	eventUpdated           = "Updated"
+	eventDeleted           = "Deleted"
+	eventScaledUp          = "ScaledUp"
+	eventScaledDown        = "ScaledDown"
+	eventComponentReady    = "ComponentReady"
+	eventComponentNotReady = "ComponentNotReady"
+	eventEnvironmentReady  = "EnvironmentReady"
+	eventRenderFailed      = "RenderFailed"
+	eventCreateFailed      = "CreateFailed"
+	eventUpdateFailed      = "UpdateFailed"
+	eventDeleteFailed      = "DeleteFailed"
+	// node operations
+	eventDecommissioning    = "Decommissioning"
+	eventDecommissioned     = "Decommissioned"
+	eventDecommissionFailed = "DecommissionFailed"
+	eventScaleDownBlocked   = "ScaleDownBlocked"
+	eventCleaningUp         = "CleaningUp"
+	eventCleanedUp          = "CleanedUp"
+	eventCleanupFailed      = "CleanupFailed"
+	eventRestarting         = "Restarting"
+	eventRestarted          = "Restarted"
+	eventRestartFailed      = "RestartFailed"
+	// upgrades
+	eventUpgrading             = "Upgrading"
+	eventUpgraded              = "Upgraded"
+	eventUpgradeHalted         = "UpgradeHalted"
+	eventUpgradingSSTables     = "UpgradingSSTables"
+	eventUpgradedSSTables      = "UpgradedSSTables"
+	eventUpgradeSSTablesFailed = "UpgradeSSTablesFailed"
+	// dead nodes
+	eventDeadNodes        = "DeadNodes"
+	eventRemovingNode     = "RemovingNode"
+	eventRemovedNode      = "RemovedNode"
+	eventRemoveNodeFailed = "RemoveNodeFailed"
+	// authentication
+	eventSuperuserCreated          = "SuperuserCreated"
+	eventSystemAuthReplicated      = "SystemAuthReplicated"
+	eventSystemAuthReplicateFailed = "SystemAuthReplicateFailed"
+	// TLS
+	eventCertificatesRotated = "CertificatesRotated"
+)
+
+// reasonReconcileSucceeded is used in the Reconciled condition when the last reconcile went through
+const reasonReconcileSucceeded = "ReconcileSucceeded"
+
+// recordFailure reports a failed step in the Reconciled condition and emits a Warning event
+// the first time it happens. The original error is returned so the request is retried.
+func (r *AxonOpsCassandraReconciler) recordFailure(ctx context.Context, cr *cassandraaxonopscomv1.AxonOpsCassandra, reason string, message string, err error) error {
+	cond := metav1.Condition{
+		Type:               cassandraaxonopscomv1.ConditionReconciled,
+		Status:             metav1.ConditionFalse,
+		Reason:             reason,
+		Message:            fmt.Sprintf("%s: %s", message, err.Error()),
+		ObservedGeneration: cr.GetGeneration(),
+	}
+	previous := meta.FindStatusCondition(cr.Status.Conditions, cond.Type)
+	if previous != nil && previous.Status == cond.Status && previous.Reason == cond.Reason && previous.Message == cond.Message {
+		return err
+	}
+
+	r.Recorder.Event(cr, corev1.EventTypeWarning, reason, cond.Message)
+	patch := client.MergeFrom(cr.DeepCopy())
+	meta.SetStatusCondition(&cr.Status.Conditions, cond)
+	if patchErr := r.Status().Patch(ctx, cr, patch); patchErr != nil {
+		log.FromContext(ctx).Error(patchErr, "unable to record the failure in the status", "reason", reason)
+	}
+	return err
+}
+
+// recordApplied emits an event when an object was created or changed. The live object is
+// the state before the apply, it is nil when the object did not exist.
+func (r *AxonOpsCassandraReconciler) recordApplied(cr *cassandraaxonopscomv1.AxonOpsCassandra, kind string, live client.Object, obj client.Object, result controllerutil.OperationResult) {
+	switch result {
+	case controllerutil.OperationResultCreated:
+		r.Recorder.Eventf(cr, corev1.EventTypeNormal, eventCreated, "Created %s %s", kind, obj.GetName())
+	case controllerutil.OperationResultUpdated:
+		before, okBefore := replicasOf(live)
+		after, okAfter := replicasOf(obj)
+		switch {
+		case okBefore && okAfter && after > before:
+			r.Recorder.Eventf(cr, corev1.EventTypeNormal, eventScaledUp, "Scaled %s %s from %d to %d replicas", kind, obj.GetName(), before, after)
+		case okBefore && okAfter && after < before:
+			r.Recorder.Eventf(cr, corev1.EventTypeNormal, eventScaledDown, "Scaled %s %s from %d to %d replicas", kind, obj.GetName(), before, after)
+		default:
+			r.Recorder.Eventf(cr, corev1.EventTypeNormal, eventUpdated, "Updated %s %s", kind, obj.GetName())
+		}
+	}
+}
+
+// recordTransitions emits an event for every component that became ready or stopped being
+// ready since the previous status, and when the whole environment becomes ready.
+func (r *AxonOpsCassandraReconciler) recordTransitions(cr *cassandraaxonopscomv1.AxonOpsCassandra, previous []metav1.Condition, components []componentStatus) {
+	for _, c := range components {
+		wasReady := meta.IsStatusConditionTrue(previous, c.conditionType)
+		cond := c.condition(cr.GetGeneration())
+		switch {
+		case c.isReady() && !wasReady:
+			r.Recorder.Event(cr, corev1.EventTypeNormal, eventComponentReady, cond.Message)
+		case !c.isReady() && wasReady:
+			r.Recorder.Event(cr, corev1.EventTypeWarning, eventComponentNotReady, cond.Message)
+		}
+	}
+
+	if meta.IsStatusConditionTrue(cr.Status.Conditions, cassandraaxonopscomv1.ConditionReady) &&
+		!meta.IsStatusConditionTrue(previous, cassandraaxonopscomv1.ConditionReady) {
+		r.Recorder.Event(cr, corev1.EventTypeNormal, eventEnvironmentReady, "All the AxonOps and Cassandra components are ready")
+	}
+}
+
+// replicasOf returns the number of replicas requested by a workload
+func replicasOf(obj client.Object) (int32, bool) {
+	switch o := obj.(type) {
+	case *appsv1.StatefulSet:
+		if o != nil && o.Spec.Replicas != nil {
+			return *o.Spec.Replicas, true
+		}
+	case *appsv1.Deployment:
+		if o != nil && o.Spec.Replicas != nil {
+			return *o.Spec.Replicas, true
+		}
+	}
+	return 0, false
+}
@@ -0,0 +1,355 @@
+/*
+Copyright AxonOps Limited 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/remotecommand"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	cassandraaxonopscomv1 "github.com/axonops/axonops-developer-operator/api/v1"
+	"github.com/axonops/axonops-developer-operator/apps"
+)
+
+// execTimeout bounds every command run in a Cassandra container. The long running
+// nodetool commands are started in the background and polled instead.
+const execTimeout = 30 * time.Second
+
+// cassandraContainer is the name of the container running Cassandra in the rendered StatefulSets
+const cassandraContainer = "cassandra"
+
+// PodExecutor runs a command in a container of a pod and returns its standard output
+type PodExecutor interface {
+	Exec(ctx context.Context, namespace string, pod string, container string, command ...string) (string, error)
+}
+
+// remotePodExecutor runs the commands through the exec subresource of the API server, as kubectl exec does
+type remotePodExecutor struct {
+	config *rest.Config
+	client kubernetes.Interface
+}
+
+// NewPodExecutor returns a PodExecutor using the API server the config points to
+func NewPodExecutor(config *rest.Config) (PodExecutor, error) {
+	client, err := kubernetes.NewForConfig(config)
+	if err != nil {
+		return nil, err
+	}
+	return &remotePodExecutor{config: config, client: client}, nil
+}
+
+func (e *remotePodExecutor) Exec(ctx context.Context, namespace string, pod string, container string, command ...string) (string, error) {
+	ctx, cancel := context.WithTimeout(ctx, execTimeout)
+	defer cancel()
+
+	req := e.client.CoreV1().RESTClient().Post().
+		Resource("pods").
+		Namespace(namespace).
+		Name(pod).
+		SubResource("exec").
+		VersionedParams(&corev1.PodExecOptions{
+			Container: container,
+			Command:   command,
+			Stdout:    true,
+			Stderr:    true,
+		}, scheme.ParameterCodec)
+
+	executor, err := remotecommand.NewSPDYExecutor(e.config, "POST", req.URL())
+	if err != nil {
+		return "", err
+	}
+	var stdout, stderr bytes.Buffer
+	if err := executor.StreamWithContext(ctx, remotecommand.StreamOptions{Stdout: &stdout, Stderr: &stderr}); err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return stdout.String(), fmt.Errorf("%w: %s", err, msg)
+		}
+		return stdout.String(), err
+	}
+	return stdout.String(), nil
+}
+
+// nodetool runs nodetool in the Cassandra container of a pod
+func (r *AxonOpsCassandraReconciler) nodetool(ctx context.Context, namespace string, pod string, args ...string) (string, error) {
+	if r.Executor == nil {
+		return "", fmt.Errorf("no pod executor configured to run nodetool")
+	}
+	return r.Executor.Exec(ctx, namespace, pod, cassandraContainer, append([]string{"nodetool"}, args...)...)
+}
+
+// nodetoolBackground starts a long running nodetool command without waiting for it. Its
+// output goes to /tmp/nodetool-<command>.log in the container and its exit code to
+// /tmp/nodetool-<command>.done once it is over, see nodetoolResult.
+func (r *AxonOpsCassandraReconciler) nodetoolBackground(ctx context.Context, namespace string, pod string, args ...string) error {
+	if r.Executor == nil {
+		return fmt.Errorf("no pod executor configured to run nodetool")
+	}
+	prefix := "/tmp/nodetool-" + args[0]
+	script := fmt.Sprintf("rm -f %[1]s.done; nohup bash -c 'nodetool %[2]s > %[1]s.log 2>&1; echo $? > %[1]s.done' > /dev/null 2>&1 &",
+		prefix, strings.Join(args, " "))
+	_, err := r.Executor.Exec(ctx, namespace, pod, cassandraContainer, "bash", "-c", script)
+	return err
+}
+
+// nodetoolResult tells if the nodetool command started by nodetoolBackground is over and
+// returns an error when it failed. A command whose log is gone was lost with a restart of
+// the container and is reported as failed.
+func (r *AxonOpsCassandraReconciler) nodetoolResult(ctx context.Context, namespace string, pod string, command string) (bool, error) {
+	if r.Executor == nil {
+		return false, fmt.Errorf("no pod executor configured to run nodetool")
+	}
+	prefix := "/tmp/nodetool-" + command
+	out, err := r.Executor.Exec(ctx, namespace, pod, cassandraContainer, "bash", "-c",
+		fmt.Sprintf("cat %[1]s.done 2>/dev/null && tail -n 5 %[1]s.log || test -e %[1]s.log || echo lost", prefix))
+	if err != nil {
+		return false, err
+	}
+	code, log, _ := strings.Cut(strings.TrimSpace(out), "\n")
+	switch code {
+	case "":
+		return false, nil
+	case "0":
+		return true, nil
+	case "lost":
+		return true, fmt.Errorf("nodetool %s is not running, the container was restarted", command)
+	default:
+		return true, fmt.Errorf("nodetool %s exited with %s: %s", command, code, strings.TrimSpace(log))
+	}
+}
+
+// nodetoolTask is a long running nodetool command an operation runs on its nodes one at a time
+type nodetoolTask struct {
+	command string
+	// event reasons
+	startedReason, doneReason, failedReason string
+	// event messages formatted with the node name, completed is the final message of the
+	// operation formatted with the number of nodes done
+	started, done, failed, completed string
+}
+
+// runNodetoolTask moves the operation one step: the result of the command running on
+// op.Node is collected, then the command is started in the background on the next pending
+// node. A node where the command fails is recorded in op.Failed and the operation goes on.
+// The operation is completed once no node is left.
+func (r *AxonOpsCassandraReconciler) runNodetoolTask(ctx context.Context, cr *cassandraaxonopscomv1.AxonOpsCassandra,
+	op *cassandraaxonopscomv1.NodeOperationStatus, task nodetoolTask) error {
+	if op.Node != "" {
+		done, err := r.nodetoolResult(ctx, cr.GetNamespace(), op.Node, task.command)
+		if !done && err != nil {
+			log.FromContext(ctx).Info("cannot get the result of nodetool", "command", task.command, "node", op.Node, "error", err.Error())
+			op.Message = fmt.Sprintf("Waiting for node %s to be reachable: %v", op.Node, err)
+			return nil
+		}
+		if !done {
+			return nil
+		}
+		if err != nil {
+			if !slices.Contains(op.Failed, op.Node) {
+				op.Failed = append(op.Failed, op.Node)
+			}
+			r.Recorder.Eventf(cr, corev1.EventTypeWarning, task.failedReason, task.failed+": %v", op.Node, err)
+		} else {
+			if !slices.Contains(op.Completed, op.Node) {
+				op.Completed = append(op.Completed, op.Node)
+			}
+			r.Recorder.Eventf(cr, corev1.EventTypeNormal, task.doneReason, task.done, op.Node)
+		}
+		op.Node = ""
+		op.StartedAt = nil
+	}
+
+	if len(op.Pending) == 0 {
+		now := metav1.Now()
+		op.CompletedAt = &now
+		op.Message = fmt.Sprintf(task.completed, len(op.Completed))
+		return nil
+	}
+
+	node := op.Pending[0]
+	if err := r.nodetoolBackground(ctx, cr.GetNamespace(), node, task.command); err != nil {
+		return r.recordFailure(ctx, cr, task.failedReason, fmt.Sprintf("Failed to run nodetool %s on %s", task.command, node), err)
+	}
+	now := metav1.Now()
+	op.Pending = op.Pending[1:]
+	op.Node = node
+	op.StartedAt = &now
+	op.Message = fmt.Sprintf(task.started, node)
+	r.Recorder.Eventf(cr, corev1.EventTypeNormal, task.startedReason, task.started, node)
+	return nil
+}
+
+var nodeModeRegexp = regexp.MustCompile(`(?m)^Mode:\s*(\S+)`)
+
+// nodeMode returns the operating mode of a node from nodetool netstats, e.g. NORMAL, LEAVING or DECOMMISSIONED
+func (r *AxonOpsCassandraReconciler) nodeMode(ctx context.Context, namespace string, pod string) (string, error) {
+	out, err := r.nodetool(ctx, namespace, pod, "netstats")
+	if err != nil {
+		return "", err
+	}
+	match := nodeModeRegexp.FindStringSubmatch(out)
+	if match == nil {
+		return "", fmt.Errorf("no mode in the nodetool netstats output of %s", pod)
+	}
+	return match[1], nil
+}
+
+// ringMember is a node listed by nodetool status
+type ringMember struct {
+	// state is the status and state of the node, e.g. UN for a node up and normal
+	state   string
+	address string
+	hostID  string
+	dc      string
+	rack    string
+}
+
+var (
+	datacenterRegexp = regexp.MustCompile(`^Datacenter:\s*(\S+)`)
+	hostIDRegexp     = regexp.MustCompile(`^[0-9a-f]{8}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{12}$`)
+)
+
+// ring returns the nodes of the cluster as seen by a node in nodetool status
+func (r *AxonOpsCassandraReconciler) ring(ctx context.Context, namespace string, pod string) ([]ringMember, error) {
+	out, err := r.nodetool(ctx, namespace, pod, "status")
+	if err != nil {
+		return nil, err
+	}
+	return parseRing(out), nil
+}
+
+func parseRing(out string) []ringMember {
+	members := []ringMember{}
+	dc := ""
+	for _, line := range strings.Split(out, "\n") {
+		if match := datacenterRegexp.FindStringSubmatch(line); match != nil {
+			dc = match[1]
+			continue
+		}
+		fields := strings.Fields(line)
+		if len(fields) < 3 || len(fields[0]) != 2 || !strings.ContainsAny(fields[0][:1], "UD") {
+			continue
+		}
+		member := ringMember{state: fields[0], address: fields[1], dc: dc, rack: fields[len(fields)-1]}
+		for _, f := range fields[2:] {
+			if hostIDRegexp.MatchString(f) {
+				member.hostID = f
+			}
+		}
+		members = append(members, member)
+	}
+	return members
+}
+
+// nodeState returns the status and state of the node with the address in nodetool status,
+// e.g. UN for a node up and normal, or "" when the node is not listed
+func (r *AxonOpsCassandraReconciler) nodeState(ctx context.Context, namespace string, pod string, address string) (string, error) {
+	members, err := r.ring(ctx, namespace, pod)
+	if err != nil {
+		return "", err
+	}
+	for _, m := range members {
+		if m.address == address {
+			return m.state, nil
+		}
+	}
+	return "", nil
+}
+
+// replicationStrategy is the replication of a keyspace
+type replicationStrategy struct {
+	keyspace string
+	class    string
+	// factors maps a datacenter to its replication factor, SimpleStrategy uses the replication_factor key
+	factors map[string]int
+}
+
+var replicationOptionRegexp = regexp.MustCompile(`'([^']+)': '([^']+)'`)
+
+// localKeyspaces are kept by every node for itself, they are not replicated
+var localKeyspaces = []string{"system", "system_schema", "system_views", "system_virtual_schema"}
+
+// cqlsh runs a CQL statement in the Cassandra container of a pod. When authentication is
+// enabled it logs in as the superuser, whose credentials the container reads from the Secret.
+func (r *AxonOpsCassandraReconciler) cqlsh(ctx context.Context, cr *cassandraaxonopscomv1.AxonOpsCassandra, pod string, statement string) (string, error) {
+	if r.Executor == nil {
+		return "", fmt.Errorf("no pod executor configured to run cqlsh")
+	}
+	command := append(strings.Fields(cqlshCommand(cr)), "-e", statement)
+	if cr.Spec.Cassandra.Authentication.Enabled {
+		command = []string{"bash", "-c",
+			fmt.Sprintf(`%s -u "$%s" -p "$%s" -e "$1"`, cqlshCommand(cr), apps.SuperuserEnv, apps.SuperuserPasswordEnv), "cqlsh", statement}
+	}
+	return r.Executor.Exec(ctx, cr.GetNamespace(), pod, cassandraContainer, command...)
+}
+
+// cqlshCommand returns the cqlsh command line, it connects with the certificates of the node
+// when TLS is enabled
+func cqlshCommand(cr *cassandraaxonopscomv1.AxonOpsCassandra) string {
+	if cr.Spec.Cassandra.TLS.Enabled {
+		return "cqlsh --cqlshrc " + apps.CqlshrcPath
+	}
+	return "cqlsh"
+}
+
+// keyspaceReplication reads the replication of the keyspaces through cqlsh. The keyspaces local
+// to each node are left out, the system keyspaces replicated across the nodes are not: their
+// factor may have been raised by hand and Cassandra refuses to go below it as well.
+func (r *AxonOpsCassandraReconciler) keyspaceReplication(ctx context.Context, cr *cassandraaxonopscomv1.AxonOpsCassandra, pod string) ([]replicationStrategy, error) {
+	out, err := r.cqlsh(ctx, cr, pod, "SELECT keyspace_name, replication FROM system_schema.keyspaces")
+	if err != nil {
+		return nil, err
+	}
+	return parseKeyspaceReplication(out), nil
+}
+
+func parseKeyspaceReplication(out string) []replicationStrategy {
+	strategies := []replicationStrategy{}
+	for _, line := range strings.Split(out, "\n") {
+		keyspace, replication, ok := strings.Cut(line, "|")
+		if !ok || !strings.Contains(replication, "{") {
+			continue
+		}
+		keyspace = strings.TrimSpace(keyspace)
+		if slices.Contains(localKeyspaces, keyspace) {
+			continue
+		}
+		strategy := replicationStrategy{keyspace: keyspace, factors: map[string]int{}}
+		for _, option := range replicationOptionRegexp.FindAllStringSubmatch(replication, -1) {
+			if option[1] == "class" {
+				strategy.class = option[2][strings.LastIndex(option[2], ".")+1:]
+				continue
+			}
+			if factor, err := strconv.Atoi(option[2]); err == nil {
+				strategy.factors[option[1]] = factor
+			}
+		}
+		strategies = append(strategies, strategy)
+	}
+	return strategies
+}
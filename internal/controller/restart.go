@@ -0,0 +1,173 @@
+/*
+Copyright AxonOps Limited 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"fmt"
+	"slices"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	cassandraaxonopscomv1 "github.com/axonops/axonops-developer-operator/api/v1"
+	"github.com/axonops/axonops-developer-operator/apps"
+)
+
+// Reasons used in the UpgradeHalted condition
+const (
+	reasonNoPersistentVolume = "NoPersistentVolume"
+)
+
+// setRestartPolicy leaves the restart of the Cassandra pods to the operator and copies the
+// restart-at annotation of the AxonOpsCassandra to the pod template, so setting it changes
+// the template like a configuration change does
+func setRestartPolicy(cr *cassandraaxonopscomv1.AxonOpsCassandra, sts *appsv1.StatefulSet) {
+	sts.Spec.UpdateStrategy = appsv1.StatefulSetUpdateStrategy{Type: appsv1.OnDeleteStatefulSetStrategyType}
+	restartAt := cr.GetAnnotations()[cassandraaxonopscomv1.RestartAtAnnotation]
+	if restartAt == "" {
+		return
+	}
+	if sts.Spec.Template.Annotations == nil {
+		sts.Spec.Template.Annotations = map[string]string{}
+	}
+	sts.Spec.Template.Annotations[cassandraaxonopscomv1.RestartAtAnnotation] = restartAt
+}
+
+// rollingRestart restarts the Cassandra nodes whose pod does not run the current template of
+// its StatefulSet, one at a time from the highest ordinal. The node is drained and its pod
+// deleted, and the next node is only restarted once it is back and up and normal (UN) in
+// nodetool status. It waits while another node operation is running. The nodes of the racks
+// without a persistent volume are not drained: the preStop hook of their pod decommissions
+// them and they bootstrap again, streaming their data back from the other nodes.
+func (r *AxonOpsCassandraReconciler) rollingRestart(ctx context.Context, cr *cassandraaxonopscomv1.AxonOpsCassandra,
+	racks []apps.CassandraRack, report *nodeOperationReport) error {
+	if op := report.operation; op.IsRunning() && op.Type != cassandraaxonopscomv1.NodeOperationRestart {
+		return nil
+	}
+
+	pods := map[string]*corev1.Pod{}
+	var outdated, notReady []string
+	ephemeral := map[string]bool{}
+	for _, rack := range racks {
+		sts, err := r.getSts(rack.StatefulSet, cr.GetNamespace())
+		if client.IgnoreNotFound(err) != nil {
+			return err
+		}
+		if sts == nil || sts.Status.ObservedGeneration < sts.Generation || sts.Status.UpdateRevision == "" {
+			return nil
+		}
+		for i := rack.Replicas - 1; i >= 0; i-- {
+			name := fmt.Sprintf("%s-%d", rack.StatefulSet, i)
+			pod := &corev1.Pod{}
+			if err := r.Get(ctx, client.ObjectKey{Namespace: cr.GetNamespace(), Name: name}, pod); err != nil {
+				if !apierrors.IsNotFound(err) {
+					return err
+				}
+				notReady = append(notReady, name)
+				continue
+			}
+			pods[name] = pod
+			if !isPodReady(pod) {
+				notReady = append(notReady, name)
+			}
+			if pod.Labels[appsv1.ControllerRevisionHashLabelKey] != sts.Status.UpdateRevision {
+				outdated = append(outdated, name)
+			}
+			ephemeral[name] = !rack.Persistent
+		}
+	}
+
+	op := report.operation
+	if op.IsRunning() && op.Node != "" {
+		node := op.Node
+		op.Pending = slices.DeleteFunc(slices.Clone(outdated), func(name string) bool { return name == node })
+		pod := pods[node]
+		if pod == nil || slices.Contains(notReady, node) || slices.Contains(outdated, node) {
+			op.Message = fmt.Sprintf("Waiting for node %s to restart", node)
+			return nil
+		}
+		state, err := r.nodeState(ctx, cr.GetNamespace(), node, pod.Status.PodIP)
+		if err != nil {
+			log.FromContext(ctx).Info("cannot get the state of the restarted node", "node", node, "error", err.Error())
+		}
+		if state != "UN" {
+			op.Message = fmt.Sprintf("Waiting for node %s to be up and normal in nodetool status", node)
+			return nil
+		}
+		if !slices.Contains(op.Completed, node) {
+			op.Completed = append(op.Completed, node)
+		}
+		op.Node = ""
+		op.StartedAt = nil
+		r.Recorder.Eventf(cr, corev1.EventTypeNormal, eventRestarted, "Restarted Cassandra node %s", node)
+	}
+
+	if len(outdated) == 0 {
+		if op.IsRunning() {
+			now := metav1.Now()
+			op.Pending = nil
+			op.CompletedAt = &now
+			op.Message = fmt.Sprintf("Restarted %d nodes", len(op.Completed))
+		}
+		return nil
+	}
+
+	node := outdated[0]
+	if !op.IsRunning() {
+		report.operation = &cassandraaxonopscomv1.NodeOperationStatus{Type: cassandraaxonopscomv1.NodeOperationRestart}
+		op = report.operation
+	}
+	op.Pending = outdated
+	for _, name := range notReady {
+		if name != node {
+			op.Message = fmt.Sprintf("Waiting for node %s to be ready before restarting %s", name, node)
+			return nil
+		}
+	}
+
+	// a node that is not ready may not be running Cassandra at all, it is restarted without a drain
+	if !slices.Contains(notReady, node) && !ephemeral[node] {
+		if _, err := r.nodetool(ctx, cr.GetNamespace(), node, "drain"); err != nil {
+			return r.recordFailure(ctx, cr, eventRestartFailed, fmt.Sprintf("Failed to drain %s", node), err)
+		}
+	}
+	if err := r.Delete(ctx, pods[node]); client.IgnoreNotFound(err) != nil {
+		return r.recordFailure(ctx, cr, eventRestartFailed, fmt.Sprintf("Failed to delete the pod of %s", node), err)
+	}
+	now := metav1.Now()
+	op.Pending = outdated[1:]
+	op.Node = node
+	op.StartedAt = &now
+	op.Message = fmt.Sprintf("Restarting node %s", node)
+	r.Recorder.Eventf(cr, corev1.EventTypeNormal, eventRestarting, "Restarting Cassandra node %s", node)
+	return nil
+}
+
+// isPodReady tells if the Ready condition of the pod is true
+func isPodReady(pod *corev1.Pod) bool {
+	for _, c := range pod.Status.Conditions {
+		if c.Type == corev1.PodReady {
+			return c.Status == corev1.ConditionTrue
+		}
+	}
+	return false
+}
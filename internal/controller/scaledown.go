@@ -0,0 +1,264 @@
+/*
+Copyright AxonOps Limited 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"fmt"
+	"slices"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	cassandraaxonopscomv1 "github.com/axonops/axonops-developer-operator/api/v1"
+	"github.com/axonops/axonops-developer-operator/apps"
+)
+
+// Reasons used in the ScaleDownBlocked condition
+const (
+	reasonReplicationFactor = "ReplicationFactor"
+)
+
+// nodeOperationReport collects the state of the node operations found during a reconcile so
+// updateStatus can report it. A nil report leaves the status as it is.
+type nodeOperationReport struct {
+	operation *cassandraaxonopscomv1.NodeOperationStatus
+	upgrade   *cassandraaxonopscomv1.UpgradeStatus
+	deadNodes []cassandraaxonopscomv1.DeadNode
+	// authentication is nil when authentication is disabled
+	authentication *cassandraaxonopscomv1.AuthenticationStatus
+	// tls is nil when TLS is disabled
+	tls *cassandraaxonopscomv1.TLSStatus
+	// scaleDownBlocked explains why a node cannot be decommissioned
+	scaleDownBlocked string
+	upgradeHalted    *upgradeHalt
+}
+
+func newNodeOperationReport(cr *cassandraaxonopscomv1.AxonOpsCassandra) *nodeOperationReport {
+	return &nodeOperationReport{
+		operation:      cr.Status.Operation.DeepCopy(),
+		upgrade:        cr.Status.Upgrade.DeepCopy(),
+		deadNodes:      slices.Clone(cr.Status.DeadNodes),
+		authentication: cr.Status.Authentication.DeepCopy(),
+		tls:            cr.Status.TLS.DeepCopy(),
+	}
+}
+
+// scaleDown removes the nodes above the requested replicas one at a time. The highest ordinal
+// of the first rack with too many nodes is decommissioned and its StatefulSet is only scaled
+// down once the node has left the ring, so the racks being scaled down keep their current
+// replicas in the returned racks until then. The volume claim of the node is deleted with it, a
+// pod started later with the same ordinal would find the data of a node that left the ring. The
+// nodes of the removed racks are decommissioned the same way once every rack is ready.
+func (r *AxonOpsCassandraReconciler) scaleDown(ctx context.Context, cr *cassandraaxonopscomv1.AxonOpsCassandra,
+	racks []apps.CassandraRack, removed []apps.CassandraRack, report *nodeOperationReport) ([]apps.CassandraRack, error) {
+	current := map[string]int32{}
+	pending := -1
+	ready := true
+	for i, rack := range racks {
+		sts, err := r.getSts(rack.StatefulSet, cr.GetNamespace())
+		if client.IgnoreNotFound(err) != nil {
+			return racks, err
+		}
+		current[rack.StatefulSet] = rack.Replicas
+		if sts == nil || sts.Status.ReadyReplicas < rack.Replicas {
+			ready = false
+		}
+		if sts == nil || sts.Spec.Replicas == nil || *sts.Spec.Replicas <= rack.Replicas {
+			continue
+		}
+		current[rack.StatefulSet] = *sts.Spec.Replicas
+		racks[i].Replicas = *sts.Spec.Replicas
+		if pending < 0 {
+			pending = i
+		}
+	}
+	all := append(slices.Clone(racks), removed...)
+	for i, rack := range removed {
+		current[rack.StatefulSet] = rack.Replicas
+		if pending < 0 && rack.Replicas > 0 {
+			pending = len(racks) + i
+		}
+	}
+
+	if pending < 0 {
+		if op := report.operation; op.IsRunning() && op.Type == cassandraaxonopscomv1.NodeOperationDecommission {
+			now := metav1.Now()
+			op.Node = ""
+			op.StartedAt = nil
+			op.CompletedAt = &now
+			op.Message = fmt.Sprintf("Decommissioned %d nodes", len(op.Completed))
+		}
+		return racks, nil
+	}
+
+	rack := all[pending]
+	isRemoved := pending >= len(racks)
+	node := fmt.Sprintf("%s-%d", rack.StatefulSet, rack.Replicas-1)
+	if !report.operation.IsRunning() || report.operation.Type != cassandraaxonopscomv1.NodeOperationDecommission {
+		report.operation = &cassandraaxonopscomv1.NodeOperationStatus{Type: cassandraaxonopscomv1.NodeOperationDecommission}
+	}
+	op := report.operation
+	if isRemoved && !ready {
+		op.Node = node
+		op.Message = fmt.Sprintf("Waiting for the nodes of every rack to be ready to decommission %s of a removed rack", node)
+		return racks, nil
+	}
+
+	mode, err := r.nodeMode(ctx, cr.GetNamespace(), node)
+	if err != nil {
+		log.FromContext(ctx).Info("cannot get the mode of the node to decommission", "node", node, "error", err.Error())
+		op.Node = node
+		op.Message = fmt.Sprintf("Waiting for node %s to be reachable: %v", node, err)
+		return racks, nil
+	}
+
+	switch mode {
+	case "DECOMMISSIONED":
+		// the claim is kept by its protection finalizer until the pod is gone, it is deleted
+		// first so a failed scale down finds the node again on the next reconcile
+		claim := &corev1.PersistentVolumeClaim{ObjectMeta: metav1.ObjectMeta{
+			Name:      apps.DataVolumeClaimName(node),
+			Namespace: cr.GetNamespace(),
+		}}
+		err := r.Delete(ctx, claim)
+		if client.IgnoreNotFound(err) != nil {
+			return racks, r.recordFailure(ctx, cr, eventDeleteFailed, fmt.Sprintf("Failed to delete PersistentVolumeClaim %s", claim.Name), err)
+		}
+		if err == nil {
+			r.Recorder.Eventf(cr, corev1.EventTypeNormal, eventDeleted, "Deleted PersistentVolumeClaim %s", claim.Name)
+		}
+		replicas := rack.Replicas - 1
+		if err := r.scaleStatefulSet(ctx, cr, rack.StatefulSet, replicas); err != nil {
+			return racks, err
+		}
+		if isRemoved {
+			removed[pending-len(racks)].Replicas = replicas
+		} else {
+			racks[pending].Replicas = replicas
+		}
+		if !slices.Contains(op.Completed, node) {
+			op.Completed = append(op.Completed, node)
+		}
+		op.Node = ""
+		op.StartedAt = nil
+		op.Message = fmt.Sprintf("Node %s left the ring, scaling %s down to %d", node, rack.StatefulSet, replicas)
+		r.Recorder.Eventf(cr, corev1.EventTypeNormal, eventDecommissioned, "Decommissioned Cassandra node %s", node)
+	case "LEAVING":
+		op.Node = node
+		op.Message = fmt.Sprintf("Decommissioning node %s, its data is streamed to the other nodes", node)
+	case "NORMAL":
+		if auth := report.authentication; auth != nil {
+			remaining := int32(-1)
+			for _, other := range all {
+				if other.DC == rack.DC {
+					remaining += current[other.StatefulSet]
+				}
+			}
+			// system_auth is replicated to every node, its factor is lowered before a node leaves
+			if factor := auth.SystemAuthReplication[rack.DC]; factor > remaining {
+				op.Node = node
+				op.Message = fmt.Sprintf("Waiting for the replication factor of system_auth in %s to be lowered to %d", rack.DC, remaining)
+				return racks, nil
+			}
+		}
+		strategies, err := r.keyspaceReplication(ctx, cr, node)
+		if err != nil {
+			op.Node = node
+			op.Message = fmt.Sprintf("Waiting for the replication of the keyspaces: %v", err)
+			return racks, nil
+		}
+		if blocked := replicationBlocksRemoval(strategies, all, current, rack.DC); blocked != "" {
+			report.scaleDownBlocked = fmt.Sprintf("Cannot decommission %s: %s", node, blocked)
+			report.operation = nil
+			return racks, nil
+		}
+		if err := r.nodetoolBackground(ctx, cr.GetNamespace(), node, "decommission"); err != nil {
+			return racks, r.recordFailure(ctx, cr, eventDecommissionFailed, fmt.Sprintf("Failed to decommission %s", node), err)
+		}
+		now := metav1.Now()
+		op.Node = node
+		op.StartedAt = &now
+		op.Message = fmt.Sprintf("Decommissioning node %s", node)
+		r.Recorder.Eventf(cr, corev1.EventTypeNormal, eventDecommissioning, "Decommissioning Cassandra node %s", node)
+	default:
+		op.Node = node
+		op.Message = fmt.Sprintf("Waiting for node %s to be in NORMAL mode, it is %s", node, mode)
+	}
+	return racks, nil
+}
+
+// scaleStatefulSet lowers the replicas of a StatefulSet once its last node is decommissioned,
+// the StatefulSets of the removed racks are no longer rendered
+func (r *AxonOpsCassandraReconciler) scaleStatefulSet(ctx context.Context, cr *cassandraaxonopscomv1.AxonOpsCassandra, name string, replicas int32) error {
+	sts, err := r.getSts(name, cr.GetNamespace())
+	if err != nil {
+		return client.IgnoreNotFound(err)
+	}
+	patch := client.MergeFrom(sts.DeepCopy())
+	sts.Spec.Replicas = &replicas
+	if err := r.Patch(ctx, sts, patch); err != nil {
+		return r.recordFailure(ctx, cr, eventUpdateFailed, fmt.Sprintf("Failed to scale StatefulSet %s down", name), err)
+	}
+	return nil
+}
+
+// setScaleDownCondition reports a refused scale down in the ScaleDownBlocked condition, the
+// condition is removed once the nodes can be removed or the replicas are raised again
+func setScaleDownCondition(cr *cassandraaxonopscomv1.AxonOpsCassandra, report *nodeOperationReport) {
+	if report.scaleDownBlocked == "" {
+		meta.RemoveStatusCondition(&cr.Status.Conditions, cassandraaxonopscomv1.ConditionScaleDownBlocked)
+		return
+	}
+	meta.SetStatusCondition(&cr.Status.Conditions, metav1.Condition{
+		Type:               cassandraaxonopscomv1.ConditionScaleDownBlocked,
+		Status:             metav1.ConditionTrue,
+		Reason:             reasonReplicationFactor,
+		Message:            report.scaleDownBlocked,
+		ObservedGeneration: cr.GetGeneration(),
+	})
+}
+
+// replicationBlocksRemoval returns why a node of dc cannot be removed without leaving a
+// keyspace with fewer nodes than its replication factor, or "" when it can be removed
+func replicationBlocksRemoval(strategies []replicationStrategy, racks []apps.CassandraRack, current map[string]int32, dc string) string {
+	remaining := map[string]int{}
+	total := -1
+	for _, rack := range racks {
+		remaining[rack.DC] += int(current[rack.StatefulSet])
+		total += int(current[rack.StatefulSet])
+	}
+	remaining[dc]--
+
+	for _, s := range strategies {
+		switch s.class {
+		case "SimpleStrategy":
+			if factor := s.factors["replication_factor"]; factor > total {
+				return fmt.Sprintf("keyspace %s has a replication factor of %d and %d nodes would be left", s.keyspace, factor, total)
+			}
+		case "NetworkTopologyStrategy":
+			if factor := s.factors[dc]; factor > remaining[dc] {
+				return fmt.Sprintf("keyspace %s has a replication factor of %d in %s and %d nodes would be left",
+					s.keyspace, factor, dc, remaining[dc])
+			}
+		}
+	}
+	return ""
+}
@@ -0,0 +1,57 @@
+/*
+Copyright AxonOps Limited 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+
+	corev1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	cassandraaxonopscomv1 "github.com/axonops/axonops-developer-operator/api/v1"
+	"github.com/axonops/axonops-developer-operator/apps"
+)
+
+// applySeeds writes the seeds of the cluster ca-<name> to its seeds ConfigMap. The ready pods
+// are the nodes that joined the ring and the live ConfigMap gives the seeds to keep.
+func (r *AxonOpsCassandraReconciler) applySeeds(ctx context.Context, cr *cassandraaxonopscomv1.AxonOpsCassandra, name string,
+	cluster cassandraaxonopscomv1.AxonOpsCassandraCluster, racks []apps.CassandraRack, drift *driftReport) error {
+	var pods corev1.PodList
+	if err := r.List(ctx, &pods, client.InNamespace(cr.GetNamespace()), client.MatchingLabels{"app": "ca-" + name}); err != nil {
+		return r.recordFailure(ctx, cr, eventUpdateFailed, "Failed to list the Cassandra pods", err)
+	}
+	joined := map[string]bool{}
+	for i := range pods.Items {
+		if isPodReady(&pods.Items[i]) {
+			joined[pods.Items[i].Name] = true
+		}
+	}
+
+	previous := ""
+	live := &corev1.ConfigMap{}
+	err := r.Get(ctx, client.ObjectKey{Namespace: cr.GetNamespace(), Name: apps.CassandraSeedsConfigMapName(name)}, live)
+	switch {
+	case err == nil:
+		previous = live.Data[apps.CassandraSeedsKey]
+	case client.IgnoreNotFound(err) != nil:
+		return r.recordFailure(ctx, cr, eventUpdateFailed, "Failed to get the Cassandra seeds", err)
+	}
+
+	seeds := apps.CassandraSeeds(name, cr.GetNamespace(), cluster, racks, previous, joined)
+	_, err = r.applyOwned(ctx, cr, apps.GenerateCassandraSeedsConfigMap(name, cr.GetNamespace(), cluster, seeds), drift)
+	return err
+}
@@ -0,0 +1,107 @@
+/*
+Copyright AxonOps Limited 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	cassandraaxonopscomv1 "github.com/axonops/axonops-developer-operator/api/v1"
+)
+
+// Bounds of the requeue delay while a startup step waits for its dependencies
+const (
+	minStartupBackoff = 5 * time.Second
+	maxStartupBackoff = time.Minute
+)
+
+// reasonWaitingForDependencies is used in the Ready condition while a startup step is blocked
+const reasonWaitingForDependencies = "WaitingForDependencies"
+
+// Startup steps that wait for other components. Elasticsearch and the metrics Cassandra have no dependencies.
+const (
+	stepAxonServer = "AxonServer"
+	stepDashboard  = "Dashboard"
+	stepCassandra  = "Cassandra"
+)
+
+// startupGate holds back the creation of a component until the components it depends on are
+// ready, e.g. axon-server crash-loops until Elasticsearch is reachable. A component that
+// already exists is always updated so a spec change is never held up by a rolling dependency.
+type startupGate struct {
+	parallel   bool
+	components map[string]componentStatus
+	blockedOn  string
+	waitingFor []string
+}
+
+func newStartupGate(cr *cassandraaxonopscomv1.AxonOpsCassandra, components []componentStatus) *startupGate {
+	g := &startupGate{
+		parallel:   cr.Spec.ParallelStartup,
+		components: map[string]componentStatus{},
+	}
+	for _, c := range components {
+		g.components[c.conditionType] = c
+	}
+	return g
+}
+
+// allow reports whether the step creating the component can run. The first blocked step
+// is recorded so it can be reported in the status.
+func (g *startupGate) allow(step string, component string, dependencies ...string) bool {
+	if g.parallel || g.components[component].found {
+		return true
+	}
+
+	waitingFor := []string{}
+	for _, dep := range dependencies {
+		c, ok := g.components[dep]
+		if ok && !c.isReady() {
+			waitingFor = append(waitingFor, c.name)
+		}
+	}
+	if len(waitingFor) == 0 {
+		return true
+	}
+	if g.blockedOn == "" {
+		g.blockedOn = step
+		g.waitingFor = waitingFor
+	}
+	return false
+}
+
+func (g *startupGate) blocked() bool {
+	return g.blockedOn != ""
+}
+
+func (g *startupGate) message() string {
+	return fmt.Sprintf("%s is waiting for %s to be ready", g.blockedOn, strings.Join(g.waitingFor, ", "))
+}
+
+// startupBackoff returns how long to wait before checking the dependencies again. The delay
+// grows with the time the environment has been starting so a slow dependency is polled less often.
+func startupBackoff(cr *cassandraaxonopscomv1.AxonOpsCassandra) time.Duration {
+	delay := time.Since(cr.GetCreationTimestamp().Time)
+	if delay < minStartupBackoff {
+		return minStartupBackoff
+	}
+	if delay > maxStartupBackoff {
+		return maxStartupBackoff
+	}
+	return delay
+}
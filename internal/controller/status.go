@@ -0,0 +1,349 @@
+/*
+Copyright AxonOps Limited 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	cassandraaxonopscomv1 "github.com/axonops/axonops-developer-operator/api/v1"
+	"github.com/axonops/axonops-developer-operator/apps"
+)
+
+// notReadyRequeueInterval is how often the status is refreshed while the environment is not ready
+const notReadyRequeueInterval = 15 * time.Second
+
+// Reasons used in the component conditions
+const (
+	reasonReplicasReady    = "ReplicasReady"
+	reasonReplicasNotReady = "ReplicasNotReady"
+	reasonProgressing      = "Progressing"
+	reasonNotFound         = "NotFound"
+	reasonAllReady         = "AllComponentsReady"
+	reasonNotAllReady      = "ComponentsNotReady"
+	reasonDeleting         = "Deleting"
+)
+
+// workloadRef links a status condition to the workload it reports on
+type workloadRef struct {
+	conditionType string
+	name          string
+}
+
+// componentStatus is the observed state of one of the workloads that make up the environment
+type componentStatus struct {
+	conditionType string
+	name          string
+	found         bool
+	progressing   bool
+	desired       int32
+	ready         int32
+	// racks is only set for the Cassandra cluster, which is made of one StatefulSet per rack
+	racks []cassandraaxonopscomv1.RackStatus
+}
+
+func (c componentStatus) isReady() bool {
+	return c.found && !c.progressing && c.ready >= c.desired
+}
+
+func (c componentStatus) condition(generation int64) metav1.Condition {
+	cond := metav1.Condition{
+		Type:               c.conditionType,
+		ObservedGeneration: generation,
+	}
+	switch {
+	case !c.found:
+		cond.Status = metav1.ConditionFalse
+		cond.Reason = reasonNotFound
+		cond.Message = fmt.Sprintf("%s has not been created yet", c.name)
+	case c.isReady():
+		cond.Status = metav1.ConditionTrue
+		cond.Reason = reasonReplicasReady
+		cond.Message = fmt.Sprintf("%s has %d/%d replicas ready", c.name, c.ready, c.desired)
+	case c.progressing:
+		cond.Status = metav1.ConditionFalse
+		cond.Reason = reasonProgressing
+		cond.Message = fmt.Sprintf("%s is rolling out, %d/%d replicas ready", c.name, c.ready, c.desired)
+	default:
+		cond.Status = metav1.ConditionFalse
+		cond.Reason = reasonReplicasNotReady
+		cond.Message = fmt.Sprintf("%s has %d/%d replicas ready", c.name, c.ready, c.desired)
+	}
+	return cond
+}
+
+func stsComponentStatus(conditionType string, name string, sts *appsv1.StatefulSet) componentStatus {
+	c := componentStatus{conditionType: conditionType, name: name}
+	if sts == nil {
+		return c
+	}
+	c.found = true
+	c.desired = 1
+	if sts.Spec.Replicas != nil {
+		c.desired = *sts.Spec.Replicas
+	}
+	c.ready = sts.Status.ReadyReplicas
+	// the StatefulSet controller does not move the current revision of an OnDelete StatefulSet,
+	// the updated replicas tell when all its pods were restarted
+	c.progressing = sts.Status.ObservedGeneration < sts.Generation ||
+		sts.Status.Replicas != c.desired ||
+		sts.Status.UpdatedReplicas < c.desired ||
+		(sts.Spec.UpdateStrategy.Type != appsv1.OnDeleteStatefulSetStrategyType &&
+			sts.Status.UpdateRevision != "" && sts.Status.CurrentRevision != sts.Status.UpdateRevision)
+	return c
+}
+
+func deploymentComponentStatus(conditionType string, name string, dep *appsv1.Deployment) componentStatus {
+	c := componentStatus{conditionType: conditionType, name: name}
+	if dep == nil {
+		return c
+	}
+	c.found = true
+	c.desired = 1
+	if dep.Spec.Replicas != nil {
+		c.desired = *dep.Spec.Replicas
+	}
+	c.ready = dep.Status.ReadyReplicas
+	c.progressing = dep.Status.ObservedGeneration < dep.Generation ||
+		dep.Status.Replicas != c.desired ||
+		dep.Status.UpdatedReplicas < c.desired
+	return c
+}
+
+// componentStatuses looks up every workload owned by the AxonOpsCassandra and reports how ready it is
+func (r *AxonOpsCassandraReconciler) componentStatuses(cr *cassandraaxonopscomv1.AxonOpsCassandra) ([]componentStatus, error) {
+	name := cr.GetName()
+	namespace := cr.GetNamespace()
+	components := []componentStatus{}
+
+	stsComponents := []workloadRef{
+		{cassandraaxonopscomv1.ConditionElasticsearchReady, "es-" + name},
+		{cassandraaxonopscomv1.ConditionAxonServerReady, "as-" + name},
+	}
+	if cr.Spec.AxonOps.Server.MetricsStore.Enabled {
+		stsComponents = append(stsComponents,
+			workloadRef{cassandraaxonopscomv1.ConditionMetricsCassandraReady, "ca-metrics-" + name})
+	}
+
+	for _, s := range stsComponents {
+		sts, err := r.getSts(s.name, namespace)
+		if client.IgnoreNotFound(err) != nil {
+			return nil, err
+		}
+		components = append(components, stsComponentStatus(s.conditionType, s.name, sts))
+	}
+
+	cassandra, err := r.cassandraComponentStatus(cr)
+	if err != nil {
+		return nil, err
+	}
+	components = append(components, cassandra)
+
+	dep, err := r.getDeployment("ds-"+name, namespace)
+	if client.IgnoreNotFound(err) != nil {
+		return nil, err
+	}
+	components = append(components, deploymentComponentStatus(cassandraaxonopscomv1.ConditionDashboardReady, "ds-"+name, dep))
+
+	return components, nil
+}
+
+// cassandraComponentStatus adds up the StatefulSets of all the racks of the Cassandra cluster.
+// The cluster is found once any rack exists and is progressing while a rack is still missing.
+func (r *AxonOpsCassandraReconciler) cassandraComponentStatus(cr *cassandraaxonopscomv1.AxonOpsCassandra) (componentStatus, error) {
+	c := componentStatus{
+		conditionType: cassandraaxonopscomv1.ConditionCassandraReady,
+		name:          "ca-" + cr.GetName(),
+	}
+	for _, rack := range apps.CassandraRacks(cr.GetName(), apps.CassandraCluster(*cr)) {
+		sts, err := r.getSts(rack.StatefulSet, cr.GetNamespace())
+		if client.IgnoreNotFound(err) != nil {
+			return c, err
+		}
+		rs := stsComponentStatus(c.conditionType, rack.StatefulSet, sts)
+		c.found = c.found || rs.found
+		// a rack is also progressing while its nodes are decommissioned before a scale down
+		c.progressing = c.progressing || rs.progressing || !rs.found || rs.desired != rack.Replicas
+		c.desired += rack.Replicas
+		c.ready += rs.ready
+		c.racks = append(c.racks, cassandraaxonopscomv1.RackStatus{
+			Name:          rack.Name,
+			DC:            rack.DC,
+			StatefulSet:   rack.StatefulSet,
+			Replicas:      rack.Replicas,
+			ReadyReplicas: rs.ready,
+		})
+	}
+	return c, nil
+}
+
+// computePhase rolls the component states up into a single phase. A component that was
+// ready before and is now failing without a rollout in progress makes the environment Degraded.
+func computePhase(previous []metav1.Condition, components []componentStatus) cassandraaxonopscomv1.AxonOpsCassandraPhase {
+	found := 0
+	ready := 0
+	degraded := false
+	for _, c := range components {
+		if c.found {
+			found++
+		}
+		if c.isReady() {
+			ready++
+			continue
+		}
+		if c.found && !c.progressing && meta.IsStatusConditionTrue(previous, c.conditionType) {
+			degraded = true
+		}
+	}
+
+	switch {
+	case found == 0:
+		return cassandraaxonopscomv1.PhasePending
+	case ready == len(components):
+		return cassandraaxonopscomv1.PhaseReady
+	case degraded:
+		return cassandraaxonopscomv1.PhaseDegraded
+	default:
+		return cassandraaxonopscomv1.PhaseProvisioning
+	}
+}
+
+// updateStatus refreshes the component conditions, the overall Ready condition and the phase
+func (r *AxonOpsCassandraReconciler) updateStatus(ctx context.Context, cr *cassandraaxonopscomv1.AxonOpsCassandra,
+	drift *driftReport, gate *startupGate, nodeOps *nodeOperationReport) error {
+	components, err := r.componentStatuses(cr)
+	if err != nil {
+		return err
+	}
+
+	original := cr.DeepCopy()
+	previous := original.Status.Conditions
+
+	notReady := []string{}
+	for _, c := range components {
+		meta.SetStatusCondition(&cr.Status.Conditions, c.condition(cr.GetGeneration()))
+		if !c.isReady() {
+			notReady = append(notReady, c.conditionType)
+		}
+		if c.conditionType == cassandraaxonopscomv1.ConditionCassandraReady {
+			cr.Status.Racks = c.racks
+		}
+	}
+	if !cr.Spec.AxonOps.Server.MetricsStore.Enabled {
+		meta.RemoveStatusCondition(&cr.Status.Conditions, cassandraaxonopscomv1.ConditionMetricsCassandraReady)
+	}
+
+	ready := metav1.Condition{
+		Type:               cassandraaxonopscomv1.ConditionReady,
+		Status:             metav1.ConditionTrue,
+		Reason:             reasonAllReady,
+		Message:            "All the AxonOps and Cassandra components are ready",
+		ObservedGeneration: cr.GetGeneration(),
+	}
+	if len(notReady) > 0 {
+		ready.Status = metav1.ConditionFalse
+		ready.Reason = reasonNotAllReady
+		ready.Message = "Waiting for " + strings.Join(notReady, ", ")
+	}
+	cr.Status.BlockedOn = ""
+	if gate != nil && gate.blocked() {
+		ready.Reason = reasonWaitingForDependencies
+		ready.Message = gate.message()
+		cr.Status.BlockedOn = gate.blockedOn
+	}
+	meta.SetStatusCondition(&cr.Status.Conditions, ready)
+
+	setDriftCondition(cr, drift)
+	if cond := meta.FindStatusCondition(cr.Status.Conditions, cassandraaxonopscomv1.ConditionDriftDetected); cond != nil &&
+		cond.Status == metav1.ConditionTrue {
+		if prev := meta.FindStatusCondition(previous, cond.Type); prev == nil ||
+			prev.Status != metav1.ConditionTrue || prev.Message != cond.Message {
+			r.Recorder.Event(cr, corev1.EventTypeWarning, cond.Reason, cond.Message)
+		}
+	}
+
+	if nodeOps != nil {
+		cr.Status.Operation = nodeOps.operation
+		cr.Status.Upgrade = nodeOps.upgrade
+		cr.Status.DeadNodes = nodeOps.deadNodes
+		cr.Status.Authentication = nodeOps.authentication
+		cr.Status.TLS = nodeOps.tls
+		setScaleDownCondition(cr, nodeOps)
+		setUpgradeCondition(cr, nodeOps)
+		setDeadNodesCondition(cr)
+		for _, c := range []struct{ condType, reason string }{
+			{cassandraaxonopscomv1.ConditionScaleDownBlocked, eventScaleDownBlocked},
+			{cassandraaxonopscomv1.ConditionUpgradeHalted, eventUpgradeHalted},
+			{cassandraaxonopscomv1.ConditionDeadNodes, eventDeadNodes},
+		} {
+			if cond := meta.FindStatusCondition(cr.Status.Conditions, c.condType); cond != nil {
+				if prev := meta.FindStatusCondition(previous, cond.Type); prev == nil || prev.Message != cond.Message {
+					r.Recorder.Event(cr, corev1.EventTypeWarning, c.reason, cond.Message)
+				}
+			}
+		}
+	}
+
+	meta.SetStatusCondition(&cr.Status.Conditions, metav1.Condition{
+		Type:               cassandraaxonopscomv1.ConditionReconciled,
+		Status:             metav1.ConditionTrue,
+		Reason:             reasonReconcileSucceeded,
+		Message:            "The last reconcile completed without errors",
+		ObservedGeneration: cr.GetGeneration(),
+	})
+	r.recordTransitions(cr, previous, components)
+
+	cr.Status.Phase = computePhase(previous, components)
+	cr.Status.Reason = ready.Reason
+	cr.Status.Message = ready.Message
+	cr.Status.ObservedGeneration = cr.GetGeneration()
+
+	if equality.Semantic.DeepEqual(original.Status, cr.Status) {
+		return nil
+	}
+	return r.Status().Patch(ctx, cr, client.MergeFrom(original))
+}
+
+// updateDeletingStatus marks the environment as being removed
+func (r *AxonOpsCassandraReconciler) updateDeletingStatus(ctx context.Context, cr *cassandraaxonopscomv1.AxonOpsCassandra) error {
+	if cr.Status.Phase == cassandraaxonopscomv1.PhaseDeleting {
+		return nil
+	}
+	patch := client.MergeFrom(cr.DeepCopy())
+	meta.SetStatusCondition(&cr.Status.Conditions, metav1.Condition{
+		Type:               cassandraaxonopscomv1.ConditionReady,
+		Status:             metav1.ConditionFalse,
+		Reason:             reasonDeleting,
+		Message:            "The environment is being deleted",
+		ObservedGeneration: cr.GetGeneration(),
+	})
+	cr.Status.Phase = cassandraaxonopscomv1.PhaseDeleting
+	cr.Status.Reason = reasonDeleting
+	cr.Status.Message = "The environment is being deleted"
+	cr.Status.ObservedGeneration = cr.GetGeneration()
+
+	return r.Status().Patch(ctx, cr, patch)
+}
@@ -0,0 +1,425 @@
+/*
+Copyright AxonOps Limited 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	cassandraaxonopscomv1 "github.com/axonops/axonops-developer-operator/api/v1"
+	"github.com/axonops/axonops-developer-operator/apps"
+)
+
+// certificateRenewBefore is how long before their expiry the certificates issued by the
+// operator are renewed
+const certificateRenewBefore = 30 * 24 * time.Hour
+
+// nodeCertificate is the certificate and the private key of a node, PEM encoded
+type nodeCertificate struct {
+	cert, key []byte
+}
+
+// ensureTLS writes the keystores of the nodes to the keystores Secret, and the certificate of
+// the AxonOps server to its own Secret, before their pods start. The certificates are issued
+// by the certificate authority of the operator, or by cert-manager when an issuer is set. A
+// node keeps its certificate as long as it is signed by the certificate authority and not
+// about to expire, the keystores of the removed nodes are dropped. Renewing the certificate of
+// a running node sets the rotated-at annotation of the Secret, copied to the pod templates so
+// the nodes restart one at a time with their new certificate.
+func (r *AxonOpsCassandraReconciler) ensureTLS(ctx context.Context, cr *cassandraaxonopscomv1.AxonOpsCassandra,
+	racks []apps.CassandraRack, report *nodeOperationReport) error {
+	tls := cr.Spec.Cassandra.TLS
+	if !apps.TLSRequired(cr.Spec.Cassandra) {
+		report.tls = nil
+		return nil
+	}
+	report.tls = &cassandraaxonopscomv1.TLSStatus{Secret: apps.CassandraKeystoresSecretName(cr.GetName())}
+	nodes := []string{}
+	for _, rack := range racks {
+		for i := int32(0); i < rack.Replicas; i++ {
+			nodes = append(nodes, fmt.Sprintf("%s-%d", rack.StatefulSet, i))
+		}
+	}
+	if tls.Agent {
+		nodes = append(nodes, apps.ServerCertificateNode(cr.GetName()))
+	}
+
+	var ca *certificateAuthority
+	var caPEM []byte
+	certificates := map[string]nodeCertificate{}
+	if tls.IssuerRef == nil {
+		var err error
+		ca, err = r.ensureCertificateAuthority(ctx, cr)
+		if err != nil {
+			return err
+		}
+		report.tls.CASecret = apps.CassandraCASecretName(cr.GetName())
+		caPEM = ca.certPEM
+	} else {
+		var waiting []string
+		var err error
+		caPEM, waiting, err = r.nodeCertificates(ctx, cr, nodes, certificates)
+		if err != nil {
+			return err
+		}
+		if len(waiting) > 0 {
+			report.tls.Message = fmt.Sprintf("Waiting for cert-manager to issue the certificates of %s", strings.Join(waiting, ", "))
+		}
+	}
+
+	name := apps.CassandraKeystoresSecretName(cr.GetName())
+	secret := &corev1.Secret{}
+	err := r.Get(ctx, client.ObjectKey{Namespace: cr.GetNamespace(), Name: name}, secret)
+	if client.IgnoreNotFound(err) != nil {
+		return err
+	}
+	exists := err == nil
+	data := maps.Clone(secret.Data)
+	if data == nil {
+		data = map[string][]byte{}
+	}
+	if len(data[apps.TLSPasswordKey]) == 0 {
+		password, err := apps.RandomPassword()
+		if err != nil {
+			return r.recordFailure(ctx, cr, eventRenderFailed, "Failed to generate the keystores password", err)
+		}
+		data[apps.TLSPasswordKey] = []byte(password)
+	}
+	password := string(data[apps.TLSPasswordKey])
+	server := apps.ServerCertificateNode(cr.GetName())
+	serverSecret := &corev1.Secret{}
+	err = r.Get(ctx, client.ObjectKey{Namespace: cr.GetNamespace(), Name: apps.ServerTLSSecretName(cr.GetName())}, serverSecret)
+	if client.IgnoreNotFound(err) != nil {
+		return err
+	}
+	serverExists := err == nil
+	if serverExists && len(data[server+".crt"]) == 0 {
+		data[server+".crt"] = serverSecret.Data[corev1.TLSCertKey]
+		data[server+".key"] = serverSecret.Data[corev1.TLSPrivateKeyKey]
+	}
+
+	// the nodes running with the previous certificates are restarted to load the new ones,
+	// the nodes that never started with a certificate are not
+	rotated := []string{}
+	if len(caPEM) > 0 && !bytes.Equal(data[apps.TLSCAKey], caPEM) {
+		truststore, err := encodeTruststore(caPEM, password)
+		if err != nil {
+			return r.recordFailure(ctx, cr, eventRenderFailed, "Failed to build the truststore", err)
+		}
+		if len(data[apps.TLSCAKey]) > 0 {
+			rotated = append(rotated, "the certificate authority")
+		}
+		data[apps.TLSCAKey] = caPEM
+		data[apps.TLSTruststoreKey] = truststore
+	}
+	for _, node := range nodes {
+		previous := data[node+".crt"]
+		certificate, ok := certificates[node]
+		switch {
+		case tls.IssuerRef != nil && (!ok || bytes.Equal(previous, certificate.cert)):
+			continue
+		case tls.IssuerRef == nil && signedBy(previous, caPEM) && !ca.shouldRenew(previous):
+			continue
+		case tls.IssuerRef == nil:
+			certificate.cert, certificate.key, err = ca.issue(node, apps.NodeDNSNames(cr.GetName(), cr.GetNamespace(), node))
+			if err != nil {
+				return r.recordFailure(ctx, cr, eventRenderFailed, fmt.Sprintf("Failed to issue the certificate of %s", node), err)
+			}
+		}
+		keystore, err := encodeKeystore(certificate.cert, certificate.key, caPEM, password)
+		if err != nil {
+			return r.recordFailure(ctx, cr, eventRenderFailed, fmt.Sprintf("Failed to build the keystore of %s", node), err)
+		}
+		if len(previous) > 0 {
+			rotated = append(rotated, node)
+		}
+		data[node+".p12"] = keystore
+		data[node+".crt"] = certificate.cert
+		data[node+".key"] = certificate.key
+	}
+	for key := range data {
+		node, ok := strings.CutSuffix(key, ".p12")
+		if ok && key != apps.TLSTruststoreKey && !slices.Contains(nodes, node) {
+			delete(data, node+".p12")
+			delete(data, node+".crt")
+			delete(data, node+".key")
+		}
+	}
+
+	caNotAfter, err := certificateNotAfter(caPEM)
+	if err == nil {
+		report.tls.CANotAfter = &metav1.Time{Time: caNotAfter}
+		if time.Until(caNotAfter) < certificateRenewBefore && report.tls.Message == "" {
+			report.tls.Message = fmt.Sprintf("The certificate authority expires on %s, the certificates cannot be renewed past it",
+				caNotAfter.UTC().Format(time.RFC3339))
+		}
+	}
+	for _, node := range nodes {
+		if notAfter, err := certificateNotAfter(data[node+".crt"]); err == nil {
+			report.tls.Certificates = append(report.tls.Certificates,
+				cassandraaxonopscomv1.CertificateStatus{Name: node, NotAfter: metav1.Time{Time: notAfter}})
+		}
+	}
+
+	// the certificate of the server is written to its own Secret, it is not part of the keystores
+	serverData := map[string][]byte{
+		apps.TLSCAKey:           data[apps.TLSCAKey],
+		corev1.TLSCertKey:       data[server+".crt"],
+		corev1.TLSPrivateKeyKey: data[server+".key"],
+	}
+	delete(data, server+".p12")
+	delete(data, server+".crt")
+	delete(data, server+".key")
+	if err := r.writeServerTLS(ctx, cr, serverSecret, serverExists, serverData); err != nil {
+		return err
+	}
+
+	annotations := maps.Clone(secret.GetAnnotations())
+	if len(rotated) > 0 {
+		if annotations == nil {
+			annotations = map[string]string{}
+		}
+		annotations[cassandraaxonopscomv1.TLSRotatedAtAnnotation] = time.Now().UTC().Format(time.RFC3339)
+	}
+	if rotatedAt, err := time.Parse(time.RFC3339, annotations[cassandraaxonopscomv1.TLSRotatedAtAnnotation]); err == nil {
+		report.tls.RotatedAt = &metav1.Time{Time: rotatedAt}
+	}
+
+	if !exists {
+		secret = &corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      name,
+				Namespace: cr.GetNamespace(),
+				Labels:    map[string]string{"app": "ds-" + cr.GetName(), "component": "cassandra"},
+			},
+			Data: data,
+		}
+		if err := ctrl.SetControllerReference(cr, secret, r.Scheme); err != nil {
+			return err
+		}
+		if err := r.Create(ctx, secret); err != nil {
+			return r.recordFailure(ctx, cr, eventCreateFailed, fmt.Sprintf("Failed to create Secret %s", name), err)
+		}
+		r.Recorder.Eventf(cr, corev1.EventTypeNormal, eventCreated, "Created Secret %s", name)
+		return nil
+	}
+	if maps.EqualFunc(data, secret.Data, bytes.Equal) {
+		return nil
+	}
+	secret.Data = data
+	secret.SetAnnotations(annotations)
+	if err := r.Update(ctx, secret); err != nil {
+		return r.recordFailure(ctx, cr, eventUpdateFailed, fmt.Sprintf("Failed to update Secret %s", name), err)
+	}
+	r.Recorder.Eventf(cr, corev1.EventTypeNormal, eventUpdated, "Updated Secret %s", name)
+	if len(rotated) > 0 {
+		r.Recorder.Eventf(cr, corev1.EventTypeNormal, eventCertificatesRotated,
+			"Renewed the certificates of %s, restarting the nodes", strings.Join(rotated, ", "))
+	}
+	return nil
+}
+
+// writeServerTLS creates or updates the Secret of the certificate of the AxonOps server, it
+// is deleted once the agents no longer connect over TLS
+func (r *AxonOpsCassandraReconciler) writeServerTLS(ctx context.Context, cr *cassandraaxonopscomv1.AxonOpsCassandra,
+	secret *corev1.Secret, exists bool, data map[string][]byte) error {
+	name := apps.ServerTLSSecretName(cr.GetName())
+	if !cr.Spec.Cassandra.TLS.Agent {
+		if !exists {
+			return nil
+		}
+		if err := r.Delete(ctx, secret); client.IgnoreNotFound(err) != nil {
+			return r.recordFailure(ctx, cr, eventDeleteFailed, fmt.Sprintf("Failed to delete Secret %s", name), err)
+		}
+		r.Recorder.Eventf(cr, corev1.EventTypeNormal, eventDeleted, "Deleted Secret %s", name)
+		return nil
+	}
+	// cert-manager has not issued the certificate yet
+	if len(data[corev1.TLSCertKey]) == 0 {
+		return nil
+	}
+
+	if !exists {
+		secret = &corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      name,
+				Namespace: cr.GetNamespace(),
+				Labels:    map[string]string{"app": "ds-" + cr.GetName(), "component": "axon-server"},
+			},
+			Type: corev1.SecretTypeTLS,
+			Data: data,
+		}
+		if err := ctrl.SetControllerReference(cr, secret, r.Scheme); err != nil {
+			return err
+		}
+		if err := r.Create(ctx, secret); err != nil {
+			return r.recordFailure(ctx, cr, eventCreateFailed, fmt.Sprintf("Failed to create Secret %s", name), err)
+		}
+		r.Recorder.Eventf(cr, corev1.EventTypeNormal, eventCreated, "Created Secret %s", name)
+		return nil
+	}
+	if maps.EqualFunc(data, secret.Data, bytes.Equal) {
+		return nil
+	}
+	secret.Data = data
+	if err := r.Update(ctx, secret); err != nil {
+		return r.recordFailure(ctx, cr, eventUpdateFailed, fmt.Sprintf("Failed to update Secret %s", name), err)
+	}
+	r.Recorder.Eventf(cr, corev1.EventTypeNormal, eventUpdated, "Updated Secret %s", name)
+	return nil
+}
+
+// setTLSRotation copies the time the certificates were last renewed to a pod template, so
+// the pods restart when they are renewed again
+func setTLSRotation(template *corev1.PodTemplateSpec, status *cassandraaxonopscomv1.TLSStatus) {
+	if status == nil || status.RotatedAt == nil {
+		return
+	}
+	if template.Annotations == nil {
+		template.Annotations = map[string]string{}
+	}
+	template.Annotations[cassandraaxonopscomv1.TLSRotatedAtAnnotation] = status.RotatedAt.UTC().Format(time.RFC3339)
+}
+
+// setServerTLS switches the AxonOps server to TLS once its certificate is in the keystores
+// Secret. The server is created before the Cassandra nodes and their Secret, so it starts in
+// clear text and restarts with its certificate once the status reports it.
+func setServerTLS(cr *cassandraaxonopscomv1.AxonOpsCassandra, sts *appsv1.StatefulSet) {
+	status := cr.Status.TLS
+	node := apps.ServerCertificateNode(cr.GetName())
+	if !cr.Spec.Cassandra.TLS.Agent || status == nil ||
+		!slices.ContainsFunc(status.Certificates, func(c cassandraaxonopscomv1.CertificateStatus) bool { return c.Name == node }) {
+		return
+	}
+	apps.MountServerTLS(&sts.Spec.Template.Spec, cr.GetName())
+	setTLSRotation(&sts.Spec.Template, status)
+}
+
+// ensureCertificateAuthority loads the certificate authority of the cluster, it is generated
+// the first time and kept in a Secret of type kubernetes.io/tls
+func (r *AxonOpsCassandraReconciler) ensureCertificateAuthority(ctx context.Context,
+	cr *cassandraaxonopscomv1.AxonOpsCassandra) (*certificateAuthority, error) {
+	name := apps.CassandraCASecretName(cr.GetName())
+	secret := &corev1.Secret{}
+	err := r.Get(ctx, client.ObjectKey{Namespace: cr.GetNamespace(), Name: name}, secret)
+	if err == nil {
+		ca, err := parseCertificateAuthority(secret.Data[corev1.TLSCertKey], secret.Data[corev1.TLSPrivateKeyKey])
+		if err != nil {
+			return nil, r.recordFailure(ctx, cr, eventRenderFailed, fmt.Sprintf("Failed to load the certificate authority of Secret %s", name), err)
+		}
+		return ca, nil
+	}
+	if !apierrors.IsNotFound(err) {
+		return nil, err
+	}
+
+	ca, err := newCertificateAuthority(fmt.Sprintf("%s Cassandra CA", cr.GetName()))
+	if err != nil {
+		return nil, r.recordFailure(ctx, cr, eventRenderFailed, "Failed to generate the certificate authority", err)
+	}
+	secret = &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: cr.GetNamespace(),
+			Labels:    map[string]string{"app": "ds-" + cr.GetName(), "component": "cassandra"},
+		},
+		Type: corev1.SecretTypeTLS,
+		Data: map[string][]byte{
+			corev1.TLSCertKey:       ca.certPEM,
+			corev1.TLSPrivateKeyKey: ca.keyPEM,
+			apps.TLSCAKey:           ca.certPEM,
+		},
+	}
+	if err := ctrl.SetControllerReference(cr, secret, r.Scheme); err != nil {
+		return nil, err
+	}
+	if err := r.Create(ctx, secret); err != nil {
+		return nil, r.recordFailure(ctx, cr, eventCreateFailed, fmt.Sprintf("Failed to create Secret %s", name), err)
+	}
+	r.Recorder.Eventf(cr, corev1.EventTypeNormal, eventCreated, "Created Secret %s", name)
+	return ca, nil
+}
+
+// nodeCertificates applies the cert-manager Certificate of every node and collects the
+// certificates cert-manager issued. It returns the certificate of the issuer and the nodes
+// still waiting for their certificate. The Certificates of the removed nodes are deleted.
+func (r *AxonOpsCassandraReconciler) nodeCertificates(ctx context.Context, cr *cassandraaxonopscomv1.AxonOpsCassandra,
+	nodes []string, certificates map[string]nodeCertificate) ([]byte, []string, error) {
+	if _, err := r.RESTMapper().RESTMapping(apps.CertificateGVK.GroupKind(), apps.CertificateGVK.Version); err != nil {
+		if meta.IsNoMatchError(err) {
+			err = fmt.Errorf("cert-manager is not installed")
+		}
+		return nil, nil, r.recordFailure(ctx, cr, eventCreateFailed, "Cannot issue the certificates of the nodes with cert-manager", err)
+	}
+
+	var caPEM []byte
+	waiting := []string{}
+	for _, node := range nodes {
+		certificate := apps.GenerateNodeCertificate(cr.GetName(), cr.GetNamespace(), node, cr.Spec.Cassandra)
+		if _, err := r.applyOwned(ctx, cr, certificate, nil); err != nil {
+			return nil, nil, err
+		}
+		secret := &corev1.Secret{}
+		err := r.Get(ctx, client.ObjectKey{Namespace: cr.GetNamespace(), Name: apps.NodeCertificateName(node)}, secret)
+		if client.IgnoreNotFound(err) != nil {
+			return nil, nil, err
+		}
+		if err != nil || len(secret.Data[corev1.TLSCertKey]) == 0 || len(secret.Data[apps.TLSCAKey]) == 0 {
+			waiting = append(waiting, node)
+			continue
+		}
+		caPEM = secret.Data[apps.TLSCAKey]
+		certificates[node] = nodeCertificate{cert: secret.Data[corev1.TLSCertKey], key: secret.Data[corev1.TLSPrivateKeyKey]}
+	}
+
+	list := &unstructured.UnstructuredList{}
+	list.SetGroupVersionKind(apps.CertificateGVK.GroupVersion().WithKind(apps.CertificateGVK.Kind + "List"))
+	if err := r.List(ctx, list, client.InNamespace(cr.GetNamespace()),
+		client.MatchingLabels{"app": "ds-" + cr.GetName(), "component": "cassandra"}); err != nil {
+		return nil, nil, err
+	}
+	for i := range list.Items {
+		certificate := &list.Items[i]
+		node, _ := strings.CutSuffix(certificate.GetName(), "-tls")
+		if slices.Contains(nodes, node) || !metav1.IsControlledBy(certificate, cr) {
+			continue
+		}
+		if err := r.Delete(ctx, certificate); client.IgnoreNotFound(err) != nil {
+			return nil, nil, r.recordFailure(ctx, cr, eventDeleteFailed, fmt.Sprintf("Failed to delete Certificate %s", certificate.GetName()), err)
+		}
+		secret := &corev1.Secret{ObjectMeta: metav1.ObjectMeta{Name: certificate.GetName(), Namespace: cr.GetNamespace()}}
+		if err := r.Delete(ctx, secret); client.IgnoreNotFound(err) != nil {
+			return nil, nil, r.recordFailure(ctx, cr, eventDeleteFailed, fmt.Sprintf("Failed to delete Secret %s", secret.GetName()), err)
+		}
+		r.Recorder.Eventf(cr, corev1.EventTypeNormal, eventDeleted, "Deleted Certificate %s", certificate.GetName())
+	}
+	return caPEM, waiting, nil
+}
@@ -0,0 +1,302 @@
+/*
+Copyright AxonOps Limited 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	cassandraaxonopscomv1 "github.com/axonops/axonops-developer-operator/api/v1"
+	"github.com/axonops/axonops-developer-operator/apps"
+)
+
+// upgradeRejoinTimeout is how long an upgraded node has to be back up and normal before
+// the upgrade is reported as halted
+const upgradeRejoinTimeout = 10 * time.Minute
+
+// Reasons used in the UpgradeHalted condition
+const (
+	reasonUnsupportedUpgrade = "UnsupportedUpgrade"
+	reasonSnapshotFailed     = "SnapshotFailed"
+	reasonNodeNotRejoined    = "NodeNotRejoined"
+)
+
+// upgradeHalt explains why a major version upgrade does not go on
+type upgradeHalt struct {
+	reason  string
+	message string
+}
+
+// upgradeSSTablesTask runs nodetool upgradesstables on the nodes once they run the new version
+var upgradeSSTablesTask = nodetoolTask{
+	command:       "upgradesstables",
+	startedReason: eventUpgradingSSTables,
+	doneReason:    eventUpgradedSSTables,
+	failedReason:  eventUpgradeSSTablesFailed,
+	started:       "Upgrading the SSTables of Cassandra node %s",
+	done:          "Upgraded the SSTables of Cassandra node %s",
+	failed:        "Failed to upgrade the SSTables of Cassandra node %s",
+	completed:     "Upgraded the SSTables of %d nodes",
+}
+
+// upgrade orchestrates a change of the Cassandra major version, which is refused for the racks
+// without a persistent volume. A snapshot of every node is taken with the previous version, then the nodes are restarted one at a time with the new
+// image by the rolling restart, which drains them first, and nodetool upgradesstables runs
+// on every node once they all run the new version. The image the StatefulSets must run is
+// returned, it is the previous one until the snapshots are taken and "" when the image of
+// the spec can be used.
+func (r *AxonOpsCassandraReconciler) upgrade(ctx context.Context, cr *cassandraaxonopscomv1.AxonOpsCassandra,
+	racks []apps.CassandraRack, report *nodeOperationReport) (string, error) {
+	desired := apps.CassandraImage(cr.Spec.Cassandra)
+	live := ""
+	for _, rack := range racks {
+		sts, err := r.getSts(rack.StatefulSet, cr.GetNamespace())
+		if client.IgnoreNotFound(err) != nil {
+			return "", err
+		}
+		if image := cassandraImageOf(sts); image != "" {
+			live = image
+			break
+		}
+	}
+
+	up := report.upgrade
+	if up != nil && up.Phase == cassandraaxonopscomv1.UpgradePhaseSnapshot && desired == up.From {
+		if op := report.operation; op.IsRunning() && op.Type == cassandraaxonopscomv1.NodeOperationSnapshot {
+			now := metav1.Now()
+			op.CompletedAt = &now
+			op.Message = "The upgrade was cancelled"
+		}
+		report.upgrade = nil
+		return "", nil
+	}
+	if !up.IsRunning() {
+		fromTag, toTag := apps.CassandraImageTag(live), apps.CassandraImageTag(desired)
+		if live == "" || !apps.IsCassandraMajorUpgrade(fromTag, toTag) {
+			return "", nil
+		}
+		if err := apps.ValidateCassandraUpgrade(fromTag, toTag); err != nil {
+			report.upgradeHalted = &upgradeHalt{reason: reasonUnsupportedUpgrade, message: err.Error()}
+			return live, nil
+		}
+		ephemeral := []string{}
+		for _, rack := range racks {
+			if !rack.Persistent {
+				ephemeral = append(ephemeral, rack.StatefulSet)
+			}
+		}
+		if len(ephemeral) > 0 {
+			report.upgradeHalted = &upgradeHalt{reason: reasonNoPersistentVolume, message: fmt.Sprintf(
+				"The nodes of %s have no persistent volume, their data and the snapshot taken before the upgrade would be lost with their pods",
+				strings.Join(ephemeral, ", "))}
+			return live, nil
+		}
+		if report.operation.IsRunning() {
+			return live, nil
+		}
+		now := metav1.Now()
+		up = &cassandraaxonopscomv1.UpgradeStatus{
+			From:      live,
+			To:        desired,
+			Phase:     cassandraaxonopscomv1.UpgradePhaseSnapshot,
+			Snapshot:  "pre-upgrade-" + now.UTC().Format("20060102150405"),
+			StartedAt: &now,
+		}
+		report.upgrade = up
+		report.operation = &cassandraaxonopscomv1.NodeOperationStatus{
+			Type:    cassandraaxonopscomv1.NodeOperationSnapshot,
+			Pending: nodeNames(racks),
+		}
+		r.Recorder.Eventf(cr, corev1.EventTypeNormal, eventUpgrading, "Upgrading Cassandra from %s to %s", live, desired)
+	}
+
+	var err error
+	switch up.Phase {
+	case cassandraaxonopscomv1.UpgradePhaseSnapshot:
+		err = r.upgradeSnapshot(ctx, cr, racks, report)
+	case cassandraaxonopscomv1.UpgradePhaseRestart:
+		err = r.upgradeRestart(cr, racks, report)
+	case cassandraaxonopscomv1.UpgradePhaseUpgradeSSTables:
+		err = r.upgradeSSTables(ctx, cr, racks, report)
+	}
+	if up.Phase == cassandraaxonopscomv1.UpgradePhaseSnapshot {
+		return up.From, err
+	}
+	return up.To, err
+}
+
+// upgradeSnapshot snapshots the next node, the upgrade stops on the first node that cannot
+// be snapshotted and retries it on the next reconcile
+func (r *AxonOpsCassandraReconciler) upgradeSnapshot(ctx context.Context, cr *cassandraaxonopscomv1.AxonOpsCassandra,
+	racks []apps.CassandraRack, report *nodeOperationReport) error {
+	up := report.upgrade
+	op := report.operation
+	if op.IsRunning() && op.Type != cassandraaxonopscomv1.NodeOperationSnapshot {
+		return nil
+	}
+	if !op.IsRunning() {
+		op = &cassandraaxonopscomv1.NodeOperationStatus{Type: cassandraaxonopscomv1.NodeOperationSnapshot, Pending: nodeNames(racks)}
+		report.operation = op
+	}
+
+	if len(op.Pending) > 0 {
+		node := op.Pending[0]
+		if _, err := r.nodetool(ctx, cr.GetNamespace(), node, "snapshot", "-t", up.Snapshot); err != nil {
+			report.upgradeHalted = &upgradeHalt{
+				reason:  reasonSnapshotFailed,
+				message: fmt.Sprintf("Cannot snapshot %s before the upgrade to %s: %v", node, up.To, err),
+			}
+			op.Message = fmt.Sprintf("Waiting for the snapshot of node %s", node)
+			return nil
+		}
+		op.Pending = op.Pending[1:]
+		op.Completed = append(op.Completed, node)
+		op.Message = fmt.Sprintf("Took snapshot %s of node %s", up.Snapshot, node)
+	}
+	if len(op.Pending) > 0 {
+		return nil
+	}
+
+	now := metav1.Now()
+	op.CompletedAt = &now
+	op.Message = fmt.Sprintf("Took snapshot %s of %d nodes", up.Snapshot, len(op.Completed))
+	up.Phase = cassandraaxonopscomv1.UpgradePhaseRestart
+	return nil
+}
+
+// upgradeRestart waits for the rolling restart to run every node with the new image. A node
+// that does not come back is reported, the rolling restart does not move to the next node.
+func (r *AxonOpsCassandraReconciler) upgradeRestart(cr *cassandraaxonopscomv1.AxonOpsCassandra,
+	racks []apps.CassandraRack, report *nodeOperationReport) error {
+	up := report.upgrade
+	op := report.operation
+	if op.IsRunning() && op.Type == cassandraaxonopscomv1.NodeOperationRestart && op.Node != "" &&
+		op.StartedAt != nil && time.Since(op.StartedAt.Time) > upgradeRejoinTimeout {
+		report.upgradeHalted = &upgradeHalt{
+			reason: reasonNodeNotRejoined,
+			message: fmt.Sprintf("Node %s did not rejoin the ring %s after its restart with %s, the upgrade is halted",
+				op.Node, upgradeRejoinTimeout, up.To),
+		}
+	}
+	if op.IsRunning() {
+		return nil
+	}
+	for _, rack := range racks {
+		sts, err := r.getSts(rack.StatefulSet, cr.GetNamespace())
+		if err != nil {
+			return client.IgnoreNotFound(err)
+		}
+		if cassandraImageOf(sts) != up.To || sts.Status.ObservedGeneration < sts.Generation ||
+			sts.Status.UpdatedReplicas != rack.Replicas || sts.Status.ReadyReplicas != rack.Replicas {
+			return nil
+		}
+	}
+
+	up.Phase = cassandraaxonopscomv1.UpgradePhaseUpgradeSSTables
+	report.operation = &cassandraaxonopscomv1.NodeOperationStatus{
+		Type:    cassandraaxonopscomv1.NodeOperationUpgradeSSTables,
+		Pending: nodeNames(racks),
+	}
+	return nil
+}
+
+// upgradeSSTables runs nodetool upgradesstables on the nodes one at a time, the upgrade is
+// completed once it ran on every node
+func (r *AxonOpsCassandraReconciler) upgradeSSTables(ctx context.Context, cr *cassandraaxonopscomv1.AxonOpsCassandra,
+	racks []apps.CassandraRack, report *nodeOperationReport) error {
+	up := report.upgrade
+	op := report.operation
+	if op.IsRunning() && op.Type != cassandraaxonopscomv1.NodeOperationUpgradeSSTables {
+		return nil
+	}
+	if !op.IsRunning() {
+		op = &cassandraaxonopscomv1.NodeOperationStatus{Type: cassandraaxonopscomv1.NodeOperationUpgradeSSTables, Pending: nodeNames(racks)}
+		report.operation = op
+	}
+	if err := r.runNodetoolTask(ctx, cr, op, upgradeSSTablesTask); err != nil || op.IsRunning() {
+		return err
+	}
+
+	now := metav1.Now()
+	up.Phase = cassandraaxonopscomv1.UpgradePhaseCompleted
+	up.CompletedAt = &now
+	r.Recorder.Eventf(cr, corev1.EventTypeNormal, eventUpgraded, "Upgraded Cassandra from %s to %s", up.From, up.To)
+	return nil
+}
+
+// setUpgradeCondition reports a halted upgrade in the UpgradeHalted condition, the condition
+// is removed once the upgrade goes on
+func setUpgradeCondition(cr *cassandraaxonopscomv1.AxonOpsCassandra, report *nodeOperationReport) {
+	if report.upgradeHalted == nil {
+		meta.RemoveStatusCondition(&cr.Status.Conditions, cassandraaxonopscomv1.ConditionUpgradeHalted)
+		return
+	}
+	meta.SetStatusCondition(&cr.Status.Conditions, metav1.Condition{
+		Type:               cassandraaxonopscomv1.ConditionUpgradeHalted,
+		Status:             metav1.ConditionTrue,
+		Reason:             report.upgradeHalted.reason,
+		Message:            report.upgradeHalted.message,
+		ObservedGeneration: cr.GetGeneration(),
+	})
+}
+
+// cassandraImageOf returns the image of the Cassandra container of a StatefulSet
+func cassandraImageOf(sts *appsv1.StatefulSet) string {
+	if sts == nil {
+		return ""
+	}
+	for _, c := range sts.Spec.Template.Spec.Containers {
+		if c.Name == cassandraContainer {
+			return c.Image
+		}
+	}
+	return ""
+}
+
+// setCassandraImage replaces the image of the Cassandra container of a StatefulSet and of the
+// init container merging its cassandra.yaml
+func setCassandraImage(sts *appsv1.StatefulSet, image string) {
+	for i := range sts.Spec.Template.Spec.Containers {
+		if sts.Spec.Template.Spec.Containers[i].Name == cassandraContainer {
+			sts.Spec.Template.Spec.Containers[i].Image = image
+		}
+	}
+	for i := range sts.Spec.Template.Spec.InitContainers {
+		if sts.Spec.Template.Spec.InitContainers[i].Name == apps.CassandraConfigContainer {
+			sts.Spec.Template.Spec.InitContainers[i].Image = image
+		}
+	}
+}
+
+// nodeNames lists the pods of the racks
+func nodeNames(racks []apps.CassandraRack) []string {
+	var nodes []string
+	for _, rack := range racks {
+		for i := int32(0); i < rack.Replicas; i++ {
+			nodes = append(nodes, fmt.Sprintf("%s-%d", rack.StatefulSet, i))
+		}
+	}
+	return nodes
+}
@@ -0,0 +1,181 @@
+/*
+Copyright AxonOps Limited 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	cassandraaxonopscomv1 "github.com/axonops/axonops-developer-operator/api/v1"
+	cassandraaxonopscomv1beta1 "github.com/axonops/axonops-developer-operator/api/v1beta1"
+)
+
+var _ = Describe("AxonOpsCassandra Conversion", func() {
+	var beta *cassandraaxonopscomv1beta1.AxonOpsCassandra
+
+	BeforeEach(func() {
+		beta = &cassandraaxonopscomv1beta1.AxonOpsCassandra{
+			ObjectMeta: metav1.ObjectMeta{Name: "test", Namespace: "default"},
+			Spec: cassandraaxonopscomv1beta1.AxonOpsCassandraSpec{
+				Cassandra: cassandraaxonopscomv1beta1.AxonOpsCassandraCluster{
+					Replicas:    3,
+					ClusterName: "my-dev-env",
+					Env:         []cassandraaxonopscomv1beta1.EnvVars{{Name: "JVM_EXTRA_OPTS", Value: "-Dfoo=bar"}},
+				},
+				AxonOps: cassandraaxonopscomv1beta1.AxonOpsCluster{
+					Server: cassandraaxonopscomv1beta1.AxonOpsServer{
+						CassandraMetricsEnabled: true,
+						CassandraMetricsCluster: cassandraaxonopscomv1beta1.AxonOpsCassandraCluster{
+							Replicas: 2,
+							DC:       "axonops2",
+							PersistentVolume: cassandraaxonopscomv1beta1.PersistentVolumeSpec{
+								Size:         "2Gi",
+								StorageClass: "local-path",
+							},
+						},
+					},
+					Elasticsearch: cassandraaxonopscomv1beta1.Elasticsearch{
+						PersistentVolume: cassandraaxonopscomv1beta1.PersistentVolumeSpec{Size: "5Gi"},
+					},
+				},
+			},
+			Status: cassandraaxonopscomv1beta1.AxonOpsCassandraStatus{Phase: cassandraaxonopscomv1beta1.PhaseReady},
+		}
+	})
+
+	Context("When converting from v1beta1", func() {
+		It("should move the metrics cluster to the metrics store", func() {
+			hub := &cassandraaxonopscomv1.AxonOpsCassandra{}
+			Expect(beta.ConvertTo(hub)).To(Succeed())
+
+			store := hub.Spec.AxonOps.Server.MetricsStore
+			Expect(store.Enabled).To(BeTrue())
+			Expect(store.Replicas).To(Equal(int32(2)))
+			Expect(store.DC).To(Equal("axonops2"))
+			Expect(store.PersistentVolume.Size.String()).To(Equal("2Gi"))
+			Expect(hub.Spec.AxonOps.Elasticsearch.PersistentVolume.Size.String()).To(Equal("5Gi"))
+			Expect(hub.Spec.Cassandra.Env).To(Equal([]corev1.EnvVar{{Name: "JVM_EXTRA_OPTS", Value: "-Dfoo=bar"}}))
+			Expect(hub.Status.Phase).To(Equal(cassandraaxonopscomv1.PhaseReady))
+		})
+
+		It("should keep the Cassandra volume taken from the metrics cluster", func() {
+			beta.Spec.Cassandra.PersistentVolume.Size = "50Gi"
+			hub := &cassandraaxonopscomv1.AxonOpsCassandra{}
+			Expect(beta.ConvertTo(hub)).To(Succeed())
+			Expect(hub.Spec.Cassandra.PersistentVolume.Size.String()).To(Equal("2Gi"))
+			Expect(hub.Spec.Cassandra.PersistentVolume.StorageClass).To(Equal("local-path"))
+		})
+
+		It("should fail on a volume size that is not a quantity", func() {
+			beta.Spec.AxonOps.Elasticsearch.PersistentVolume.Size = "ten gigs"
+			hub := &cassandraaxonopscomv1.AxonOpsCassandra{}
+			Expect(beta.ConvertTo(hub)).To(MatchError(ContainSubstring("spec.axonops.elasticsearch.persistentVolume.size")))
+		})
+
+		It("should convert back to the same v1beta1 object", func() {
+			beta.Spec.Cassandra.PersistentVolume = beta.Spec.AxonOps.Server.CassandraMetricsCluster.PersistentVolume
+			hub := &cassandraaxonopscomv1.AxonOpsCassandra{}
+			Expect(beta.ConvertTo(hub)).To(Succeed())
+
+			converted := &cassandraaxonopscomv1beta1.AxonOpsCassandra{}
+			Expect(converted.ConvertFrom(hub)).To(Succeed())
+			Expect(converted.GetAnnotations()).To(BeEmpty())
+			Expect(equality.Semantic.DeepEqual(converted.Spec, beta.Spec)).To(BeTrue())
+		})
+	})
+
+	Context("When converting from v1", func() {
+		var hub *cassandraaxonopscomv1.AxonOpsCassandra
+
+		BeforeEach(func() {
+			hub = &cassandraaxonopscomv1.AxonOpsCassandra{}
+			Expect(beta.ConvertTo(hub)).To(Succeed())
+			hub.Spec.Cassandra.PersistentVolume.Size = quantity("20Gi")
+			hub.Spec.Cassandra.Env = append(hub.Spec.Cassandra.Env, corev1.EnvVar{
+				Name: "POD_IP",
+				ValueFrom: &corev1.EnvVarSource{
+					FieldRef: &corev1.ObjectFieldSelector{FieldPath: "status.podIP"},
+				},
+			})
+		})
+
+		It("should not lose the fields v1beta1 cannot represent", func() {
+			converted := &cassandraaxonopscomv1beta1.AxonOpsCassandra{}
+			Expect(converted.ConvertFrom(hub)).To(Succeed())
+			Expect(converted.GetAnnotations()).To(HaveKey("axonops.com/v1-spec"))
+
+			restored := &cassandraaxonopscomv1.AxonOpsCassandra{}
+			Expect(converted.ConvertTo(restored)).To(Succeed())
+			Expect(restored.GetAnnotations()).NotTo(HaveKey("axonops.com/v1-spec"))
+			Expect(equality.Semantic.DeepEqual(restored.Spec, hub.Spec)).To(BeTrue())
+		})
+
+		It("should keep the unchanged components when the object is edited as v1beta1", func() {
+			converted := &cassandraaxonopscomv1beta1.AxonOpsCassandra{}
+			Expect(converted.ConvertFrom(hub)).To(Succeed())
+			converted.Spec.AxonOps.Dashboard.Replicas = 2
+
+			restored := &cassandraaxonopscomv1.AxonOpsCassandra{}
+			Expect(converted.ConvertTo(restored)).To(Succeed())
+			Expect(restored.Spec.AxonOps.Dashboard.Replicas).To(Equal(int32(2)))
+			Expect(restored.Spec.Cassandra.Env).To(Equal(hub.Spec.Cassandra.Env))
+			Expect(restored.Spec.Cassandra.PersistentVolume.Size.String()).To(Equal("20Gi"))
+		})
+
+		It("should keep envFrom when a component is edited as v1beta1", func() {
+			hub.Spec.AxonOps.Dashboard.EnvFrom = []corev1.EnvFromSource{
+				{SecretRef: &corev1.SecretEnvSource{LocalObjectReference: corev1.LocalObjectReference{Name: "dashboard-env"}}},
+			}
+			converted := &cassandraaxonopscomv1beta1.AxonOpsCassandra{}
+			Expect(converted.ConvertFrom(hub)).To(Succeed())
+			converted.Spec.AxonOps.Dashboard.Replicas = 2
+
+			restored := &cassandraaxonopscomv1.AxonOpsCassandra{}
+			Expect(converted.ConvertTo(restored)).To(Succeed())
+			Expect(restored.Spec.AxonOps.Dashboard.Replicas).To(Equal(int32(2)))
+			Expect(restored.Spec.AxonOps.Dashboard.EnvFrom).To(Equal(hub.Spec.AxonOps.Dashboard.EnvFrom))
+		})
+
+		It("should apply the changes made as v1beta1", func() {
+			converted := &cassandraaxonopscomv1beta1.AxonOpsCassandra{}
+			Expect(converted.ConvertFrom(hub)).To(Succeed())
+			converted.Spec.Cassandra.Replicas = 5
+
+			restored := &cassandraaxonopscomv1.AxonOpsCassandra{}
+			Expect(converted.ConvertTo(restored)).To(Succeed())
+			Expect(restored.Spec.Cassandra.Replicas).To(Equal(int32(5)))
+			Expect(restored.Spec.Cassandra.PersistentVolume.Size.String()).To(Equal("20Gi"))
+		})
+
+		It("should keep the topology when the Cassandra cluster is edited as v1beta1", func() {
+			hub.Spec.Cassandra.Racks = []cassandraaxonopscomv1.Rack{{Name: "a", Replicas: 2, Zone: "eu-west-1a"}}
+			hub.Spec.Cassandra.Datacenters = []cassandraaxonopscomv1.Datacenter{{Name: "dc1", Replicas: 3}, {Name: "dc2", Replicas: 1}}
+			converted := &cassandraaxonopscomv1beta1.AxonOpsCassandra{}
+			Expect(converted.ConvertFrom(hub)).To(Succeed())
+			converted.Spec.Cassandra.HeapSize = "1G"
+
+			restored := &cassandraaxonopscomv1.AxonOpsCassandra{}
+			Expect(converted.ConvertTo(restored)).To(Succeed())
+			Expect(restored.Spec.Cassandra.HeapSize).To(Equal("1G"))
+			Expect(restored.Spec.Cassandra.Racks).To(Equal(hub.Spec.Cassandra.Racks))
+			Expect(restored.Spec.Cassandra.Datacenters).To(Equal(hub.Spec.Cassandra.Datacenters))
+		})
+	})
+})
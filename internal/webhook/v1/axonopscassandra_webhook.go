@@ -0,0 +1,479 @@
+/*
+Copyright AxonOps Limited 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"regexp"
+	"slices"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/resource"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	ctrl "sigs.k8s.io/controller-runtime"
+	logf "sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+
+	cassandraaxonopscomv1 "github.com/axonops/axonops-developer-operator/api/v1"
+	"github.com/axonops/axonops-developer-operator/apps"
+)
+
+var axonopscassandralog = logf.Log.WithName("axonopscassandra-resource")
+
+// SupportedCassandraVersions lists the Apache Cassandra major releases the templates can run
+var SupportedCassandraVersions = apps.CassandraVersions
+
+// roleNamePattern matches the superuser names that need no quoting in CQL
+var roleNamePattern = regexp.MustCompile(`^[a-z][a-z0-9_]*$`)
+
+// SetupAxonOpsCassandraWebhookWithManager registers the webhooks for AxonOpsCassandra in the manager.
+// v1 is the hub version, so the conversion webhook serving v1beta1 is registered as well.
+func SetupAxonOpsCassandraWebhookWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewWebhookManagedBy(mgr, &cassandraaxonopscomv1.AxonOpsCassandra{}).
+		WithValidator(&AxonOpsCassandraCustomValidator{}).
+		WithDefaulter(&AxonOpsCassandraCustomDefaulter{}).
+		Complete()
+}
+
+// +kubebuilder:webhook:path=/mutate-axonops-com-v1-axonopscassandra,mutating=true,failurePolicy=fail,sideEffects=None,groups=axonops.com,resources=axonopscassandras,verbs=create,versions=v1,name=maxonopscassandra-v1.kb.io,admissionReviewVersions=v1
+
+// AxonOpsCassandraCustomDefaulter stores the defaults of every unset field in a new
+// AxonOpsCassandra. Updates are not defaulted so the environments created before the
+// webhook keep rendering exactly as they did.
+type AxonOpsCassandraCustomDefaulter struct{}
+
+// Default implements admission.Defaulter
+func (d *AxonOpsCassandraCustomDefaulter) Default(_ context.Context, obj *cassandraaxonopscomv1.AxonOpsCassandra) error {
+	axonopscassandralog.Info("default", "name", obj.GetName())
+
+	apps.SetDefaults(obj)
+	return nil
+}
+
+// +kubebuilder:webhook:path=/validate-axonops-com-v1-axonopscassandra,mutating=false,failurePolicy=fail,sideEffects=None,groups=axonops.com,resources=axonopscassandras,verbs=create;update,versions=v1,name=vaxonopscassandra-v1.kb.io,admissionReviewVersions=v1
+
+// AxonOpsCassandraCustomValidator rejects the AxonOpsCassandra specs the templates cannot render
+// into working objects, so the error is returned by kubectl apply instead of a broken StatefulSet.
+type AxonOpsCassandraCustomValidator struct{}
+
+// ValidateCreate implements admission.Validator
+func (v *AxonOpsCassandraCustomValidator) ValidateCreate(_ context.Context, obj *cassandraaxonopscomv1.AxonOpsCassandra) (admission.Warnings, error) {
+	axonopscassandralog.Info("validate create", "name", obj.GetName())
+
+	warnings, errs := validateSpec(obj)
+	return warnings, toInvalid(obj, errs)
+}
+
+// ValidateUpdate implements admission.Validator
+func (v *AxonOpsCassandraCustomValidator) ValidateUpdate(_ context.Context, oldObj, newObj *cassandraaxonopscomv1.AxonOpsCassandra) (admission.Warnings, error) {
+	axonopscassandralog.Info("validate update", "name", newObj.GetName())
+
+	warnings, errs := validateSpec(newObj)
+	warnings = append(warnings, removedRackWarnings(oldObj, newObj)...)
+	warnings = append(warnings, superuserWarnings(oldObj, newObj)...)
+	errs = append(errs, validateStorageUpdate(oldObj, newObj)...)
+	errs = append(errs, validateUpgrade(oldObj, newObj)...)
+	return warnings, toInvalid(newObj, errs)
+}
+
+// ValidateDelete implements admission.Validator
+func (v *AxonOpsCassandraCustomValidator) ValidateDelete(_ context.Context, _ *cassandraaxonopscomv1.AxonOpsCassandra) (admission.Warnings, error) {
+	return nil, nil
+}
+
+func toInvalid(obj *cassandraaxonopscomv1.AxonOpsCassandra, errs field.ErrorList) error {
+	if len(errs) == 0 {
+		return nil
+	}
+	return apierrors.NewInvalid(cassandraaxonopscomv1.GroupVersion.WithKind("AxonOpsCassandra").GroupKind(), obj.GetName(), errs)
+}
+
+func validateSpec(obj *cassandraaxonopscomv1.AxonOpsCassandra) (admission.Warnings, field.ErrorList) {
+	spec := obj.Spec
+	specPath := field.NewPath("spec")
+	warnings := admission.Warnings{}
+	errs := field.ErrorList{}
+
+	w, e := validateCassandraCluster(spec.Cassandra, specPath.Child("cassandra"))
+	warnings = append(warnings, w...)
+	errs = append(errs, e...)
+
+	serverPath := specPath.Child("axonops", "server")
+	if store := spec.AxonOps.Server.MetricsStore; store.Enabled {
+		w, e := validateCassandraCluster(apps.MetricsStoreCluster(store), serverPath.Child("metricsStore"))
+		warnings = append(warnings, w...)
+		errs = append(errs, e...)
+	}
+	errs = append(errs, validateEnv(spec.AxonOps.Server.Env, apps.ServerManagedEnv, serverPath.Child("env"))...)
+	errs = append(errs, validateEnvFrom(spec.AxonOps.Server.EnvFrom, serverPath.Child("envFrom"))...)
+
+	dashboardPath := specPath.Child("axonops", "dashboard")
+	errs = append(errs, validateEnv(spec.AxonOps.Dashboard.Env, apps.DashboardManagedEnv, dashboardPath.Child("env"))...)
+	errs = append(errs, validateEnvFrom(spec.AxonOps.Dashboard.EnvFrom, dashboardPath.Child("envFrom"))...)
+	if spec.AxonOps.Dashboard.Ingress.Enabled && len(spec.AxonOps.Dashboard.Ingress.Hosts) == 0 {
+		errs = append(errs, field.Required(dashboardPath.Child("ingress", "hosts"),
+			"at least one host is required when the ingress is enabled"))
+	}
+
+	esPath := specPath.Child("axonops", "elasticsearch")
+	errs = append(errs, validateStorageSize(spec.AxonOps.Elasticsearch.PersistentVolume.Size, esPath.Child("persistentVolume", "size"))...)
+	errs = append(errs, validateEnv(spec.AxonOps.Elasticsearch.Env, apps.ElasticsearchManagedEnv, esPath.Child("env"))...)
+	errs = append(errs, validateEnvFrom(spec.AxonOps.Elasticsearch.EnvFrom, esPath.Child("envFrom"))...)
+
+	return warnings, errs
+}
+
+func validateCassandraCluster(cluster cassandraaxonopscomv1.AxonOpsCassandraCluster, path *field.Path) (admission.Warnings, field.ErrorList) {
+	warnings := admission.Warnings{}
+	errs := field.ErrorList{}
+
+	if tag := cluster.Image.Tag; tag != "" {
+		version, ok := apps.CassandraVersion(tag)
+		switch {
+		case !ok:
+			warnings = append(warnings, fmt.Sprintf("%s: cannot tell the Cassandra version of the tag %q, only %s are supported",
+				path.Child("image", "tag"), tag, strings.Join(SupportedCassandraVersions, ", ")))
+		case !isSupportedVersion(version):
+			errs = append(errs, field.NotSupported(path.Child("image", "tag"), tag, SupportedCassandraVersions))
+		}
+	}
+
+	switch {
+	case len(cluster.Datacenters) > 0:
+		for _, f := range []struct {
+			name string
+			set  bool
+		}{
+			{"replicas", cluster.Replicas > 0},
+			{"racks", len(cluster.Racks) > 0},
+			{"dc", cluster.DC != ""},
+		} {
+			if f.set {
+				warnings = append(warnings, fmt.Sprintf("%s is ignored when %s is set, the nodes are configured per datacenter",
+					path.Child(f.name), path.Child("datacenters")))
+			}
+		}
+	case len(cluster.Racks) > 0 && cluster.Replicas > 0:
+		warnings = append(warnings, fmt.Sprintf("%s is ignored when %s is set, the nodes are counted per rack",
+			path.Child("replicas"), path.Child("racks")))
+	}
+
+	errs = append(errs, validateHeap(cluster, path)...)
+	errs = append(errs, validateStorageSize(cluster.PersistentVolume.Size, path.Child("persistentVolume", "size"))...)
+	for i, dc := range cluster.Datacenters {
+		dcPath := path.Child("datacenters").Index(i)
+		if len(dc.Racks) > 0 && dc.Replicas > 0 {
+			warnings = append(warnings, fmt.Sprintf("%s is ignored when %s is set, the nodes are counted per rack",
+				dcPath.Child("replicas"), dcPath.Child("racks")))
+		}
+		// the heap of the cluster is checked again against the memory limit of the datacenter
+		if dc.HeapSize != "" || len(dc.Resources.Limits) > 0 {
+			errs = append(errs, validateHeap(apps.DatacenterCluster(cluster, dc), dcPath)...)
+		}
+		errs = append(errs, validateStorageSize(dc.PersistentVolume.Size, dcPath.Child("persistentVolume", "size"))...)
+	}
+	errs = append(errs, validateEnv(cluster.Env, apps.CassandraManagedEnv, path.Child("env"))...)
+	errs = append(errs, validateEnvFrom(cluster.EnvFrom, path.Child("envFrom"))...)
+	errs = append(errs, validateConfig(cluster, path.Child("config"))...)
+	errs = append(errs, validateAuthentication(cluster, path)...)
+	errs = append(errs, validateTLS(cluster, path)...)
+	w, e := validateJVM(cluster, path)
+	warnings = append(warnings, w...)
+	errs = append(errs, e...)
+
+	return warnings, errs
+}
+
+// validateAuthentication checks the name of the superuser and rejects the authentication
+// settings in config when the operator writes them
+func validateAuthentication(cluster cassandraaxonopscomv1.AxonOpsCassandraCluster, path *field.Path) field.ErrorList {
+	errs := field.ErrorList{}
+	auth := cluster.Authentication
+	if superuser := auth.Superuser; superuser != "" {
+		superuserPath := path.Child("authentication", "superuser")
+		switch {
+		case !roleNamePattern.MatchString(superuser):
+			errs = append(errs, field.Invalid(superuserPath, superuser,
+				"must be lower case letters, digits and underscores starting with a letter"))
+		case superuser == "cassandra":
+			errs = append(errs, field.Invalid(superuserPath, superuser, "the default cassandra role is dropped once the superuser is created"))
+		}
+	}
+	if !auth.Enabled {
+		return errs
+	}
+	for _, key := range slices.Sorted(maps.Keys(apps.AuthenticationSettings)) {
+		if _, ok := cluster.Config[key]; ok {
+			errs = append(errs, field.Forbidden(path.Child("config").Key(key),
+				fmt.Sprintf("%s is set by the operator when %s is true", key, path.Child("authentication", "enabled"))))
+		}
+	}
+	return errs
+}
+
+// validateTLS requires the name of the cert-manager issuer and rejects the encryption
+// settings of the config field the operator writes for the enabled encryption
+func validateTLS(cluster cassandraaxonopscomv1.AxonOpsCassandraCluster, path *field.Path) field.ErrorList {
+	errs := field.ErrorList{}
+	tls := cluster.TLS
+	if tls.IssuerRef != nil && tls.IssuerRef.Name == "" {
+		errs = append(errs, field.Required(path.Child("tls", "issuerRef", "name"), "the name of the cert-manager issuer is required"))
+	}
+	for _, setting := range []struct {
+		key     string
+		flag    string
+		enabled bool
+	}{
+		{apps.ClientEncryptionSetting, "enabled", tls.Enabled},
+		{apps.ServerEncryptionSetting, "internode", tls.Internode},
+	} {
+		if _, ok := cluster.Config[setting.key]; ok && setting.enabled {
+			errs = append(errs, field.Forbidden(path.Child("config").Key(setting.key),
+				fmt.Sprintf("%s is set by the operator when %s is true", setting.key, path.Child("tls", setting.flag))))
+		}
+	}
+	return errs
+}
+
+// superuserWarnings warns that a renamed superuser is ignored, the credentials of the Secret
+// are generated once
+func superuserWarnings(oldObj, newObj *cassandraaxonopscomv1.AxonOpsCassandra) admission.Warnings {
+	before, after := oldObj.Spec.Cassandra.Authentication, newObj.Spec.Cassandra.Authentication
+	if !before.Enabled || !after.Enabled || apps.Superuser(newObj.Spec.Cassandra) == apps.Superuser(oldObj.Spec.Cassandra) {
+		return nil
+	}
+	return admission.Warnings{fmt.Sprintf("spec.cassandra.authentication.superuser is not changed on a running cluster, "+
+		"the superuser of Secret %s is kept", apps.CassandraSuperuserSecretName(newObj.GetName()))}
+}
+
+// validateJVM rejects the JVM options sizing the heap, which the operator sets, and warns
+// about the garbage collectors the Java version of the image may not have
+func validateJVM(cluster cassandraaxonopscomv1.AxonOpsCassandraCluster, path *field.Path) (admission.Warnings, field.ErrorList) {
+	warnings := admission.Warnings{}
+	errs := field.ErrorList{}
+	if cluster.JavaOpts != "" {
+		warnings = append(warnings, fmt.Sprintf("%s is not used by Cassandra, set the JVM options in %s",
+			path.Child("javaOpts"), path.Child("jvm")))
+	}
+	jvm := cluster.JVM
+	if jvm == nil {
+		return warnings, errs
+	}
+
+	jvmPath := path.Child("jvm")
+	switch version, _ := apps.CassandraVersion(cluster.Image.Tag); {
+	case jvm.GC == cassandraaxonopscomv1.GarbageCollectorCMS && version == "5.0":
+		warnings = append(warnings, fmt.Sprintf("%s: CMS was removed from Java 17, the nodes do not start if the image runs it",
+			jvmPath.Child("gc")))
+	case jvm.GC == cassandraaxonopscomv1.GarbageCollectorZGC && (version == "4.0" || version == "4.1"):
+		warnings = append(warnings, fmt.Sprintf("%s: ZGC needs Java 17, Cassandra %s runs Java 11", jvmPath.Child("gc"), version))
+	}
+	for _, f := range []struct {
+		name    string
+		options []string
+	}{
+		{"options", jvm.Options},
+		{"jvm11Options", jvm.JVM11Options},
+		{"jvm17Options", jvm.JVM17Options},
+	} {
+		for i, option := range f.options {
+			optionPath := jvmPath.Child(f.name).Index(i)
+			if !strings.HasPrefix(option, "-") {
+				errs = append(errs, field.Invalid(optionPath, option, "must be a JVM option starting with -"))
+				continue
+			}
+			for _, heap := range apps.JVMHeapOptions {
+				if strings.HasPrefix(option, heap) {
+					errs = append(errs, field.Forbidden(optionPath,
+						fmt.Sprintf("%s is set by the operator from %s or %s", heap, path.Child("heapSize"), jvmPath.Child("heap"))))
+				}
+			}
+		}
+	}
+	return warnings, errs
+}
+
+// validateConfig rejects the cassandra.yaml settings the operator already writes, the ones
+// the Cassandra version of the image does not know and the values that cannot be converted
+// to the units of that version
+func validateConfig(cluster cassandraaxonopscomv1.AxonOpsCassandraCluster, path *field.Path) field.ErrorList {
+	errs := field.ErrorList{}
+	version, known := apps.CassandraVersion(cluster.Image.Tag)
+	keys := slices.Sorted(maps.Keys(cluster.Config))
+	for _, key := range keys {
+		switch {
+		case slices.Contains(apps.CassandraManagedSettings, key):
+			errs = append(errs, field.Forbidden(path.Key(key),
+				fmt.Sprintf("%s is set by the operator and cannot be overridden", key)))
+		case known && version != "5.0" && slices.Contains(apps.Cassandra50Settings, key):
+			errs = append(errs, field.Forbidden(path.Key(key),
+				fmt.Sprintf("%s requires Cassandra 5.0, the nodes run %s", key, version)))
+		}
+	}
+	if _, _, err := apps.CassandraSettings(cluster.Image.Tag, cluster.Config); err != nil {
+		errs = append(errs, field.Invalid(path, "", err.Error()))
+	}
+	return errs
+}
+
+// validateHeap checks the heap size of the nodes of a cluster or a datacenter
+func validateHeap(cluster cassandraaxonopscomv1.AxonOpsCassandraCluster, path *field.Path) field.ErrorList {
+	errs := field.ErrorList{}
+
+	var heap int64
+	if cluster.HeapSize != "" {
+		var ok bool
+		heap, ok = apps.ParseHeapSize(cluster.HeapSize)
+		if !ok {
+			errs = append(errs, field.Invalid(path.Child("heapSize"), cluster.HeapSize,
+				"must be a number of bytes optionally followed by K, M or G, e.g. 512M"))
+		}
+	}
+	// the heap sized from the memory limit always fits
+	auto := cluster.JVM != nil && cluster.JVM.Heap == cassandraaxonopscomv1.JVMHeapAuto
+	if limit := cluster.Resources.Limits.Memory(); heap > 0 && !auto && !limit.IsZero() && heap > limit.Value() {
+		errs = append(errs, field.Invalid(path.Child("heapSize"), cluster.HeapSize,
+			fmt.Sprintf("must not be larger than the memory limit %s", limit.String())))
+	}
+	return errs
+}
+
+// removedRackWarnings warns that the nodes of a removed rack are decommissioned
+func removedRackWarnings(oldObj, newObj *cassandraaxonopscomv1.AxonOpsCassandra) admission.Warnings {
+	warnings := admission.Warnings{}
+	kept := map[string]bool{}
+	for _, rack := range apps.CassandraRacks(newObj.GetName(), newObj.Spec.Cassandra) {
+		kept[rack.StatefulSet] = true
+	}
+	for _, rack := range apps.CassandraRacks(oldObj.GetName(), oldObj.Spec.Cassandra) {
+		if !kept[rack.StatefulSet] {
+			warnings = append(warnings, fmt.Sprintf("the nodes of the StatefulSet %s of rack %s are decommissioned one at a time before it is deleted",
+				rack.StatefulSet, rack.Name))
+		}
+	}
+	return warnings
+}
+
+// validateStorageUpdate rejects shrinking a volume, neither Kubernetes nor Cassandra can do it
+func validateStorageUpdate(oldObj, newObj *cassandraaxonopscomv1.AxonOpsCassandra) field.ErrorList {
+	errs := field.ErrorList{}
+	type volumeUpdate struct {
+		path     *field.Path
+		old, new *resource.Quantity
+	}
+	volumes := []volumeUpdate{
+		{
+			field.NewPath("spec", "cassandra", "persistentVolume", "size"),
+			oldObj.Spec.Cassandra.PersistentVolume.Size,
+			newObj.Spec.Cassandra.PersistentVolume.Size,
+		},
+		{
+			field.NewPath("spec", "axonops", "server", "metricsStore", "persistentVolume", "size"),
+			oldObj.Spec.AxonOps.Server.MetricsStore.PersistentVolume.Size,
+			newObj.Spec.AxonOps.Server.MetricsStore.PersistentVolume.Size,
+		},
+		{
+			field.NewPath("spec", "axonops", "elasticsearch", "persistentVolume", "size"),
+			oldObj.Spec.AxonOps.Elasticsearch.PersistentVolume.Size,
+			newObj.Spec.AxonOps.Elasticsearch.PersistentVolume.Size,
+		},
+	}
+	for i, dc := range newObj.Spec.Cassandra.Datacenters {
+		for _, oldDC := range oldObj.Spec.Cassandra.Datacenters {
+			if oldDC.Name == dc.Name {
+				volumes = append(volumes, volumeUpdate{
+					field.NewPath("spec", "cassandra", "datacenters").Index(i).Child("persistentVolume", "size"),
+					oldDC.PersistentVolume.Size,
+					dc.PersistentVolume.Size,
+				})
+			}
+		}
+	}
+	for _, v := range volumes {
+		if v.old == nil || v.new == nil {
+			continue
+		}
+		if v.new.Cmp(*v.old) < 0 {
+			errs = append(errs, field.Forbidden(v.path, fmt.Sprintf("cannot be reduced from %s to %s", v.old.String(), v.new.String())))
+		}
+	}
+	return errs
+}
+
+// validateUpgrade rejects the Cassandra image changes skipping or going back a major version
+func validateUpgrade(oldObj, newObj *cassandraaxonopscomv1.AxonOpsCassandra) field.ErrorList {
+	if err := apps.ValidateCassandraUpgrade(oldObj.Spec.Cassandra.Image.Tag, newObj.Spec.Cassandra.Image.Tag); err != nil {
+		return field.ErrorList{field.Forbidden(field.NewPath("spec", "cassandra", "image", "tag"), err.Error())}
+	}
+	return nil
+}
+
+func validateStorageSize(size *resource.Quantity, path *field.Path) field.ErrorList {
+	if size == nil {
+		return nil
+	}
+	if size.Sign() <= 0 {
+		return field.ErrorList{field.Invalid(path, size.String(), "must be greater than zero")}
+	}
+	return nil
+}
+
+// validateEnv rejects the variables the operator already sets on the container
+func validateEnv(env []corev1.EnvVar, managed []string, path *field.Path) field.ErrorList {
+	errs := field.ErrorList{}
+	for i, e := range env {
+		for _, name := range managed {
+			if e.Name == name {
+				errs = append(errs, field.Forbidden(path.Index(i).Child("name"),
+					fmt.Sprintf("%s is set by the operator and cannot be overridden", name)))
+			}
+		}
+	}
+	return errs
+}
+
+// validateEnvFrom requires every source to name one ConfigMap or one Secret, the pods of the
+// StatefulSet could not be created otherwise
+func validateEnvFrom(envFrom []corev1.EnvFromSource, path *field.Path) field.ErrorList {
+	errs := field.ErrorList{}
+	for i, e := range envFrom {
+		switch {
+		case e.ConfigMapRef != nil && e.SecretRef != nil:
+			errs = append(errs, field.Invalid(path.Index(i), "configMapRef, secretRef", "only one of configMapRef and secretRef can be set"))
+		case e.ConfigMapRef != nil && e.ConfigMapRef.Name == "":
+			errs = append(errs, field.Required(path.Index(i).Child("configMapRef", "name"), "the name of the ConfigMap is required"))
+		case e.SecretRef != nil && e.SecretRef.Name == "":
+			errs = append(errs, field.Required(path.Index(i).Child("secretRef", "name"), "the name of the Secret is required"))
+		case e.ConfigMapRef == nil && e.SecretRef == nil:
+			errs = append(errs, field.Required(path.Index(i), "a configMapRef or a secretRef is required"))
+		}
+	}
+	return errs
+}
+
+func isSupportedVersion(version string) bool {
+	for _, v := range SupportedCassandraVersions {
+		if v == version {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,459 @@
+/*
+Copyright AxonOps Limited 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1
+
+import (
+	"context"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	cassandraaxonopscomv1 "github.com/axonops/axonops-developer-operator/api/v1"
+)
+
+var _ = Describe("AxonOpsCassandra Webhook", func() {
+	var (
+		ctx       context.Context
+		obj       *cassandraaxonopscomv1.AxonOpsCassandra
+		validator AxonOpsCassandraCustomValidator
+	)
+
+	BeforeEach(func() {
+		ctx = context.Background()
+		obj = &cassandraaxonopscomv1.AxonOpsCassandra{
+			ObjectMeta: metav1.ObjectMeta{Name: "test", Namespace: "default"},
+		}
+		validator = AxonOpsCassandraCustomValidator{}
+	})
+
+	Context("When creating an AxonOpsCassandra", func() {
+		It("should admit the default spec", func() {
+			warnings, err := validator.ValidateCreate(ctx, obj)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(warnings).To(BeEmpty())
+		})
+
+		It("should admit the supported Cassandra versions", func() {
+			for _, tag := range []string{"4.0", "4.0.13", "4.1.7", "5.0.2", "5.0-jammy"} {
+				obj.Spec.Cassandra.Image.Tag = tag
+				_, err := validator.ValidateCreate(ctx, obj)
+				Expect(err).NotTo(HaveOccurred(), tag)
+			}
+		})
+
+		It("should deny unsupported Cassandra versions", func() {
+			for _, tag := range []string{"3.11.17", "4.2", "6.0"} {
+				obj.Spec.Cassandra.Image.Tag = tag
+				_, err := validator.ValidateCreate(ctx, obj)
+				Expect(err).To(MatchError(ContainSubstring("spec.cassandra.image.tag")), tag)
+			}
+		})
+
+		It("should only warn about tags without a version", func() {
+			obj.Spec.Cassandra.Image.Tag = "latest"
+			warnings, err := validator.ValidateCreate(ctx, obj)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(warnings).To(HaveLen(1))
+		})
+
+		It("should deny a heap size that cannot be parsed", func() {
+			obj.Spec.Cassandra.HeapSize = "1.5 gigs"
+			_, err := validator.ValidateCreate(ctx, obj)
+			Expect(err).To(MatchError(ContainSubstring("spec.cassandra.heapSize")))
+		})
+
+		It("should deny a heap larger than the memory limit", func() {
+			obj.Spec.Cassandra.HeapSize = "4G"
+			obj.Spec.Cassandra.Resources.Limits = corev1.ResourceList{corev1.ResourceMemory: resource.MustParse("2Gi")}
+			_, err := validator.ValidateCreate(ctx, obj)
+			Expect(err).To(MatchError(ContainSubstring("memory limit")))
+
+			obj.Spec.Cassandra.HeapSize = "1G"
+			_, err = validator.ValidateCreate(ctx, obj)
+			Expect(err).NotTo(HaveOccurred())
+		})
+
+		It("should deny an empty volume", func() {
+			obj.Spec.AxonOps.Elasticsearch.PersistentVolume.Size = quantity("0")
+			_, err := validator.ValidateCreate(ctx, obj)
+			Expect(err).To(MatchError(ContainSubstring("spec.axonops.elasticsearch.persistentVolume.size")))
+		})
+
+		It("should deny an ingress without hosts", func() {
+			obj.Spec.AxonOps.Dashboard.Ingress.Enabled = true
+			_, err := validator.ValidateCreate(ctx, obj)
+			Expect(err).To(MatchError(ContainSubstring("spec.axonops.dashboard.ingress.hosts")))
+		})
+
+		It("should deny env vars managed by the operator", func() {
+			obj.Spec.Cassandra.Env = []corev1.EnvVar{
+				{Name: "JVM_EXTRA_OPTS", Value: "-Dfoo=bar"},
+				{Name: "CASSANDRA_SEEDS", Value: "10.0.0.1"},
+			}
+			_, err := validator.ValidateCreate(ctx, obj)
+			Expect(err).To(MatchError(ContainSubstring("spec.cassandra.env[1].name")))
+		})
+
+		It("should deny an envFrom source without a ConfigMap or a Secret", func() {
+			obj.Spec.AxonOps.Dashboard.EnvFrom = []corev1.EnvFromSource{
+				{SecretRef: &corev1.SecretEnvSource{LocalObjectReference: corev1.LocalObjectReference{Name: "dashboard-env"}}},
+				{Prefix: "AXON_"},
+			}
+			_, err := validator.ValidateCreate(ctx, obj)
+			Expect(err).To(MatchError(ContainSubstring("spec.axonops.dashboard.envFrom[1]")))
+
+			obj.Spec.AxonOps.Dashboard.EnvFrom[1].ConfigMapRef = &corev1.ConfigMapEnvSource{
+				LocalObjectReference: corev1.LocalObjectReference{Name: "dashboard-config"},
+			}
+			_, err = validator.ValidateCreate(ctx, obj)
+			Expect(err).NotTo(HaveOccurred())
+		})
+
+		It("should deny cassandra.yaml settings managed by the operator", func() {
+			obj.Spec.Cassandra.Config = map[string]apiextensionsv1.JSON{
+				"num_tokens":   {Raw: []byte(`16`)},
+				"cluster_name": {Raw: []byte(`"other"`)},
+			}
+			_, err := validator.ValidateCreate(ctx, obj)
+			Expect(err).To(MatchError(ContainSubstring("spec.cassandra.config[cluster_name]")))
+		})
+
+		It("should deny Cassandra 5.0 settings on a 4.x cluster", func() {
+			obj.Spec.Cassandra.Config = map[string]apiextensionsv1.JSON{
+				"default_secondary_index": {Raw: []byte(`"sai"`)},
+			}
+			obj.Spec.Cassandra.Image.Tag = "5.0.2"
+			_, err := validator.ValidateCreate(ctx, obj)
+			Expect(err).NotTo(HaveOccurred())
+
+			obj.Spec.Cassandra.Image.Tag = "4.1.7"
+			_, err = validator.ValidateCreate(ctx, obj)
+			Expect(err).To(MatchError(ContainSubstring("requires Cassandra 5.0")))
+		})
+
+		It("should deny values Cassandra 4.0 cannot take", func() {
+			obj.Spec.Cassandra.Config = map[string]apiextensionsv1.JSON{
+				"read_request_timeout": {Raw: []byte(`"10s"`)},
+			}
+			obj.Spec.Cassandra.Image.Tag = "4.0.13"
+			_, err := validator.ValidateCreate(ctx, obj)
+			Expect(err).NotTo(HaveOccurred())
+
+			obj.Spec.Cassandra.Config["read_request_timeout"] = apiextensionsv1.JSON{Raw: []byte(`"1500us"`)}
+			_, err = validator.ValidateCreate(ctx, obj)
+			Expect(err).To(MatchError(ContainSubstring("spec.cassandra.config")))
+		})
+
+		It("should deny JVM options sizing the heap", func() {
+			obj.Spec.Cassandra.JVM = &cassandraaxonopscomv1.JVMOptions{
+				Options:      []string{"-XX:+AlwaysPreTouch"},
+				JVM17Options: []string{"-Xmx4G"},
+			}
+			_, err := validator.ValidateCreate(ctx, obj)
+			Expect(err).To(MatchError(ContainSubstring("spec.cassandra.jvm.jvm17Options[0]")))
+
+			obj.Spec.Cassandra.JVM.JVM17Options = []string{"UseG1GC"}
+			_, err = validator.ValidateCreate(ctx, obj)
+			Expect(err).To(MatchError(ContainSubstring("must be a JVM option")))
+		})
+
+		It("should warn about a garbage collector the Java version may not have", func() {
+			obj.Spec.Cassandra.Image.Tag = "5.0.2"
+			obj.Spec.Cassandra.JVM = &cassandraaxonopscomv1.JVMOptions{GC: cassandraaxonopscomv1.GarbageCollectorCMS}
+			warnings, err := validator.ValidateCreate(ctx, obj)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(warnings).To(ConsistOf(ContainSubstring("spec.cassandra.jvm.gc")))
+
+			obj.Spec.Cassandra.Image.Tag = "4.1.7"
+			warnings, err = validator.ValidateCreate(ctx, obj)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(warnings).To(BeEmpty())
+		})
+
+		It("should not check the heap size when it is derived from the memory limit", func() {
+			obj.Spec.Cassandra.HeapSize = "4G"
+			obj.Spec.Cassandra.Resources.Limits = corev1.ResourceList{corev1.ResourceMemory: resource.MustParse("2Gi")}
+			obj.Spec.Cassandra.JVM = &cassandraaxonopscomv1.JVMOptions{Heap: cassandraaxonopscomv1.JVMHeapAuto}
+			_, err := validator.ValidateCreate(ctx, obj)
+			Expect(err).NotTo(HaveOccurred())
+		})
+
+		It("should warn that javaOpts is not used by Cassandra", func() {
+			obj.Spec.Cassandra.JavaOpts = "-Xms512m -Xmx512m"
+			warnings, err := validator.ValidateCreate(ctx, obj)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(warnings).To(ConsistOf(ContainSubstring("spec.cassandra.javaOpts")))
+		})
+
+		It("should deny the authentication settings in config when authentication is enabled", func() {
+			obj.Spec.Cassandra.Config = map[string]apiextensionsv1.JSON{
+				"authenticator": {Raw: []byte(`"PasswordAuthenticator"`)},
+			}
+			_, err := validator.ValidateCreate(ctx, obj)
+			Expect(err).NotTo(HaveOccurred())
+
+			obj.Spec.Cassandra.Authentication.Enabled = true
+			_, err = validator.ValidateCreate(ctx, obj)
+			Expect(err).To(MatchError(ContainSubstring("spec.cassandra.config[authenticator]")))
+		})
+
+		It("should deny a superuser that is not a plain role name", func() {
+			obj.Spec.Cassandra.Authentication = cassandraaxonopscomv1.Authentication{Enabled: true, Superuser: "dba_1"}
+			_, err := validator.ValidateCreate(ctx, obj)
+			Expect(err).NotTo(HaveOccurred())
+
+			for _, superuser := range []string{"Admin", "my-admin", "cassandra"} {
+				obj.Spec.Cassandra.Authentication.Superuser = superuser
+				_, err = validator.ValidateCreate(ctx, obj)
+				Expect(err).To(MatchError(ContainSubstring("spec.cassandra.authentication.superuser")), superuser)
+			}
+		})
+
+		It("should deny the client encryption options in config when TLS is enabled", func() {
+			obj.Spec.Cassandra.Config = map[string]apiextensionsv1.JSON{
+				"client_encryption_options": {Raw: []byte(`{"enabled": true}`)},
+			}
+			_, err := validator.ValidateCreate(ctx, obj)
+			Expect(err).NotTo(HaveOccurred())
+
+			obj.Spec.Cassandra.TLS.Enabled = true
+			_, err = validator.ValidateCreate(ctx, obj)
+			Expect(err).To(MatchError(ContainSubstring("spec.cassandra.config[client_encryption_options]")))
+		})
+
+		It("should deny the server encryption options in config when internode encryption is enabled", func() {
+			obj.Spec.Cassandra.Config = map[string]apiextensionsv1.JSON{
+				"server_encryption_options": {Raw: []byte(`{"internode_encryption": "all"}`)},
+			}
+			obj.Spec.Cassandra.TLS.Enabled = true
+			_, err := validator.ValidateCreate(ctx, obj)
+			Expect(err).NotTo(HaveOccurred())
+
+			obj.Spec.Cassandra.TLS.Internode = true
+			_, err = validator.ValidateCreate(ctx, obj)
+			Expect(err).To(MatchError(ContainSubstring("spec.cassandra.config[server_encryption_options]")))
+		})
+
+		It("should require the name of the cert-manager issuer", func() {
+			obj.Spec.Cassandra.TLS = cassandraaxonopscomv1.TLS{Enabled: true, IssuerRef: &cassandraaxonopscomv1.IssuerReference{}}
+			_, err := validator.ValidateCreate(ctx, obj)
+			Expect(err).To(MatchError(ContainSubstring("spec.cassandra.tls.issuerRef.name")))
+
+			obj.Spec.Cassandra.TLS.IssuerRef.Name = "ca-issuer"
+			_, err = validator.ValidateCreate(ctx, obj)
+			Expect(err).NotTo(HaveOccurred())
+		})
+
+		It("should validate the metrics store only when it is enabled", func() {
+			obj.Spec.AxonOps.Server.MetricsStore.HeapSize = "lots"
+			_, err := validator.ValidateCreate(ctx, obj)
+			Expect(err).NotTo(HaveOccurred())
+
+			obj.Spec.AxonOps.Server.MetricsStore.Enabled = true
+			_, err = validator.ValidateCreate(ctx, obj)
+			Expect(err).To(MatchError(ContainSubstring("spec.axonops.server.metricsStore.heapSize")))
+		})
+
+		It("should warn that the replicas are ignored when racks are set", func() {
+			obj.Spec.Cassandra.Replicas = 3
+			obj.Spec.Cassandra.Racks = []cassandraaxonopscomv1.Rack{{Name: "a", Replicas: 1}, {Name: "b", Replicas: 1}}
+			warnings, err := validator.ValidateCreate(ctx, obj)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(warnings).To(ContainElement(ContainSubstring("spec.cassandra.replicas is ignored")))
+		})
+
+		It("should warn about the cluster topology ignored when datacenters are set", func() {
+			obj.Spec.Cassandra.DC = "dc1"
+			obj.Spec.Cassandra.Datacenters = []cassandraaxonopscomv1.Datacenter{{Name: "dc1"}, {Name: "dc2"}}
+			warnings, err := validator.ValidateCreate(ctx, obj)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(warnings).To(ConsistOf(ContainSubstring("spec.cassandra.dc is ignored")))
+		})
+
+		It("should check the heap against the memory limit of the datacenter", func() {
+			obj.Spec.Cassandra.HeapSize = "1G"
+			obj.Spec.Cassandra.Datacenters = []cassandraaxonopscomv1.Datacenter{
+				{Name: "dc1"},
+				{Name: "dc2", Resources: corev1.ResourceRequirements{
+					Limits: corev1.ResourceList{corev1.ResourceMemory: resource.MustParse("512Mi")},
+				}},
+			}
+			_, err := validator.ValidateCreate(ctx, obj)
+			Expect(err).To(MatchError(ContainSubstring("spec.cassandra.datacenters[1].heapSize")))
+			Expect(err).NotTo(MatchError(ContainSubstring("spec.cassandra.datacenters[0]")))
+		})
+	})
+
+	Context("When updating an AxonOpsCassandra", func() {
+		It("should deny shrinking the storage of a datacenter", func() {
+			obj.Spec.Cassandra.Datacenters = []cassandraaxonopscomv1.Datacenter{
+				{Name: "dc1", PersistentVolume: cassandraaxonopscomv1.PersistentVolumeSpec{Size: quantity("10Gi")}},
+			}
+			newObj := obj.DeepCopy()
+			newObj.Spec.Cassandra.Datacenters[0].PersistentVolume.Size = quantity("5Gi")
+			_, err := validator.ValidateUpdate(ctx, obj, newObj)
+			Expect(err).To(MatchError(ContainSubstring("spec.cassandra.datacenters[0].persistentVolume.size")))
+		})
+
+		It("should warn when a rack is removed", func() {
+			obj.Spec.Cassandra.Racks = []cassandraaxonopscomv1.Rack{{Name: "a", Replicas: 1}, {Name: "b", Replicas: 1}}
+			newObj := obj.DeepCopy()
+			newObj.Spec.Cassandra.Racks = newObj.Spec.Cassandra.Racks[:1]
+			warnings, err := validator.ValidateUpdate(ctx, obj, newObj)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(warnings).To(ConsistOf(ContainSubstring("ca-test-b")))
+		})
+
+		It("should warn that the superuser of a running cluster is kept", func() {
+			obj.Spec.Cassandra.Authentication.Enabled = true
+			newObj := obj.DeepCopy()
+			newObj.Spec.Cassandra.Authentication.Superuser = "dba"
+			warnings, err := validator.ValidateUpdate(ctx, obj, newObj)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(warnings).To(ConsistOf(ContainSubstring("ca-test-superuser")))
+		})
+
+		It("should deny shrinking the storage", func() {
+			obj.Spec.AxonOps.Elasticsearch.PersistentVolume.Size = quantity("10Gi")
+			newObj := obj.DeepCopy()
+			newObj.Spec.AxonOps.Elasticsearch.PersistentVolume.Size = quantity("5Gi")
+			_, err := validator.ValidateUpdate(ctx, obj, newObj)
+			Expect(err).To(MatchError(ContainSubstring("cannot be reduced")))
+		})
+
+		It("should admit an upgrade to the next Cassandra version", func() {
+			obj.Spec.Cassandra.Image.Tag = "4.1.7"
+			newObj := obj.DeepCopy()
+			newObj.Spec.Cassandra.Image.Tag = "5.0.2"
+			_, err := validator.ValidateUpdate(ctx, obj, newObj)
+			Expect(err).NotTo(HaveOccurred())
+		})
+
+		It("should deny skipping or going back a Cassandra version", func() {
+			for _, tags := range [][2]string{{"4.0.13", "5.0.2"}, {"5.0.2", "4.1.7"}} {
+				obj.Spec.Cassandra.Image.Tag = tags[0]
+				newObj := obj.DeepCopy()
+				newObj.Spec.Cassandra.Image.Tag = tags[1]
+				_, err := validator.ValidateUpdate(ctx, obj, newObj)
+				Expect(err).To(MatchError(ContainSubstring("spec.cassandra.image.tag")), tags[1])
+			}
+		})
+
+		It("should admit growing the storage", func() {
+			obj.Spec.AxonOps.Elasticsearch.PersistentVolume.Size = quantity("10Gi")
+			newObj := obj.DeepCopy()
+			newObj.Spec.AxonOps.Elasticsearch.PersistentVolume.Size = quantity("20Gi")
+			_, err := validator.ValidateUpdate(ctx, obj, newObj)
+			Expect(err).NotTo(HaveOccurred())
+		})
+	})
+
+	Context("When defaulting an AxonOpsCassandra", func() {
+		var defaulter AxonOpsCassandraCustomDefaulter
+
+		It("should write the implicit defaults into the spec", func() {
+			Expect(defaulter.Default(ctx, obj)).To(Succeed())
+			Expect(obj.Spec.Cassandra.Replicas).To(Equal(int32(1)))
+			Expect(obj.Spec.Cassandra.Image.Tag).To(Equal("5.0.2"))
+			Expect(obj.Spec.Cassandra.ClusterName).To(Equal("test"))
+			Expect(obj.Spec.Cassandra.DC).To(Equal("dc1"))
+			Expect(obj.Spec.Cassandra.SeedsPerDC).To(Equal(int32(3)))
+			Expect(obj.Spec.Cassandra.HeapSize).To(Equal("512M"))
+			Expect(obj.Spec.Cassandra.Resources.Limits.Memory().String()).To(Equal("2Gi"))
+			Expect(obj.Spec.AxonOps.Elasticsearch.Image.Tag).To(Equal("7.17.0"))
+			Expect(obj.Spec.AxonOps.Server.Resources.Requests.Cpu().String()).To(Equal("250m"))
+			Expect(obj.Spec.AxonOps.Server.MetricsStore.ClusterName).To(BeEmpty())
+			Expect(obj.Spec.AxonOps.Dashboard.Ingress.Path).To(BeEmpty())
+			Expect(obj.Spec.DriftPolicy).To(Equal(cassandraaxonopscomv1.DriftPolicyRevert))
+		})
+
+		It("should default the metrics cluster when it is enabled", func() {
+			obj.Spec.AxonOps.Server.MetricsStore.Enabled = true
+			Expect(defaulter.Default(ctx, obj)).To(Succeed())
+			Expect(obj.Spec.Cassandra.DC).To(Equal("axonops1"))
+			Expect(obj.Spec.AxonOps.Server.MetricsStore.ClusterName).To(Equal("metrics-test"))
+			Expect(obj.Spec.AxonOps.Server.MetricsStore.Replicas).To(Equal(int32(1)))
+		})
+
+		It("should default the replicas of the racks instead of the cluster", func() {
+			obj.Spec.Cassandra.Racks = []cassandraaxonopscomv1.Rack{{Name: "a"}, {Name: "b", Replicas: 2}}
+			Expect(defaulter.Default(ctx, obj)).To(Succeed())
+			Expect(obj.Spec.Cassandra.Replicas).To(BeZero())
+			Expect(obj.Spec.Cassandra.Racks[0].Replicas).To(Equal(int32(1)))
+			Expect(obj.Spec.Cassandra.Racks[1].Replicas).To(Equal(int32(2)))
+		})
+
+		It("should default the replicas of the datacenters", func() {
+			obj.Spec.Cassandra.Datacenters = []cassandraaxonopscomv1.Datacenter{
+				{Name: "dc1"},
+				{Name: "dc2", Racks: []cassandraaxonopscomv1.Rack{{Name: "a"}}},
+			}
+			Expect(defaulter.Default(ctx, obj)).To(Succeed())
+			Expect(obj.Spec.Cassandra.Replicas).To(BeZero())
+			Expect(obj.Spec.Cassandra.DC).To(BeEmpty())
+			Expect(obj.Spec.Cassandra.Datacenters[0].Replicas).To(Equal(int32(1)))
+			Expect(obj.Spec.Cassandra.Datacenters[1].Replicas).To(BeZero())
+			Expect(obj.Spec.Cassandra.Datacenters[1].Racks[0].Replicas).To(Equal(int32(1)))
+		})
+
+		It("should keep the values set by the user", func() {
+			obj.Spec.Cassandra.Image.Tag = "4.1.7"
+			obj.Spec.Cassandra.DC = "eu-west"
+			obj.Spec.AxonOps.Dashboard.Ingress.Enabled = true
+			obj.Spec.AxonOps.Dashboard.Ingress.Path = "/axonops"
+			obj.Spec.DriftPolicy = cassandraaxonopscomv1.DriftPolicyReport
+			Expect(defaulter.Default(ctx, obj)).To(Succeed())
+			Expect(obj.Spec.Cassandra.Image.Tag).To(Equal("4.1.7"))
+			Expect(obj.Spec.Cassandra.DC).To(Equal("eu-west"))
+			Expect(obj.Spec.AxonOps.Dashboard.Ingress.Path).To(Equal("/axonops"))
+			Expect(obj.Spec.AxonOps.Dashboard.Ingress.ApiVersion).To(Equal("networking.k8s.io/v1"))
+			Expect(obj.Spec.DriftPolicy).To(Equal(cassandraaxonopscomv1.DriftPolicyReport))
+		})
+
+		It("should cap a defaulted request to the limit set by the user", func() {
+			obj.Spec.Cassandra.Resources.Limits = corev1.ResourceList{corev1.ResourceMemory: resource.MustParse("512Mi")}
+			Expect(defaulter.Default(ctx, obj)).To(Succeed())
+			Expect(obj.Spec.Cassandra.Resources.Requests.Memory().String()).To(Equal("512Mi"))
+			Expect(obj.Spec.Cassandra.Resources.Limits.Cpu().String()).To(Equal("1"))
+		})
+
+		It("should produce a spec the validator admits", func() {
+			obj.Spec.AxonOps.Server.MetricsStore.Enabled = true
+			Expect(defaulter.Default(ctx, obj)).To(Succeed())
+			_, err := validator.ValidateCreate(ctx, obj)
+			Expect(err).NotTo(HaveOccurred())
+		})
+
+		It("should produce a spec with datacenters the validator admits without warnings", func() {
+			obj.Spec.AxonOps.Server.MetricsStore.Enabled = true
+			obj.Spec.Cassandra.Datacenters = []cassandraaxonopscomv1.Datacenter{{Name: "dc1"}, {Name: "dc2"}}
+			Expect(defaulter.Default(ctx, obj)).To(Succeed())
+			warnings, err := validator.ValidateCreate(ctx, obj)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(warnings).To(BeEmpty())
+		})
+	})
+})
+
+func quantity(size string) *resource.Quantity {
+	q := resource.MustParse(size)
+	return &q
+}